@@ -0,0 +1,98 @@
+package events
+
+import (
+	"fmt"
+	"path"
+)
+
+/*
+A Topic which can be published to on behalf of another Factory, keeping the route of the event.
+*/
+type hopPublisher interface {
+	publishHops(event interface{}, hops []string)
+}
+
+/*
+Forwards the events of the named Topics of the source Factory to the same-named Topics of the
+destination Factory, which are created (as standard Topics) where missing. The source Topics
+have to exist already.
+
+Forwarded events keep track of the Factories they went through (see Envelope.Hops), and are
+never forwarded into a Factory they have already been in. Hence bridging the same Topics both
+ways (or in a circle of Factories) does not make events bounce back and forth. Hops are only
+kept within the process, i.e. not by the Topics of events/client.
+*/
+func Bridge(src Factory, dst Factory, topics ...string) error {
+	bridged := []Topic{}
+	for _, topicName := range topics {
+		topic, exists := src.Lookup(topicName)
+		if !exists {
+			return fmt.Errorf("No topic named '%v' in the source factory", topicName)
+		}
+		bridged = append(bridged, topic)
+	}
+	for _, topic := range bridged {
+		bridgeTopic(src, dst, topic)
+	}
+	return nil
+}
+
+/*
+Bridges the Topics of the source Factory with names matching any of the patterns, as understood
+by path.Match (e.g. 'orders.*'). Only the Topics open at the time of the call are bridged.
+*/
+func BridgeMatching(src Factory, dst Factory, patterns ...string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("Invalid topic pattern '%v': %v", pattern, err)
+		}
+	}
+	for _, topic := range src.Topics() {
+		for _, pattern := range patterns {
+			if matches, _ := path.Match(pattern, topic.String()); matches {
+				bridgeTopic(src, dst, topic)
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func bridgeTopic(src Factory, dst Factory, topic Topic) {
+	from, to := factoryId(src), factoryId(dst)
+	target, exists := dst.Lookup(topic.String())
+	if !exists {
+		target = dst.NewTopic(topic.String())
+	}
+	publisher := target.NewPublisher()
+	hopTarget, keepsHops := target.(hopPublisher)
+	topic.NewSubscriber(func(event interface{}) {
+		envelope := event.(*Envelope)
+		hops := envelope.Hops
+		if len(hops) == 0 {
+			hops = []string{from}
+		}
+		for _, hop := range hops {
+			if hop == to {
+				return
+			}
+		}
+		if keepsHops {
+			//the forwarded event continues the trace, if the Factories trace
+			hopTarget.publishHops(WithinSpan(envelope.Trace, envelope.Event), append(append([]string{}, hops...), to))
+		} else {
+			publisher(envelope.Event)
+		}
+	}, WithEnvelope())
+	if local, isLocal := src.(*factory); isLocal {
+		local.addBridge(topic, to)
+	}
+}
+
+//Factories of this package have an id, others are told apart by their address
+func factoryId(f Factory) string {
+	if local, isLocal := f.(*factory); isLocal {
+		return local.id
+	}
+	return fmt.Sprintf("%T@%p", f, f)
+}
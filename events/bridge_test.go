@@ -0,0 +1,84 @@
+package events
+
+import (
+	"github.com/tholowka/testing/assertions"
+	"testing"
+	"time"
+)
+
+func TestThat_Bridge_ForwardsEvents_ToTheSameNamedTopic(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	src, dst := NewFactory(), NewFactory()
+	source := src.NewTopic("orders")
+	received := make(chan *Envelope)
+	//when
+	err := Bridge(src, dst, "orders")
+	assert.IsTrue(err == nil)
+	target, exists := dst.Lookup("orders")
+	assert.IsTrue(exists)
+	target.NewSubscriber(func(event interface{}) {
+		received <- event.(*Envelope)
+	}, WithEnvelope())
+	source.NewPublisher()("order")
+	//then
+	envelope := <-received
+	assert.AreEqual("order", envelope.Event)
+	assert.AreEqual([]string{factoryId(src), factoryId(dst)}, envelope.Hops)
+}
+
+func TestThat_Bridge_Fails_ForMissingSourceTopics(t *testing.T) {
+	assert := assertions.New(t)
+	src, dst := NewFactory(), NewFactory()
+	assert.IsTrue(Bridge(src, dst, "missing") != nil)
+	_, exists := dst.Lookup("missing")
+	assert.IsTrue(!exists)
+}
+
+func TestThat_Bridges_BothWays_DoNotLoop(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	first, second := NewFactory(), NewFactory()
+	firstTopic := first.NewTopic("orders")
+	secondTopic := second.NewTopic("orders")
+	Bridge(first, second, "orders")
+	Bridge(second, first, "orders")
+	firstReceived := make(chan interface{}, 10)
+	secondReceived := make(chan interface{}, 10)
+	firstTopic.NewSubscriber(func(event interface{}) {
+		firstReceived <- event
+	})
+	secondTopic.NewSubscriber(func(event interface{}) {
+		secondReceived <- event
+	})
+	//when
+	firstTopic.NewPublisher()("from the first")
+	secondTopic.NewPublisher()("from the second")
+	//then every event reaches each factory once
+	for i := 0; i < 2; i++ {
+		<-firstReceived
+		<-secondReceived
+	}
+	<-time.After(50 * time.Millisecond)
+	assert.AreEqual(0, len(firstReceived))
+	assert.AreEqual(0, len(secondReceived))
+}
+
+func TestThat_BridgeMatching_ForwardsTopics_MatchingThePatterns(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	src, dst := NewFactory(), NewFactory()
+	src.NewTopic("orders.created")
+	src.NewTopic("orders.paid")
+	src.NewTopic("payments")
+	//when
+	err := BridgeMatching(src, dst, "orders.*")
+	//then
+	assert.IsTrue(err == nil)
+	names := []string{}
+	for _, topic := range dst.Topics() {
+		names = append(names, topic.String())
+	}
+	assert.AreEqual([]string{"orders.created", "orders.paid"}, names)
+	assert.IsTrue(BridgeMatching(src, dst, "[") != nil)
+}
@@ -0,0 +1,238 @@
+package events
+
+import (
+	"errors"
+	"path"
+	"sync"
+	"sync/atomic"
+)
+
+/*
+A driver of a message broker (e.g. an external one), which a Factory can delegate Topics to,
+see WithBroker. Brokers move encoded events between publishers and subscribers of named topics.
+
+Drivers have to pass the conformance suite of events/brokertest. In short: every subscription
+of a topic receives the payloads published to that topic after it was made, until it is closed.
+Payloads may be delivered concurrently, in any order, and at most once.
+*/
+type Broker interface {
+	Publish(topic string, payload []byte) error
+	Subscribe(topic string, handler func(payload []byte)) (BrokerSubscription, error)
+	//Frees the resources of the driver. Publishing afterwards fails.
+	Close() error
+}
+
+/*
+A subscription to a topic of a Broker.
+*/
+type BrokerSubscription interface {
+	//Stops the delivery of payloads to the subscription's handler.
+	Close() error
+}
+
+type brokerRoute struct {
+	broker   Broker
+	patterns []string
+}
+
+/*
+Makes the Topics with names matching any of the patterns (as understood by path.Match) use
+the Broker: their events are encoded with the Topic's Codec (see WithCodec) and published to
+the Broker, and the Topic's Subscribers receive the events coming from the Broker.
+Standard, retained and replay Topics are delegated, other kinds of Topics and gates are not.
+The first matching Broker is used, if several are given.
+*/
+func WithBroker(broker Broker, patterns ...string) FactoryOption {
+	return func(t *factory) {
+		t.brokers = append(t.brokers, brokerRoute{broker, patterns})
+	}
+}
+
+/*
+Invoked for failures which can't be returned to the caller, e.g. events a Broker failed to publish,
+or Subscribers which panicked (the Factory recovers from their panics, and carries on).
+*/
+func WithErrorHandler(handler func(error)) FactoryOption {
+	return func(t *factory) {
+		t.errorHandler = handler
+	}
+}
+
+func (t *factory) reportError(err error) {
+	t.log(LevelError, err.Error())
+	if t.errorHandler != nil {
+		t.errorHandler(err)
+	}
+}
+
+func (t *factory) brokerFor(topicName string) Broker {
+	for _, route := range t.brokers {
+		for _, pattern := range route.patterns {
+			if matches, _ := path.Match(pattern, topicName); matches {
+				return route.broker
+			}
+		}
+	}
+	return nil
+}
+
+/*
+A Topic delegated to a Broker. Events from the Broker go through the factory's go-routine,
+like the events of any other Topic, hence offsets, history and gates work as usual.
+*/
+type brokerTopic struct {
+	*simpleTopic
+	broker       Broker
+	codec        Codec
+	subscription BrokerSubscription
+}
+
+func newBrokerTopic(topic *simpleTopic, broker Broker) *brokerTopic {
+	return &brokerTopic{simpleTopic: topic, broker: broker, codec: topic.p.CodecFor(topic.name)}
+}
+
+//starts receiving the events of the Broker, once the Topic is registered
+func (t *brokerTopic) subscribe() {
+	subscription, err := t.broker.Subscribe(t.name, func(payload []byte) {
+		event, err := t.codec.Decode(payload)
+		if err != nil {
+			t.p.reportError(err)
+			return
+		}
+		t.p.send(&eventSpec{t.name, event, 0, nil, SpanContext{}})
+	})
+	if err != nil {
+		t.p.reportError(err)
+		return
+	}
+	t.subscription = subscription
+}
+
+func (t *brokerTopic) NewPublisher() Publisher {
+	publisher := func(event interface{}) {
+		t.publish(event)
+	}
+	return publisher
+}
+
+//events bridged into the Topic go through the Broker as well, without their hops
+func (t *brokerTopic) publishHops(event interface{}, hops []string) {
+	t.publish(event)
+}
+
+//spans end at the Broker, as SpanContexts aren't part of the payloads
+func (t *brokerTopic) publish(event interface{}) {
+	t.p.publish(t.name, event, func(event interface{}, _ SpanContext) {
+		//counted as queued until the Broker took it, so that Shutdown waits for it
+		atomic.AddInt32(&t.p.queued, 1)
+		t.p.spawn(func() {
+			defer t.p.settle(&t.p.queued, 1)
+			payload, err := t.codec.Encode(event)
+			if err == nil {
+				err = t.broker.Publish(t.name, payload)
+			}
+			if err != nil {
+				t.p.reportError(err)
+			}
+		})
+	})
+}
+
+//Closing the Topic ends its subscription, the Broker itself stays open.
+func (t *brokerTopic) Close() error {
+	return t.p.closeTopic(t)
+}
+
+func (t *brokerTopic) detach(state *factory) func() error {
+	if !t.markDetached() {
+		return nil
+	}
+	state.removeTopic(t)
+	return func() error {
+		var err error
+		if t.subscription != nil {
+			err = t.subscription.Close()
+		}
+		t.signalClosed()
+		return err
+	}
+}
+
+/*
+Returns a Broker backed by a Factory of this package, for running Topics in-process behind
+the Broker interface (e.g. in tests of code written against other Brokers).
+As the Broker interface requires, payloads published to a topic nobody is subscribed to are dropped.
+*/
+func NewInProcessBroker() Broker {
+	return &inProcessBroker{factory: NewFactory()}
+}
+
+type inProcessBroker struct {
+	factory Factory
+	//guards the fields below, and the creation of topics
+	lock   sync.Mutex
+	closed bool
+}
+
+type inProcessSubscription struct {
+	subscription *Subscription
+	lock         sync.Mutex
+	closed       bool
+}
+
+func (b *inProcessBroker) topic(topicName string) (Topic, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.closed {
+		return nil, errors.New("The broker is closed")
+	}
+	if topic, exists := b.factory.Lookup(topicName); exists {
+		return topic, nil
+	}
+	return b.factory.NewTopic(topicName), nil
+}
+
+func (b *inProcessBroker) Publish(topicName string, payload []byte) error {
+	topic, err := b.topic(topicName)
+	if err != nil {
+		return err
+	}
+	topic.NewPublisher()(append([]byte{}, payload...))
+	return nil
+}
+
+func (b *inProcessBroker) Subscribe(topicName string, handler func(payload []byte)) (BrokerSubscription, error) {
+	topic, err := b.topic(topicName)
+	if err != nil {
+		return nil, err
+	}
+	subscription := &inProcessSubscription{subscription: NewSubscription()}
+	topic.NewSubscriber(func(event interface{}) {
+		subscription.lock.Lock()
+		closed := subscription.closed
+		subscription.lock.Unlock()
+		if !closed {
+			handler(append([]byte{}, event.([]byte)...))
+		}
+	}, WithSubscription(subscription.subscription))
+	return subscription, nil
+}
+
+func (b *inProcessBroker) Close() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	return b.factory.Close()
+}
+
+//payloads dispatched before the Subscriber is removed are not handed to the handler anymore
+func (s *inProcessSubscription) Close() error {
+	s.lock.Lock()
+	s.closed = true
+	s.lock.Unlock()
+	s.subscription.Unsubscribe()
+	return nil
+}
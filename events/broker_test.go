@@ -0,0 +1,81 @@
+package events
+
+import (
+	"github.com/tholowka/testing/assertions"
+	"testing"
+)
+
+func TestThat_Factories_SharingABroker_ShareItsTopics(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	broker := NewInProcessBroker()
+	defer broker.Close()
+	first := NewFactory(WithBroker(broker, "shared.*"))
+	second := NewFactory(WithBroker(broker, "shared.*"))
+	received := make(chan interface{})
+	second.NewTopic("shared.orders", func(event interface{}) {
+		received <- event
+	})
+	//when
+	first.NewTopic("shared.orders").NewPublisher()("order")
+	//then
+	assert.AreEqual("order", <-received)
+}
+
+func TestThat_BrokerTopics_KeepTheirHistory(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	broker := NewInProcessBroker()
+	defer broker.Close()
+	topic := NewFactory(WithBroker(broker, "*")).NewReplayTopic("orders", 10)
+	received := make(chan *Envelope)
+	topic.NewSubscriber(func(event interface{}) {
+		received <- event.(*Envelope)
+	}, WithEnvelope())
+	publisher := topic.NewPublisher()
+	publisher("one")
+	<-received
+	publisher("two")
+	<-received
+	//when
+	topic.NewSubscriber(func(event interface{}) {
+		received <- event.(*Envelope)
+	}, FromOffset(1), WithEnvelope())
+	//then
+	replayed := <-received
+	assert.AreEqual("two", replayed.Event)
+	assert.AreEqual(uint64(1), replayed.Offset)
+}
+
+func TestThat_OnlyMatchingTopics_AreDelegated(t *testing.T) {
+	assert := assertions.New(t)
+	f := NewFactory(WithBroker(NewInProcessBroker(), "remote.*"))
+	_, delegated := f.NewTopic("remote.orders").(*brokerTopic)
+	assert.IsTrue(delegated)
+	_, delegated = f.NewTopic("orders").(*brokerTopic)
+	assert.IsTrue(!delegated)
+}
+
+func TestThat_BrokerTopics_ReportEventsWhichCantBeEncoded(t *testing.T) {
+	assert := assertions.New(t)
+	failures := make(chan error)
+	f := NewFactory(WithBroker(NewInProcessBroker(), "*"), WithErrorHandler(func(err error) {
+		failures <- err
+	}))
+	f.NewTopic("orders").NewPublisher()(func() {})
+	assert.IsTrue(<-failures != nil)
+}
+
+func TestThat_InProcessBroker_RemovesTheSubscribers_OfClosedSubscriptions(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	broker := NewInProcessBroker()
+	defer broker.Close()
+	subscription, _ := broker.Subscribe("orders", func([]byte) {})
+	factory := broker.(*inProcessBroker).factory
+	assert.AreEqual(1, factory.Describe().Topics[0].Subscribers)
+	//when
+	subscription.Close()
+	//then
+	assert.AreEqual(0, factory.Describe().Topics[0].Subscribers)
+}
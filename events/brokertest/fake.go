@@ -0,0 +1,81 @@
+package brokertest
+
+import (
+	"errors"
+	"github.com/tholowka/pub-sub/events"
+	"sync"
+)
+
+/*
+A Broker keeping everything in memory, which records the payloads published to it.
+Payloads are delivered to the subscriptions in go-routines of their own, as external Brokers would.
+*/
+type Fake struct {
+	lock          sync.Mutex
+	closed        bool
+	subscriptions map[string][]*fakeSubscription
+	published     map[string][][]byte
+}
+
+type fakeSubscription struct {
+	fake    *Fake
+	topic   string
+	handler func([]byte)
+}
+
+func NewFake() *Fake {
+	return &Fake{subscriptions: map[string][]*fakeSubscription{}, published: map[string][][]byte{}}
+}
+
+func (f *Fake) Publish(topic string, payload []byte) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.closed {
+		return errors.New("The fake broker is closed")
+	}
+	copied := append([]byte{}, payload...)
+	f.published[topic] = append(f.published[topic], copied)
+	for _, subscription := range f.subscriptions[topic] {
+		go subscription.handler(append([]byte{}, copied...))
+	}
+	return nil
+}
+
+func (f *Fake) Subscribe(topic string, handler func([]byte)) (events.BrokerSubscription, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.closed {
+		return nil, errors.New("The fake broker is closed")
+	}
+	subscription := &fakeSubscription{f, topic, handler}
+	f.subscriptions[topic] = append(f.subscriptions[topic], subscription)
+	return subscription, nil
+}
+
+func (f *Fake) Close() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.closed = true
+	f.subscriptions = map[string][]*fakeSubscription{}
+	return nil
+}
+
+//Returns the payloads published to the topic so far.
+func (f *Fake) Published(topic string) [][]byte {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return append([][]byte{}, f.published[topic]...)
+}
+
+func (s *fakeSubscription) Close() error {
+	s.fake.lock.Lock()
+	defer s.fake.lock.Unlock()
+	subscriptions := s.fake.subscriptions[s.topic]
+	for i, subscription := range subscriptions {
+		if subscription == s {
+			s.fake.subscriptions[s.topic] = append(subscriptions[:i:i], subscriptions[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
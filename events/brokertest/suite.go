@@ -0,0 +1,171 @@
+/*
+Helps testing drivers of message brokers (see events.Broker). Run is the conformance suite every
+driver has to pass; Fake is an in-memory Broker, for testing code which uses Brokers.
+
+A driver's test would typically read:
+
+	func TestThat_MyBroker_Conforms(t *testing.T) {
+		brokertest.Run(t, func() events.Broker {
+			return mybroker.New(...)
+		})
+	}
+*/
+package brokertest
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/tholowka/pub-sub/events"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+//how long deliveries are waited for, and how long the absence of deliveries is checked for
+const (
+	deliveryTimeout = 5 * time.Second
+	quietPeriod     = 100 * time.Millisecond
+)
+
+//the number of suites run so far, to keep the topics of subsequent runs apart
+var runs uint64
+
+/*
+Runs the conformance suite against Brokers returned by newBroker, a fresh one for every test.
+Topics are named uniquely per test, so that Brokers backed by shared infrastructure can be tested.
+*/
+func Run(t *testing.T, newBroker func() events.Broker) {
+	run := atomic.AddUint64(&runs, 1)
+	tests := []struct {
+		name string
+		test func(*testing.T, events.Broker, func(string) string)
+	}{
+		{"DeliversPayloads_ToSubscriptions", deliversPayloads},
+		{"DeliversPayloads_ToEverySubscription", deliversToEverySubscription},
+		{"KeepsTopicsApart", keepsTopicsApart},
+		{"StopsDelivering_ToClosedSubscriptions", stopsDeliveringToClosedSubscriptions},
+		{"CopiesPayloads", copiesPayloads},
+		{"FailsToPublish_WhenClosed", failsToPublishWhenClosed},
+		{"BacksFactoryTopics", backsFactoryTopics},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			broker := newBroker()
+			defer broker.Close()
+			topicName := func(name string) string {
+				return fmt.Sprintf("conformance-%v-%v-%v", run, test.name, name)
+			}
+			test.test(t, broker, topicName)
+		})
+	}
+}
+
+func subscribe(t *testing.T, broker events.Broker, topicName string) (events.BrokerSubscription, chan []byte) {
+	received := make(chan []byte, 16)
+	subscription, err := broker.Subscribe(topicName, func(payload []byte) {
+		received <- payload
+	})
+	if err != nil {
+		t.Fatalf("Subscribing failed: %v", err)
+	}
+	return subscription, received
+}
+
+func publish(t *testing.T, broker events.Broker, topicName string, payload string) {
+	if err := broker.Publish(topicName, []byte(payload)); err != nil {
+		t.Fatalf("Publishing failed: %v", err)
+	}
+}
+
+func expect(t *testing.T, received chan []byte, expected string) {
+	select {
+	case payload := <-received:
+		if !bytes.Equal([]byte(expected), payload) {
+			t.Fatalf("expected %q, got %q", expected, payload)
+		}
+	case <-time.After(deliveryTimeout):
+		t.Fatalf("%q was not delivered", expected)
+	}
+}
+
+func expectNothing(t *testing.T, received chan []byte) {
+	select {
+	case payload := <-received:
+		t.Fatalf("expected nothing, got %q", payload)
+	case <-time.After(quietPeriod):
+	}
+}
+
+func deliversPayloads(t *testing.T, broker events.Broker, topicName func(string) string) {
+	_, received := subscribe(t, broker, topicName("orders"))
+	publish(t, broker, topicName("orders"), "order")
+	expect(t, received, "order")
+}
+
+func deliversToEverySubscription(t *testing.T, broker events.Broker, topicName func(string) string) {
+	_, first := subscribe(t, broker, topicName("orders"))
+	_, second := subscribe(t, broker, topicName("orders"))
+	publish(t, broker, topicName("orders"), "order")
+	expect(t, first, "order")
+	expect(t, second, "order")
+}
+
+func keepsTopicsApart(t *testing.T, broker events.Broker, topicName func(string) string) {
+	_, orders := subscribe(t, broker, topicName("orders"))
+	_, payments := subscribe(t, broker, topicName("payments"))
+	publish(t, broker, topicName("payments"), "payment")
+	expect(t, payments, "payment")
+	publish(t, broker, topicName("orders"), "order")
+	expect(t, orders, "order")
+	expectNothing(t, orders)
+	expectNothing(t, payments)
+}
+
+func stopsDeliveringToClosedSubscriptions(t *testing.T, broker events.Broker, topicName func(string) string) {
+	closed, stopped := subscribe(t, broker, topicName("orders"))
+	_, open := subscribe(t, broker, topicName("orders"))
+	if err := closed.Close(); err != nil {
+		t.Fatalf("Closing the subscription failed: %v", err)
+	}
+	publish(t, broker, topicName("orders"), "order")
+	expect(t, open, "order")
+	expectNothing(t, stopped)
+}
+
+func copiesPayloads(t *testing.T, broker events.Broker, topicName func(string) string) {
+	_, received := subscribe(t, broker, topicName("orders"))
+	payload := []byte("order")
+	if err := broker.Publish(topicName("orders"), payload); err != nil {
+		t.Fatalf("Publishing failed: %v", err)
+	}
+	copy(payload, "xxxxx")
+	expect(t, received, "order")
+}
+
+func failsToPublishWhenClosed(t *testing.T, broker events.Broker, topicName func(string) string) {
+	if err := broker.Close(); err != nil {
+		t.Fatalf("Closing the broker failed: %v", err)
+	}
+	if err := broker.Publish(topicName("orders"), []byte("order")); err == nil {
+		t.Fatal("Publishing to a closed broker succeeded")
+	}
+}
+
+func backsFactoryTopics(t *testing.T, broker events.Broker, topicName func(string) string) {
+	factory := events.NewFactory(events.WithBroker(broker, topicName("*")))
+	defer factory.Close()
+	received := make(chan interface{}, 1)
+	topic := factory.NewTopic(topicName("orders"), func(event interface{}) {
+		received <- event
+	})
+	topic.NewPublisher()("order")
+	select {
+	case event := <-received:
+		if event != "order" {
+			t.Fatalf("expected %q, got %v", "order", event)
+		}
+	case <-time.After(deliveryTimeout):
+		t.Fatal("The event published through the factory was not delivered")
+	}
+}
@@ -0,0 +1,29 @@
+package brokertest
+
+import (
+	"github.com/tholowka/pub-sub/events"
+	"github.com/tholowka/testing/assertions"
+	"testing"
+	"time"
+)
+
+func TestThat_InProcessBroker_Conforms(t *testing.T) {
+	Run(t, events.NewInProcessBroker)
+}
+
+func TestThat_Fake_Conforms(t *testing.T) {
+	Run(t, func() events.Broker {
+		return NewFake()
+	})
+}
+
+func TestThat_Fake_RecordsPublishedPayloads(t *testing.T) {
+	assert := assertions.New(t)
+	fake := NewFake()
+	factory := events.NewFactory(events.WithBroker(fake, "orders"))
+	factory.NewTopic("orders").NewPublisher()(map[string]int{"id": 42})
+	for len(fake.Published("orders")) == 0 {
+		<-time.After(time.Millisecond)
+	}
+	assert.AreEqual(`{"id":42}`, string(fake.Published("orders")[0]))
+}
@@ -0,0 +1,617 @@
+/*
+Implements the events.Factory and events.Topic interfaces on top of a Factory served by
+another process (see events/server). Topics created and subscribed to through a Client live
+in the remote Factory; Subscribers and Publishers stay in the calling process.
+
+When the connection is lost, the Client reconnects with a growing delay and re-creates its
+Topics and subscriptions. Publishing blocks (in the Publisher's own go-routine) until the
+connection is back, but events sent just before the connection drops may be lost with it.
+Subscribers of Topics keeping a history (see Factory.NewReplayTopic) resume after the last
+event they received, as long as the server was not restarted.
+*/
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/tholowka/pub-sub/events"
+	"github.com/tholowka/pub-sub/events/server"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMinReconnectDelay = 100 * time.Millisecond
+	defaultMaxReconnectDelay = 10 * time.Second
+)
+
+var (
+	errClosed         = errors.New("The client is closed")
+	errConnectionLost = errors.New("The connection was lost")
+)
+
+/*
+A Factory whose Topics live in a remote Factory. Create it with Dial.
+*/
+type Client struct {
+	network           string
+	address           string
+	codecs            map[string]events.Codec
+	errorHandler      func(error)
+	minReconnectDelay time.Duration
+	maxReconnectDelay time.Duration
+	//held by requests which change what has to be restored after reconnecting,
+	//and exclusively while restoring it
+	restoring sync.RWMutex
+	//guards the fields below
+	lock             sync.Mutex
+	current          *link
+	ready            chan bool
+	closed           bool
+	done             chan bool
+	session          string
+	topics           []*remoteTopic
+	subscriptions    map[uint64]*subscription
+	nextSubscription uint64
+}
+
+var _ events.Factory = &Client{}
+
+/*
+Customizes a Client at construction time, see Dial.
+*/
+type Option func(*Client)
+
+/*
+Makes the Client encode and decode the events of the Topic with the given name using the Codec.
+The server has to use a Codec with the same name for that Topic. Topics firing Ticks decode
+them into events.Tick values by default, others use events.NewJSONCodec(nil).
+*/
+func WithCodec(topicName string, codec events.Codec) Option {
+	return func(c *Client) {
+		c.codecs[topicName] = codec
+	}
+}
+
+/*
+Invoked for failures which can't be returned to the caller, e.g. events which can't be
+encoded or decoded, lost connections, or subscriptions which can't be restored.
+*/
+func WithErrorHandler(handler func(error)) Option {
+	return func(c *Client) {
+		c.errorHandler = handler
+	}
+}
+
+/*
+Sets the delay before the first attempt to reconnect, doubled after every failed attempt up to the maximum.
+100ms and 10s by default.
+*/
+func WithReconnectDelay(min time.Duration, max time.Duration) Option {
+	return func(c *Client) {
+		c.minReconnectDelay = min
+		c.maxReconnectDelay = max
+	}
+}
+
+/*
+Connects to a server on the given network ('tcp', 'unix'...) and address.
+Fails if the first attempt to connect fails, later ones are retried until the Client is closed.
+*/
+func Dial(network string, address string, options ...Option) (*Client, error) {
+	client := &Client{
+		network:           network,
+		address:           address,
+		codecs:            map[string]events.Codec{},
+		minReconnectDelay: defaultMinReconnectDelay,
+		maxReconnectDelay: defaultMaxReconnectDelay,
+		ready:             make(chan bool),
+		done:              make(chan bool),
+		subscriptions:     map[uint64]*subscription{},
+	}
+	for _, option := range options {
+		option(client)
+	}
+	link, err := client.connect()
+	if err != nil {
+		return nil, err
+	}
+	client.lock.Lock()
+	client.session = link.session
+	client.current = link
+	close(client.ready)
+	client.lock.Unlock()
+	go client.watch(link)
+	return client, nil
+}
+
+//Returns the Codec registered for the Topic (see WithCodec), regardless of whether it fires Ticks.
+func (c *Client) CodecFor(topicName string) events.Codec {
+	return c.codecFor(topicName, false)
+}
+
+func (c *Client) codecFor(topicName string, ticks bool) events.Codec {
+	if codec, exists := c.codecs[topicName]; exists {
+		return codec
+	}
+	if ticks {
+		return events.NewJSONCodec(events.Tick{})
+	}
+	return events.NewJSONCodec(nil)
+}
+
+func (c *Client) reportError(err error) {
+	if c.errorHandler != nil {
+		c.errorHandler(err)
+	}
+}
+
+//dials the server and waits for its hello
+func (c *Client) connect() (*link, error) {
+	conn, err := net.Dial(c.network, c.address)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(conn)
+	hello := &server.Frame{}
+	if err = decoder.Decode(hello); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if hello.Op != server.OpHello {
+		conn.Close()
+		return nil, fmt.Errorf("Expected a hello from the server, got '%v'", hello.Op)
+	}
+	link := newLink(conn, hello.Session)
+	go link.read(decoder, c.dispatch)
+	return link, nil
+}
+
+//waits for the connection to be lost, then reconnects until the Client is closed
+func (c *Client) watch(current *link) {
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-current.lost:
+		}
+		c.lock.Lock()
+		c.current = nil
+		c.ready = make(chan bool)
+		c.lock.Unlock()
+		c.reportError(errConnectionLost)
+		delay := c.minReconnectDelay
+		for {
+			select {
+			case <-c.done:
+				return
+			case <-time.After(delay):
+			}
+			link, err := c.connect()
+			if err == nil {
+				if err = c.restore(link); err == nil {
+					current = link
+					break
+				}
+				link.close()
+			}
+			c.reportError(err)
+			if delay *= 2; delay > c.maxReconnectDelay {
+				delay = c.maxReconnectDelay
+			}
+		}
+	}
+}
+
+//re-creates the Topics and subscriptions on a new connection, then makes it the current one
+func (c *Client) restore(link *link) error {
+	c.restoring.Lock()
+	defer c.restoring.Unlock()
+	c.lock.Lock()
+	sameSession := link.session == c.session
+	topics := append([]*remoteTopic{}, c.topics...)
+	subscriptions := subscriptionsById{}
+	for _, subscription := range c.subscriptions {
+		subscriptions = append(subscriptions, subscription)
+	}
+	c.lock.Unlock()
+	sort.Sort(subscriptions)
+	for _, topic := range topics {
+		for i, frame := range topic.creation() {
+			reply, err := link.request(frame)
+			if err == errConnectionLost {
+				return err
+			} else if err != nil {
+				c.reportError(err)
+				break
+			}
+			if i == 0 {
+				topic.created(reply)
+			}
+		}
+	}
+	for _, subscription := range subscriptions {
+		_, err := link.request(subscription.frame(sameSession))
+		if err == errConnectionLost {
+			return err
+		} else if err != nil {
+			c.reportError(err)
+		}
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.closed {
+		return errClosed
+	}
+	c.session = link.session
+	c.current = link
+	close(c.ready)
+	return nil
+}
+
+//returns the current connection, waiting for one if needed
+func (c *Client) awaitLink() (*link, error) {
+	for {
+		c.lock.Lock()
+		current, ready, closed := c.current, c.ready, c.closed
+		c.lock.Unlock()
+		if closed {
+			return nil, errClosed
+		}
+		if current != nil {
+			return current, nil
+		}
+		select {
+		case <-ready:
+		case <-c.done:
+		}
+	}
+}
+
+//sends a request, retrying it on a new connection if the connection is lost meanwhile
+func (c *Client) request(frame *server.Frame) (*server.Frame, error) {
+	for {
+		link, err := c.awaitLink()
+		if err != nil {
+			return nil, err
+		}
+		reply, err := link.request(frame)
+		if err != errConnectionLost {
+			return reply, err
+		}
+	}
+}
+
+//sends a frame which needs no reply, retrying it on a new connection if it can't be sent
+func (c *Client) send(frame *server.Frame) error {
+	for {
+		link, err := c.awaitLink()
+		if err != nil {
+			return err
+		}
+		if err = link.send(frame); err == nil {
+			return nil
+		}
+	}
+}
+
+/*
+Records a change to be restored after reconnecting, then sends the request making it.
+If the connection is lost before the reply, the change is left to the restoring.
+Returns false in that case, as there's no reply.
+*/
+func (c *Client) apply(frame func() *server.Frame, record func()) (*server.Frame, bool, error) {
+	for {
+		link, err := c.awaitLink()
+		if err != nil {
+			return nil, false, err
+		}
+		c.restoring.RLock()
+		if link.isLost() {
+			c.restoring.RUnlock()
+			continue
+		}
+		record()
+		reply, err := link.request(frame())
+		c.restoring.RUnlock()
+		if err == errConnectionLost {
+			return nil, false, nil
+		}
+		return reply, true, err
+	}
+}
+
+func (c *Client) dispatch(frame *server.Frame) {
+	if frame.Op != server.OpEvent {
+		return
+	}
+	c.lock.Lock()
+	subscription, exists := c.subscriptions[frame.Subscription]
+	c.lock.Unlock()
+	if exists {
+		subscription.deliver(frame)
+	}
+}
+
+func (c *Client) NewTopic(topicName string, subscribers ...events.Subscriber) events.Topic {
+	return c.newTopic(&server.Frame{Op: server.OpCreate, Topic: topicName, Kind: server.KindTopic}, subscribers)
+}
+
+func (c *Client) NewRetainedTopic(topicName string, retain int, subscribers ...events.Subscriber) events.Topic {
+	return c.newTopic(&server.Frame{Op: server.OpCreate, Topic: topicName, Kind: server.KindRetained, Capacity: retain}, subscribers)
+}
+
+func (c *Client) NewReplayTopic(topicName string, capacity int, subscribers ...events.Subscriber) events.Topic {
+	return c.newTopic(&server.Frame{Op: server.OpCreate, Topic: topicName, Kind: server.KindReplay, Capacity: capacity}, subscribers)
+}
+
+//Persistent topics keep their log on the server's disk, hence they can only be created there.
+func (c *Client) NewPersistentTopic(topicName string, options events.PersistenceOptions, subscribers ...events.Subscriber) (events.DurableTopic, error) {
+	return nil, errors.New("Persistent topics can't be created over the network, create them in the server's Factory")
+}
+
+func (c *Client) NewTickerTopic(topicName string, interval time.Duration, options ...events.TickerOption) events.TickerTopic {
+	topic := &tickerTopic{remoteTopic: c.newRemoteTopic(topicName, server.KindTicker), interval: interval, settings: events.ReadTickerOptions(options...)}
+	topic.remoteTopic.creation = topic.creation
+	topic.create(nil)
+	return topic
+}
+
+func (c *Client) NewScheduleTopic(topicName string, expression string) (events.Topic, error) {
+	topic := c.newRemoteTopic(topicName, server.KindSchedule)
+	topic.frame = &server.Frame{Op: server.OpCreate, Topic: topicName, Kind: server.KindSchedule, Expression: expression}
+	if err := topic.create(nil); err != nil {
+		return nil, err
+	}
+	return topic, nil
+}
+
+func (c *Client) NewTimerTopic(topicName string, at time.Time) events.Topic {
+	topic := c.newRemoteTopic(topicName, server.KindTimer)
+	topic.frame = &server.Frame{Op: server.OpCreate, Topic: topicName, Kind: server.KindTimer, At: at.UnixNano()}
+	topic.create(nil)
+	return topic
+}
+
+func (c *Client) NewJitteredTickerTopic(topicName string, interval time.Duration, jitter time.Duration) (events.Topic, error) {
+	topic := c.newRemoteTopic(topicName, server.KindJittered)
+	topic.frame = &server.Frame{Op: server.OpCreate, Topic: topicName, Kind: server.KindJittered, Interval: int64(interval), Jitter: int64(jitter)}
+	if err := topic.create(nil); err != nil {
+		return nil, err
+	}
+	return topic, nil
+}
+
+func (c *Client) newTopic(frame *server.Frame, subscribers []events.Subscriber) events.Topic {
+	topic := c.newRemoteTopic(frame.Topic, frame.Kind)
+	topic.frame = frame
+	topic.create(subscribers)
+	return topic
+}
+
+func (c *Client) AndGate(topics []events.Topic, subscribers ...events.Subscriber) events.Topic {
+	return c.newGate(server.KindAnd, topics, subscribers)
+}
+
+func (c *Client) OrGate(topics []events.Topic, subscribers ...events.Subscriber) events.Topic {
+	return c.newGate(server.KindOr, topics, subscribers)
+}
+
+//the gate gets its name from the server, which names it anew whenever it's re-created
+func (c *Client) newGate(kind string, topics []events.Topic, subscribers []events.Subscriber) events.Topic {
+	gate := c.newRemoteTopic("", kind)
+	gate.creation = func() []*server.Frame {
+		names := []string{}
+		for _, topic := range topics {
+			names = append(names, topic.String())
+		}
+		return []*server.Frame{{Op: server.OpGate, Kind: kind, Topics: names}}
+	}
+	gate.create(subscribers)
+	return gate
+}
+
+/*
+Closes the Topics this Client created in the remote Factory, then disconnects. Topics which
+existed there already (e.g. created by another client) stay open. Topics are only closed if
+the Client is connected at that time.
+*/
+func (c *Client) Close() error {
+	c.restoring.Lock()
+	c.lock.Lock()
+	if c.closed {
+		c.lock.Unlock()
+		c.restoring.Unlock()
+		return nil
+	}
+	topics, current := c.topics, c.current
+	c.topics = nil
+	c.subscriptions = map[uint64]*subscription{}
+	c.lock.Unlock()
+	c.restoring.Unlock()
+	var err error
+	if current != nil {
+		for _, topic := range topics {
+			if !topic.isOwned() {
+				continue
+			}
+			if _, closeErr := current.request(&server.Frame{Op: server.OpClose, Topic: topic.String()}); err == nil {
+				err = closeErr
+			}
+		}
+	}
+	c.lock.Lock()
+	c.closed = true
+	c.current = nil
+	close(c.done)
+	c.lock.Unlock()
+	if current != nil {
+		current.close()
+	}
+	return err
+}
+
+/*
+Closes the Client like Close. The remote Factory keeps running, so there's nothing to drain on
+this side: events already sent are delivered by it.
+*/
+func (c *Client) Shutdown(ctx context.Context) (events.ShutdownReport, error) {
+	report := events.ShutdownReport{Requeued: map[string]int{}}
+	if err := c.Close(); err != nil {
+		return report, err
+	}
+	return report, ctx.Err()
+}
+
+//Returns a Topic of the remote Factory. It is not re-created after reconnecting.
+func (c *Client) Lookup(topicName string) (events.Topic, bool) {
+	for _, topic := range c.Topics() {
+		if topic.String() == topicName {
+			return topic, true
+		}
+	}
+	return nil, false
+}
+
+//Returns the open Topics of the remote Factory, none if the Client is closed.
+func (c *Client) Topics() []events.Topic {
+	topics := []events.Topic{}
+	reply, err := c.request(&server.Frame{Op: server.OpList})
+	if err != nil {
+		c.reportError(err)
+		return topics
+	}
+	for i, topicName := range reply.Topics {
+		kind := ""
+		if i < len(reply.Kinds) {
+			kind = reply.Kinds[i]
+		}
+		topics = append(topics, c.foundTopic(topicName, kind))
+	}
+	return topics
+}
+
+//Describes the remote Factory, an empty description if the Client is closed.
+func (c *Client) Describe() events.FactoryDescription {
+	reply, err := c.request(&server.Frame{Op: server.OpDescribe})
+	if err != nil || reply.Description == nil {
+		if err != nil {
+			c.reportError(err)
+		}
+		return events.FactoryDescription{Topics: []events.TopicDescription{}}
+	}
+	return *reply.Description
+}
+
+//Returns the graph of the remote Factory, an empty one if the Client is closed.
+func (c *Client) Topology() events.Topology {
+	reply, err := c.request(&server.Frame{Op: server.OpTopology})
+	if err != nil || reply.Topology == nil {
+		if err != nil {
+			c.reportError(err)
+		}
+		return events.Topology{Nodes: []events.TopologyNode{}, Edges: []events.TopologyEdge{}}
+	}
+	return *reply.Topology
+}
+
+/*
+A connection to the server. Replies are matched to requests by their ids.
+*/
+type link struct {
+	conn     net.Conn
+	session  string
+	lost     chan bool
+	lostOnce sync.Once
+	//guards the encoder and the fields below
+	lock    sync.Mutex
+	encoder *json.Encoder
+	nextId  uint64
+	pending map[uint64]chan *server.Frame
+}
+
+func newLink(conn net.Conn, session string) *link {
+	return &link{
+		conn:    conn,
+		session: session,
+		lost:    make(chan bool),
+		encoder: json.NewEncoder(conn),
+		pending: map[uint64]chan *server.Frame{},
+	}
+}
+
+func (l *link) read(decoder *json.Decoder, dispatch func(*server.Frame)) {
+	defer l.close()
+	for {
+		frame := &server.Frame{}
+		if err := decoder.Decode(frame); err != nil {
+			return
+		}
+		if frame.Op != server.OpReply {
+			dispatch(frame)
+			continue
+		}
+		l.lock.Lock()
+		replies, exists := l.pending[frame.Id]
+		delete(l.pending, frame.Id)
+		l.lock.Unlock()
+		if exists {
+			replies <- frame
+		}
+	}
+}
+
+func (l *link) send(frame *server.Frame) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.isLost() {
+		return errConnectionLost
+	}
+	if err := l.encoder.Encode(frame); err != nil {
+		go l.close()
+		return errConnectionLost
+	}
+	return nil
+}
+
+func (l *link) request(frame *server.Frame) (*server.Frame, error) {
+	replies := make(chan *server.Frame, 1)
+	l.lock.Lock()
+	l.nextId++
+	request := *frame
+	request.Id = l.nextId
+	l.pending[request.Id] = replies
+	l.lock.Unlock()
+	if err := l.send(&request); err != nil {
+		return nil, err
+	}
+	select {
+	case reply := <-replies:
+		if reply.Error != "" {
+			return reply, errors.New(reply.Error)
+		}
+		return reply, nil
+	case <-l.lost:
+		return nil, errConnectionLost
+	}
+}
+
+func (l *link) isLost() bool {
+	select {
+	case <-l.lost:
+		return true
+	default:
+		return false
+	}
+}
+
+func (l *link) close() {
+	l.lostOnce.Do(func() {
+		close(l.lost)
+		l.conn.Close()
+	})
+}
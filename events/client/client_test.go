@@ -0,0 +1,297 @@
+package client
+
+import (
+	"github.com/tholowka/pub-sub/events"
+	"github.com/tholowka/pub-sub/events/server"
+	"github.com/tholowka/testing/assertions"
+	"net"
+	"testing"
+	"time"
+)
+
+func serve(factory events.Factory) (*server.Server, string) {
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	served := server.New(factory)
+	go served.Serve(listener)
+	return served, listener.Addr().String()
+}
+
+func waitForLast(topic events.Topic, expected interface{}) {
+	for {
+		if last, _ := topic.Last(); last == expected {
+			return
+		}
+		<-time.After(time.Millisecond)
+	}
+}
+
+func TestThat_Client_PublishesAndSubscribes_ToTheRemoteFactory(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	factory := events.NewFactory()
+	served, address := serve(factory)
+	defer served.Close()
+	client, err := Dial("tcp", address)
+	assert.IsTrue(err == nil)
+	defer client.Close()
+	remoteReceived := make(chan interface{})
+	localReceived := make(chan interface{})
+	topic := client.NewTopic("orders", func(event interface{}) {
+		remoteReceived <- event
+	})
+	local, _ := factory.Lookup("orders")
+	local.NewSubscriber(func(event interface{}) {
+		localReceived <- event
+	})
+	//when
+	topic.NewPublisher()("from the client")
+	//then
+	assert.AreEqual("from the client", <-remoteReceived)
+	assert.AreEqual("from the client", <-localReceived)
+	//when
+	local.NewPublisher()("from the server")
+	//then
+	assert.AreEqual("from the server", <-remoteReceived)
+	assert.AreEqual("from the server", <-localReceived)
+	waitForLast(topic, "from the server")
+}
+
+func TestThat_Client_DecodesEvents_WithTheTopicsCodec(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	type order struct {
+		Id string
+	}
+	factory := events.NewFactory()
+	served, address := serve(factory)
+	defer served.Close()
+	client, _ := Dial("tcp", address, WithCodec("orders", events.NewJSONCodec(&order{})))
+	defer client.Close()
+	received := make(chan *events.Envelope)
+	topic := client.NewReplayTopic("orders", 10)
+	//when
+	topic.NewPublisher()(&order{"42"})
+	local, _ := factory.Lookup("orders")
+	for _, exists := local.Last(); !exists; _, exists = local.Last() {
+		<-time.After(time.Millisecond)
+	}
+	topic.NewSubscriber(func(event interface{}) {
+		received <- event.(*events.Envelope)
+	}, events.FromBeginning(), events.WithEnvelope())
+	//then
+	envelope := <-received
+	assert.AreEqual(&order{"42"}, envelope.Event)
+	assert.AreEqual(uint64(0), envelope.Offset)
+	assert.AreEqual("orders", envelope.Topic)
+}
+
+func TestThat_Client_ReceivesTicks(t *testing.T) {
+	assert := assertions.New(t)
+	served, address := serve(events.NewFactory())
+	defer served.Close()
+	client, _ := Dial("tcp", address)
+	defer client.Close()
+	received := make(chan interface{})
+	ticker := client.NewTickerTopic("ticks", time.Hour)
+	ticker.NewSubscriber(func(event interface{}) {
+		received <- event
+	})
+	ticker.NewPublisher()(nil)
+	tick := (<-received).(events.Tick)
+	assert.IsTrue(tick.Manual)
+	_, err := client.NewScheduleTopic("schedule", "not cron")
+	assert.IsTrue(err != nil)
+}
+
+func TestThat_Client_Resubscribes_AfterReconnecting(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	factory := events.NewFactory()
+	served, address := serve(factory)
+	lost := make(chan bool, 1)
+	client, _ := Dial("tcp", address, WithReconnectDelay(10*time.Millisecond, 100*time.Millisecond), WithErrorHandler(func(err error) {
+		if err == errConnectionLost {
+			lost <- true
+		}
+	}))
+	defer client.Close()
+	received := make(chan interface{})
+	topic := client.NewTopic("orders", func(event interface{}) {
+		received <- event
+	})
+	topic.NewPublisher()("before")
+	assert.AreEqual("before", <-received)
+	//when the server goes away, and another one serves the factory at the same address
+	served.Close()
+	<-lost
+	listener, err := net.Listen("tcp", address)
+	assert.IsTrue(err == nil)
+	served = server.New(factory)
+	go served.Serve(listener)
+	defer served.Close()
+	//then events published meanwhile are sent once reconnected
+	topic.NewPublisher()("after")
+	assert.AreEqual("after", <-received)
+}
+
+func TestThat_Client_ResumesAfterTheLastEvent_WhenReconnectingToTheSameServer(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	factory := events.NewFactory()
+	local := factory.NewReplayTopic("orders", 10)
+	served, address := serve(factory)
+	defer served.Close()
+	lost := make(chan bool, 1)
+	client, _ := Dial("tcp", address, WithReconnectDelay(50*time.Millisecond, time.Second), WithErrorHandler(func(err error) {
+		if err == errConnectionLost {
+			lost <- true
+		}
+	}))
+	defer client.Close()
+	received := make(chan interface{}, 10)
+	topic, _ := client.Lookup("orders")
+	topic.NewSubscriber(func(event interface{}) {
+		received <- event
+	}, events.FromBeginning())
+	local.NewPublisher()("one")
+	assert.AreEqual("one", <-received)
+	//when the connection drops, while an event is published
+	client.lock.Lock()
+	client.current.close()
+	client.lock.Unlock()
+	<-lost
+	local.NewPublisher()("two")
+	waitForLast(local, "two")
+	//then only the missed event is replayed
+	assert.AreEqual("two", <-received)
+	local.NewPublisher()("three")
+	assert.AreEqual("three", <-received)
+	assert.AreEqual(0, len(received))
+}
+
+func TestThat_Client_ReportsPersistentTopics_AsUnsupported(t *testing.T) {
+	assert := assertions.New(t)
+	served, address := serve(events.NewFactory())
+	defer served.Close()
+	client, _ := Dial("tcp", address)
+	defer client.Close()
+	topic, err := client.NewPersistentTopic("invoices", events.PersistenceOptions{})
+	assert.IsTrue(topic == nil)
+	assert.IsTrue(err != nil)
+}
+
+func TestThat_Client_ClosesItsTopics_WhenClosed(t *testing.T) {
+	assert := assertions.New(t)
+	factory := events.NewFactory()
+	served, address := serve(factory)
+	defer served.Close()
+	client, _ := Dial("tcp", address)
+	client.NewTopic("orders")
+	_, exists := factory.Lookup("orders")
+	assert.IsTrue(exists)
+	client.Close()
+	_, exists = factory.Lookup("orders")
+	assert.IsTrue(!exists)
+}
+
+func TestThat_Client_DescribesTheRemoteFactory(t *testing.T) {
+	assert := assertions.New(t)
+	factory := events.NewFactory()
+	served, address := serve(factory)
+	defer served.Close()
+	client, _ := Dial("tcp", address)
+	defer client.Close()
+	client.NewReplayTopic("orders", 3, func(interface{}) {})
+	description := client.Describe()
+	assert.AreEqual(factory.Describe().Id, description.Id)
+	assert.AreEqual([]events.TopicDescription{{Name: "orders", Kind: "replay", Subscribers: 1, Capacity: 3}}, description.Topics)
+}
+
+func TestThat_Client_ReturnsTheTopologyOfTheRemoteFactory(t *testing.T) {
+	assert := assertions.New(t)
+	factory := events.NewFactory()
+	served, address := serve(factory)
+	defer served.Close()
+	client, _ := Dial("tcp", address)
+	defer client.Close()
+	orders := client.NewTopic("orders")
+	client.OrGate([]events.Topic{orders})
+	assert.AreEqual(factory.Topology(), client.Topology())
+	assert.AreEqual(1, len(client.Topology().Edges))
+}
+
+func TestThat_RemoteTopics_SignalClosing(t *testing.T) {
+	assert := assertions.New(t)
+	served, address := serve(events.NewFactory())
+	defer served.Close()
+	client, _ := Dial("tcp", address)
+	orders, payments := client.NewTopic("orders"), client.NewTopic("payments")
+	listed, _ := client.Lookup("payments")
+	orders.Close()
+	<-orders.Closed()
+	select {
+	case <-payments.Closed():
+		t.Fatal("payments is closed already")
+	default:
+	}
+	client.Close()
+	for _, topic := range []events.Topic{payments, listed} {
+		select {
+		case <-topic.Closed():
+		case <-time.After(5 * time.Second):
+			assert.IsTrue(false)
+		}
+	}
+}
+
+func TestThat_Client_LeavesTopicsItDidntCreate_OpenWhenClosed(t *testing.T) {
+	assert := assertions.New(t)
+	factory := events.NewFactory()
+	factory.NewTopic("orders")
+	served, address := serve(factory)
+	defer served.Close()
+	client, _ := Dial("tcp", address)
+	client.NewTopic("orders")
+	client.Close()
+	_, exists := factory.Lookup("orders")
+	assert.IsTrue(exists)
+}
+
+func TestThat_Client_SendsTickerOptions(t *testing.T) {
+	assert := assertions.New(t)
+	served, address := serve(events.NewFactory())
+	defer served.Close()
+	client, _ := Dial("tcp", address)
+	defer client.Close()
+	ticks := make(chan interface{})
+	topic := client.NewTickerTopic("ticks", time.Hour, events.TickImmediately())
+	topic.NewSubscriber(func(event interface{}) {
+		ticks <- event
+	})
+	assert.AreEqual(uint64(1), (<-ticks).(events.Tick).Sequence)
+}
+
+func TestThat_Client_FindsTickerTopics_ItDidntCreate(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	factory := events.NewFactory()
+	factory.NewTickerTopic("ticks", time.Hour)
+	served, address := serve(factory)
+	defer served.Close()
+	client, _ := Dial("tcp", address)
+	defer client.Close()
+	received := make(chan interface{})
+	//when
+	topic, exists := client.Lookup("ticks")
+	//then
+	assert.IsTrue(exists)
+	ticker, isTicker := topic.(events.TickerTopic)
+	assert.IsTrue(isTicker)
+	ticker.NewSubscriber(func(event interface{}) {
+		received <- event
+	})
+	ticker.NewPublisher()(nil)
+	tick, isTick := (<-received).(events.Tick)
+	assert.IsTrue(isTick)
+	assert.IsTrue(tick.Manual)
+}
@@ -0,0 +1,346 @@
+package client
+
+import (
+	"fmt"
+	"github.com/tholowka/pub-sub/events"
+	"github.com/tholowka/pub-sub/events/server"
+	"sync"
+	"time"
+)
+
+/*
+A Topic of the remote Factory. Topics created through the Client know how to re-create
+themselves after reconnecting.
+*/
+type remoteTopic struct {
+	client *Client
+	kind   string
+	//the frame creating the Topic, unless it's a gate
+	frame *server.Frame
+	//the frames re-creating the Topic, the reply to the first one may rename it
+	creation func() []*server.Frame
+	//closed with closing, see Closed
+	closed  chan struct{}
+	closing sync.Once
+	watch   sync.Once
+	//guards the fields below
+	lock sync.Mutex
+	name string
+	//true once the remote Factory created the Topic for this Client, rather than finding it there
+	owned bool
+}
+
+func (c *Client) newRemoteTopic(topicName string, kind string) *remoteTopic {
+	topic := &remoteTopic{client: c, kind: kind, name: topicName, closed: make(chan struct{})}
+	topic.creation = func() []*server.Frame {
+		return []*server.Frame{topic.frame}
+	}
+	return topic
+}
+
+//a Topic the remote Factory had already, which the Client doesn't re-create after reconnecting
+func (c *Client) foundTopic(topicName string, kind string) events.Topic {
+	topic := c.newRemoteTopic(topicName, kind)
+	if kind == server.KindTicker {
+		return &tickerTopic{remoteTopic: topic}
+	}
+	return topic
+}
+
+//creates the Topic in the remote Factory, and registers the Subscribers
+func (t *remoteTopic) create(subscribers []events.Subscriber) error {
+	c := t.client
+	creation := func() *server.Frame {
+		return t.creation()[0]
+	}
+	reply, replied, err := c.apply(creation, func() {
+		c.lock.Lock()
+		c.topics = append(c.topics, t)
+		c.lock.Unlock()
+	})
+	if err != nil {
+		c.forgetTopic(t)
+		c.reportError(err)
+		return err
+	}
+	if replied {
+		t.created(reply)
+	}
+	for _, subscriber := range subscribers {
+		t.NewSubscriber(subscriber)
+	}
+	return nil
+}
+
+func (t *remoteTopic) created(reply *server.Frame) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if reply.Topic != "" {
+		t.name = reply.Topic
+	}
+	//re-creating an owned Topic after reconnecting finds it there, unless the server restarted
+	t.owned = t.owned || !reply.Exists
+}
+
+func (t *remoteTopic) isOwned() bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.owned
+}
+
+func (c *Client) forgetTopic(topic *remoteTopic) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for i, created := range c.topics {
+		if created == topic {
+			c.topics = append(c.topics[:i], c.topics[i+1:]...)
+			break
+		}
+	}
+	for id, subscription := range c.subscriptions {
+		if subscription.topic == topic {
+			delete(c.subscriptions, id)
+		}
+	}
+}
+
+func (t *remoteTopic) String() string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.name
+}
+
+//Topics firing Ticks decode their events into events.Tick by default
+func (t *remoteTopic) firesTicks() bool {
+	switch t.kind {
+	case server.KindTicker, server.KindSchedule, server.KindTimer, server.KindJittered:
+		return true
+	}
+	return false
+}
+
+func (t *remoteTopic) codec() events.Codec {
+	return t.client.codecFor(t.String(), t.firesTicks())
+}
+
+//Publishing to a Topic firing Ticks sends no event, as it injects a manual Tick anyway.
+func (t *remoteTopic) NewPublisher() events.Publisher {
+	publisher := func(event interface{}) {
+		go func() {
+			frame := &server.Frame{Op: server.OpPublish, Topic: t.String()}
+			if !t.firesTicks() {
+				codec := t.codec()
+				payload, err := codec.Encode(event)
+				if err != nil {
+					t.client.reportError(err)
+					return
+				}
+				frame.Codec, frame.Payload = codec.Name(), payload
+			}
+			if err := t.client.send(frame); err != nil {
+				t.client.reportError(err)
+			}
+		}()
+	}
+	return publisher
+}
+
+//Durable subscriptions (see events.ManualAck) and events.WithSubscription are not supported, the options are ignored then.
+func (t *remoteTopic) NewSubscriber(subscriber events.Subscriber, options ...events.SubscribeOption) {
+	if subscriber == nil {
+		return
+	}
+	c := t.client
+	subscription := &subscription{topic: t, subscriber: subscriber, settings: events.ReadSubscribeOptions(options...)}
+	frame := func() *server.Frame {
+		return subscription.frame(true)
+	}
+	_, _, err := c.apply(frame, func() {
+		c.lock.Lock()
+		c.nextSubscription++
+		subscription.id = c.nextSubscription
+		c.subscriptions[subscription.id] = subscription
+		c.lock.Unlock()
+	})
+	if err != nil {
+		c.lock.Lock()
+		delete(c.subscriptions, subscription.id)
+		c.lock.Unlock()
+		c.reportError(err)
+	}
+}
+
+func (t *remoteTopic) Last() (interface{}, bool) {
+	reply, err := t.client.request(&server.Frame{Op: server.OpLast, Topic: t.String()})
+	if err != nil {
+		t.client.reportError(err)
+		return nil, false
+	}
+	if !reply.Exists {
+		return nil, false
+	}
+	event, err := t.decode(reply)
+	if err != nil {
+		t.client.reportError(err)
+		return nil, false
+	}
+	return event, true
+}
+
+func (t *remoteTopic) decode(frame *server.Frame) (interface{}, error) {
+	codec := t.codec()
+	if frame.Codec != codec.Name() {
+		return nil, fmt.Errorf("Topic '%v' uses the '%v' codec, got '%v'", t.String(), codec.Name(), frame.Codec)
+	}
+	return codec.Decode(frame.Payload)
+}
+
+//Closes the Topic in the remote Factory.
+func (t *remoteTopic) Close() error {
+	c := t.client
+	frame := func() *server.Frame {
+		return &server.Frame{Op: server.OpClose, Topic: t.String()}
+	}
+	_, _, err := c.apply(frame, func() {
+		c.forgetTopic(t)
+	})
+	t.closing.Do(func() {
+		close(t.closed)
+	})
+	return err
+}
+
+/*
+Signalled once the Topic is closed through this value, or the Client is closed. Closing the Topic
+otherwise (e.g. by another client of the remote Factory) goes unnoticed.
+*/
+func (t *remoteTopic) Closed() <-chan struct{} {
+	t.watch.Do(func() {
+		go func() {
+			select {
+			case <-t.client.done:
+				t.closing.Do(func() {
+					close(t.closed)
+				})
+			case <-t.closed:
+			}
+		}()
+	})
+	return t.closed
+}
+
+/*
+A remote ticker Topic, which keeps its interval and whether it's paused, to restore them after reconnecting.
+*/
+type tickerTopic struct {
+	*remoteTopic
+	//guarded by the remoteTopic's lock
+	interval time.Duration
+	paused   bool
+	settings events.TickerSettings
+}
+
+func (t *tickerTopic) creation() []*server.Frame {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	frames := []*server.Frame{{Op: server.OpCreate, Topic: t.name, Kind: server.KindTicker, Interval: int64(t.interval), Immediate: t.settings.Immediate}}
+	if t.paused {
+		frames = append(frames, &server.Frame{Op: server.OpControl, Topic: t.name, Action: server.ActionPause})
+	}
+	return frames
+}
+
+func (t *tickerTopic) Pause() {
+	t.control(&server.Frame{Action: server.ActionPause}, func() {
+		t.paused = true
+	})
+}
+
+func (t *tickerTopic) Resume() {
+	t.control(&server.Frame{Action: server.ActionResume}, func() {
+		t.paused = false
+	})
+}
+
+func (t *tickerTopic) Reset(interval time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("Non-positive interval %v for the ticker topic '%v'", interval, t.String())
+	}
+	return t.control(&server.Frame{Action: server.ActionReset, Interval: int64(interval)}, func() {
+		t.interval = interval
+	})
+}
+
+func (t *tickerTopic) control(frame *server.Frame, record func()) error {
+	frame.Op, frame.Topic = server.OpControl, t.String()
+	_, _, err := t.client.apply(func() *server.Frame { return frame }, func() {
+		t.lock.Lock()
+		record()
+		t.lock.Unlock()
+	})
+	if err != nil {
+		t.client.reportError(err)
+	}
+	return err
+}
+
+/*
+A Subscriber of a remote Topic, numbered by the Client so that the server can tell the subscriptions apart.
+*/
+type subscription struct {
+	id         uint64
+	topic      *remoteTopic
+	subscriber events.Subscriber
+	settings   events.SubscribeSettings
+	//guards the fields below
+	lock     sync.Mutex
+	received bool
+	next     uint64
+}
+
+/*
+The frame subscribing to the Topic. Once events were received, a subscription restored on the
+same server resumes after the last one (which only matters for Topics keeping a history).
+*/
+func (s *subscription) frame(sameSession bool) *server.Frame {
+	frame := &server.Frame{Op: server.OpSubscribe, Topic: s.topic.String(), Subscription: s.id}
+	s.lock.Lock()
+	received, next := s.received, s.next
+	s.lock.Unlock()
+	switch {
+	case sameSession && received:
+		frame.From, frame.Offset = server.FromOffset, next
+	case !s.settings.Replay:
+	case s.settings.FromBeginning:
+		frame.From = server.FromBeginning
+	case !s.settings.FromTime.IsZero():
+		frame.From, frame.Time = server.FromTime, s.settings.FromTime.UnixNano()
+	default:
+		frame.From, frame.Offset = server.FromOffset, s.settings.FromOffset
+	}
+	return frame
+}
+
+func (s *subscription) deliver(frame *server.Frame) {
+	event, err := s.topic.decode(frame)
+	if err != nil {
+		s.topic.client.reportError(err)
+		return
+	}
+	s.lock.Lock()
+	if !s.received || frame.Offset >= s.next {
+		s.received, s.next = true, frame.Offset+1
+	}
+	s.lock.Unlock()
+	if s.settings.Envelope {
+		go s.subscriber(&events.Envelope{Topic: frame.Topic, Offset: frame.Offset, Time: time.Unix(0, frame.Time), Event: event})
+	} else {
+		go s.subscriber(event)
+	}
+}
+
+type subscriptionsById []*subscription
+
+func (s subscriptionsById) Len() int           { return len(s) }
+func (s subscriptionsById) Less(i, j int) bool { return s[i].id < s[j].id }
+func (s subscriptionsById) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
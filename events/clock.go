@@ -0,0 +1,237 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+/*
+The source of time for a Factory. Tickers, schedules and the delays used when re-queueing
+events all go through a Clock, hence replacing it (see WithClock) makes time-related
+behaviour deterministic. By default the Factory uses the real, wall clock.
+*/
+type Clock interface {
+	//Returns the current time
+	Now() time.Time
+	//Returns a channel which receives the current time once the duration elapses
+	After(time.Duration) <-chan time.Time
+	//Creates a Ticker firing every duration
+	NewTicker(time.Duration) Ticker
+	//Creates a Timer firing once, after the duration
+	NewTimer(time.Duration) Timer
+}
+
+/*
+A Ticker, as created by a Clock. Mirrors the behaviour of time.Ticker.
+*/
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+	Reset(time.Duration)
+}
+
+/*
+A Timer, as created by a Clock. Mirrors the behaviour of time.Timer.
+*/
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+}
+
+//Returns the Clock backed by the time package
+func NewRealClock() Clock {
+	return realClock{}
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return &realTicker{time.NewTicker(d)}
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return &realTimer{time.NewTimer(d)}
+}
+
+type realTicker struct {
+	ticker *time.Ticker
+}
+
+func (t *realTicker) C() <-chan time.Time {
+	return t.ticker.C
+}
+
+func (t *realTicker) Stop() {
+	t.ticker.Stop()
+}
+
+func (t *realTicker) Reset(d time.Duration) {
+	t.ticker.Reset(d)
+}
+
+type realTimer struct {
+	timer *time.Timer
+}
+
+func (t *realTimer) C() <-chan time.Time {
+	return t.timer.C
+}
+
+func (t *realTimer) Stop() bool {
+	return t.timer.Stop()
+}
+
+/*
+A Clock which only moves when told to, via Advance. Meant for tests: tickers, timers and
+delays created by it fire synchronously within Advance, in the order of their deadlines.
+A Ticker fires at most once per Advance, since its reader had no chance to consume the ticks
+in between - just like the time package drops ticks for slow readers.
+*/
+type ManualClock struct {
+	lock    sync.Mutex
+	changed *sync.Cond
+	now     time.Time
+	waiters []*manualWaiter
+}
+
+type manualWaiter struct {
+	clock    *ManualClock
+	deadline time.Time
+	period   time.Duration
+	channel  chan time.Time
+}
+
+//Creates a ManualClock, showing the given time until advanced
+func NewManualClock(now time.Time) *ManualClock {
+	clock := &ManualClock{now: now}
+	clock.changed = sync.NewCond(&clock.lock)
+	return clock
+}
+
+func (c *ManualClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+func (c *ManualClock) After(d time.Duration) <-chan time.Time {
+	return c.NewTimer(d).C()
+}
+
+func (c *ManualClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("Non-positive interval for a Ticker")
+	}
+	return &manualTicker{c.addWaiter(d, d)}
+}
+
+func (c *ManualClock) NewTimer(d time.Duration) Timer {
+	return c.addWaiter(d, 0)
+}
+
+func (c *ManualClock) addWaiter(d time.Duration, period time.Duration) *manualWaiter {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	waiter := &manualWaiter{c, c.now.Add(d), period, make(chan time.Time, 1)}
+	if d <= 0 {
+		waiter.channel <- c.now
+		return waiter
+	}
+	c.waiters = append(c.waiters, waiter)
+	c.changed.Broadcast()
+	return waiter
+}
+
+//Moves the clock forward, firing every Ticker, Timer and After channel that falls due
+func (c *ManualClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	target := c.now.Add(d)
+	for {
+		earliest := -1
+		for i, waiter := range c.waiters {
+			if !waiter.deadline.After(target) && (earliest < 0 || waiter.deadline.Before(c.waiters[earliest].deadline)) {
+				earliest = i
+			}
+		}
+		if earliest < 0 {
+			break
+		}
+		waiter := c.waiters[earliest]
+		c.now = waiter.deadline
+		select {
+		case waiter.channel <- c.now:
+		default:
+		}
+		if waiter.period > 0 {
+			//the reader had no chance to consume the ticks falling due in between
+			for !waiter.deadline.After(target) {
+				waiter.deadline = waiter.deadline.Add(waiter.period)
+			}
+		} else {
+			c.remove(waiter)
+		}
+	}
+	c.now = target
+}
+
+//Blocks until at least the given number of Tickers, Timers or After channels are waiting on the clock.
+//Useful when the code under test creates them in its own go-routine.
+func (c *ManualClock) BlockUntil(waiters int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for len(c.waiters) < waiters {
+		c.changed.Wait()
+	}
+}
+
+func (c *ManualClock) remove(waiter *manualWaiter) bool {
+	for i, candidate := range c.waiters {
+		if candidate == waiter {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			c.changed.Broadcast()
+			return true
+		}
+	}
+	return false
+}
+
+func (w *manualWaiter) C() <-chan time.Time {
+	return w.channel
+}
+
+func (w *manualWaiter) Stop() bool {
+	w.clock.lock.Lock()
+	defer w.clock.lock.Unlock()
+	return w.clock.remove(w)
+}
+
+type manualTicker struct {
+	*manualWaiter
+}
+
+func (t *manualTicker) Stop() {
+	t.manualWaiter.Stop()
+}
+
+func (t *manualTicker) Reset(d time.Duration) {
+	if d <= 0 {
+		panic("Non-positive interval for a Ticker")
+	}
+	clock := t.clock
+	clock.lock.Lock()
+	defer clock.lock.Unlock()
+	clock.remove(t.manualWaiter)
+	t.deadline = clock.now.Add(d)
+	t.period = d
+	clock.waiters = append(clock.waiters, t.manualWaiter)
+	clock.changed.Broadcast()
+}
@@ -0,0 +1,108 @@
+package events
+
+import (
+	"github.com/tholowka/testing/assertions"
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2015, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+func TestThat_ManualClock_FiresOnlyWhenAdvanced(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	clock := NewManualClock(epoch)
+	after := clock.After(time.Second)
+	//when
+	clock.Advance(999 * time.Millisecond)
+	//then
+	assert.AreEqual(0, len(after))
+	clock.Advance(time.Millisecond)
+	assert.AreEqual(epoch.Add(time.Second), <-after)
+}
+
+func TestThat_ManualClock_Ticker_DropsTicksOfASlowReader(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	clock := NewManualClock(epoch)
+	ticker := clock.NewTicker(time.Second)
+	//when
+	clock.Advance(3 * time.Second)
+	//then only the first tick is kept, like with time.Ticker
+	assert.AreEqual(epoch.Add(time.Second), <-ticker.C())
+	assert.AreEqual(0, len(ticker.C()))
+	assert.AreEqual(epoch.Add(3*time.Second), clock.Now())
+	clock.Advance(time.Second)
+	assert.AreEqual(epoch.Add(4*time.Second), <-ticker.C())
+}
+
+func TestThat_ManualClock_StoppedTimers_DontFire(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	clock := NewManualClock(epoch)
+	timer := clock.NewTimer(time.Second)
+	//when
+	stopped := timer.Stop()
+	clock.Advance(time.Minute)
+	//then
+	assert.IsTrue(stopped)
+	assert.IsTrue(!timer.Stop())
+	assert.AreEqual(0, len(timer.C()))
+}
+
+func TestThat_TickerTopic_FollowsTheFactoryClock(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	clock := NewManualClock(epoch)
+	ticks := make(chan interface{})
+	ticker := NewFactory(WithClock(clock)).NewTickerTopic("ticker", time.Minute)
+	ticker.NewSubscriber(func(event interface{}) {
+		ticks <- event
+	})
+	//when
+	for i := 1; i <= 3; i++ {
+		clock.Advance(time.Minute)
+		//then
+		assert.AreEqual(Tick{epoch.Add(time.Duration(i) * time.Minute), uint64(i), 0, false}, <-ticks)
+	}
+	ticker.Close()
+}
+
+func TestThat_TimerTopic_FollowsTheFactoryClock(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	clock := NewManualClock(epoch)
+	fired := make(chan interface{})
+	timer := NewFactory(WithClock(clock)).NewTimerTopic("timer", epoch.Add(time.Hour))
+	timer.NewSubscriber(func(event interface{}) {
+		fired <- event
+	})
+	//when
+	clock.BlockUntil(1)
+	clock.Advance(time.Hour)
+	//then
+	assert.AreEqual(Tick{epoch.Add(time.Hour), 1, 0, false}, <-fired)
+	timer.Close()
+}
+
+func TestThat_Gates_OverTheSameTopics_StayApart_OnAManualClock(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	f := NewFactory(WithClock(NewManualClock(epoch)), WithDeliveryMode(DeliverSync))
+	defer f.Close()
+	orders, payments := f.NewTopic("orders"), f.NewTopic("payments")
+	first, second := 0, 0
+	firstGate := f.OrGate([]Topic{orders, payments}, func(interface{}) {
+		first++
+	})
+	secondGate := f.OrGate([]Topic{orders, payments}, func(interface{}) {
+		second++
+	})
+	//when
+	orders.NewPublisher()("order")
+	payments.NewPublisher()("payment")
+	//then
+	assert.IsTrue(firstGate.String() != secondGate.String())
+	assert.AreEqual(2, first)
+	assert.AreEqual(2, second)
+}
@@ -0,0 +1,191 @@
+package events
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+/*
+Turns events into bytes and back, for Topics which store events (see Factory.NewPersistentTopic)
+or send them to other processes. Subscribers always receive the decoded Go values.
+Codecs are registered per Topic with WithCodec; Topics without one use NewJSONCodec(nil).
+*/
+type Codec interface {
+	//A short name of the encoding, e.g. 'json'
+	Name() string
+	Encode(event interface{}) ([]byte, error)
+	Decode(data []byte) (interface{}, error)
+}
+
+/*
+Makes the Topic with the given name use the Codec, wherever its events need encoding.
+*/
+func WithCodec(topicName string, codec Codec) FactoryOption {
+	return func(t *factory) {
+		t.codecs[topicName] = codec
+	}
+}
+
+func (t *factory) CodecFor(topicName string) Codec {
+	if codec, exists := t.codecs[topicName]; exists {
+		return codec
+	}
+	return NewJSONCodec(nil)
+}
+
+/*
+The type events are decoded into. A nil prototype means no particular type.
+Pointer prototypes decode into pointers, others into plain values.
+*/
+type prototype struct {
+	kind reflect.Type
+}
+
+func newPrototype(value interface{}) prototype {
+	if value == nil {
+		return prototype{}
+	}
+	return prototype{reflect.TypeOf(value)}
+}
+
+func (p prototype) check(event interface{}) error {
+	if p.kind != nil && reflect.TypeOf(event) != p.kind {
+		return fmt.Errorf("Expected an event of type %v, got %T", p.kind, event)
+	}
+	return nil
+}
+
+//returns a pointer to decode into, and a function returning the decoded event
+func (p prototype) target() (interface{}, func() interface{}) {
+	if p.kind == nil {
+		var event interface{}
+		return &event, func() interface{} { return event }
+	}
+	if p.kind.Kind() == reflect.Ptr {
+		value := reflect.New(p.kind.Elem())
+		return value.Interface(), func() interface{} { return value.Interface() }
+	}
+	value := reflect.New(p.kind)
+	return value.Interface(), func() interface{} { return value.Elem().Interface() }
+}
+
+/*
+Encodes events as JSON. With a nil prototype events decode to what encoding/json produces
+for an interface{} (maps, slices, float64...), otherwise to values of the prototype's type.
+*/
+func NewJSONCodec(prototype interface{}) Codec {
+	return &jsonCodec{newPrototype(prototype)}
+}
+
+type jsonCodec struct {
+	prototype prototype
+}
+
+func (c *jsonCodec) Name() string {
+	return "json"
+}
+
+func (c *jsonCodec) Encode(event interface{}) ([]byte, error) {
+	if err := c.prototype.check(event); err != nil {
+		return nil, err
+	}
+	return json.Marshal(event)
+}
+
+func (c *jsonCodec) Decode(data []byte) (interface{}, error) {
+	target, result := c.prototype.target()
+	if err := json.Unmarshal(data, target); err != nil {
+		return nil, err
+	}
+	return result(), nil
+}
+
+/*
+Encodes events with encoding/gob, decoding them to values of the prototype's type.
+With a nil prototype any event can be encoded, as long as its type is registered with gob.Register.
+*/
+func NewGobCodec(prototype interface{}) Codec {
+	return &gobCodec{newPrototype(prototype)}
+}
+
+type gobCodec struct {
+	prototype prototype
+}
+
+func (c *gobCodec) Name() string {
+	return "gob"
+}
+
+func (c *gobCodec) Encode(event interface{}) ([]byte, error) {
+	if err := c.prototype.check(event); err != nil {
+		return nil, err
+	}
+	buffer := &bytes.Buffer{}
+	var err error
+	if c.prototype.kind == nil {
+		//encoding a pointer to the interface keeps the type information
+		err = gob.NewEncoder(buffer).Encode(&event)
+	} else {
+		err = gob.NewEncoder(buffer).Encode(event)
+	}
+	return buffer.Bytes(), err
+}
+
+func (c *gobCodec) Decode(data []byte) (interface{}, error) {
+	target, result := c.prototype.target()
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(target); err != nil {
+		return nil, err
+	}
+	return result(), nil
+}
+
+/*
+The methods of messages generated by the protobuf compilers (e.g. gogo/protobuf),
+which is all the proto Codec needs, hence it does not depend on any protobuf library.
+*/
+type ProtoMessage interface {
+	Marshal() ([]byte, error)
+	Unmarshal([]byte) error
+}
+
+/*
+Encodes protobuf messages, decoding them to new messages of the prototype's type.
+The prototype has to be a pointer, as generated messages are.
+*/
+func NewProtoCodec(prototype ProtoMessage) Codec {
+	return &protoCodec{newPrototype(prototype)}
+}
+
+type protoCodec struct {
+	prototype prototype
+}
+
+func (c *protoCodec) Name() string {
+	return "proto"
+}
+
+func (c *protoCodec) Encode(event interface{}) ([]byte, error) {
+	if err := c.prototype.check(event); err != nil {
+		return nil, err
+	}
+	message, isMessage := event.(ProtoMessage)
+	if !isMessage {
+		return nil, fmt.Errorf("Expected a protobuf message, got %T", event)
+	}
+	return message.Marshal()
+}
+
+func (c *protoCodec) Decode(data []byte) (interface{}, error) {
+	if c.prototype.kind == nil || c.prototype.kind.Kind() != reflect.Ptr {
+		return nil, errors.New("The proto codec needs a pointer prototype to decode messages")
+	}
+	target, result := c.prototype.target()
+	if err := target.(ProtoMessage).Unmarshal(data); err != nil {
+		return nil, err
+	}
+	return result(), nil
+}
@@ -0,0 +1,94 @@
+package events
+
+import (
+	"errors"
+	"github.com/tholowka/testing/assertions"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+type order struct {
+	Id     string
+	Amount int
+}
+
+//mimics a message generated by a protobuf compiler
+type fakeMessage struct {
+	payload string
+}
+
+func (m *fakeMessage) Marshal() ([]byte, error) {
+	return []byte(m.payload), nil
+}
+
+func (m *fakeMessage) Unmarshal(data []byte) error {
+	if len(data) == 0 {
+		return errors.New("empty message")
+	}
+	m.payload = string(data)
+	return nil
+}
+
+func roundTrip(codec Codec, event interface{}) (interface{}, error) {
+	data, err := codec.Encode(event)
+	if err != nil {
+		return nil, err
+	}
+	return codec.Decode(data)
+}
+
+func TestThat_Codecs_DecodeToTheirPrototypes(t *testing.T) {
+	assert := assertions.New(t)
+	for _, codec := range []Codec{NewJSONCodec(order{}), NewGobCodec(order{})} {
+		decoded, err := roundTrip(codec, order{"42", 100})
+		assert.IsTrue(err == nil)
+		assert.AreEqual(order{"42", 100}, decoded)
+	}
+	for _, codec := range []Codec{NewJSONCodec(&order{}), NewGobCodec(&order{})} {
+		decoded, err := roundTrip(codec, &order{"42", 100})
+		assert.IsTrue(err == nil)
+		assert.AreEqual(&order{"42", 100}, decoded)
+	}
+	decoded, err := roundTrip(NewProtoCodec(&fakeMessage{}), &fakeMessage{"hello"})
+	assert.IsTrue(err == nil)
+	assert.AreEqual(&fakeMessage{"hello"}, decoded)
+}
+
+func TestThat_Codecs_WithoutPrototypes_AcceptAnything(t *testing.T) {
+	assert := assertions.New(t)
+	decoded, err := roundTrip(NewJSONCodec(nil), map[string]interface{}{"id": "42"})
+	assert.IsTrue(err == nil)
+	assert.AreEqual(map[string]interface{}{"id": "42"}, decoded)
+	decoded, err = roundTrip(NewGobCodec(nil), "plain string")
+	assert.IsTrue(err == nil)
+	assert.AreEqual("plain string", decoded)
+}
+
+func TestThat_Codecs_RejectEventsOfOtherTypes(t *testing.T) {
+	assert := assertions.New(t)
+	for _, codec := range []Codec{NewJSONCodec(order{}), NewGobCodec(order{}), NewProtoCodec(&fakeMessage{})} {
+		_, err := codec.Encode("not an order")
+		assert.IsTrue(err != nil)
+	}
+}
+
+func TestThat_PersistentTopic_RecoversEvents_WithItsCodec(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	directory, _ := ioutil.TempDir("", "codec")
+	defer os.RemoveAll(directory)
+	options := []FactoryOption{WithStorage(directory), WithCodec("orders", NewGobCodec(order{}))}
+	topic, _ := NewFactory(options...).NewPersistentTopic("orders", PersistenceOptions{})
+	topic.NewPublisher()(order{"42", 100})
+	waitForLast(topic, order{"42", 100})
+	topic.Close()
+	received := make(chan interface{})
+	//when
+	topic, _ = NewFactory(options...).NewPersistentTopic("orders", PersistenceOptions{}, func(event interface{}) {
+		received <- event
+	})
+	//then
+	assert.AreEqual(order{"42", 100}, <-received)
+	topic.Close()
+}
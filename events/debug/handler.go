@@ -0,0 +1,100 @@
+/*
+Renders the state of an events.Factory (see events.Factory.Describe) for diagnosing stuck flows
+in production: as an HTML page, as JSON, or as an expvar variable.
+
+	http.Handle("/debug/events", debug.NewHandler(factory))
+	debug.PublishExpvar("events", factory)
+
+The page lists the open Topics with their kind, Subscribers, gate inputs and buffered events,
+and the events waiting to be requeued. It's served as JSON for ?format=json, or to requests
+accepting application/json. For ?format=dot, the topology of the Factory (see events.Factory.Topology)
+is served in the Graphviz DOT language instead.
+*/
+package debug
+
+import (
+	"encoding/json"
+	"expvar"
+	"github.com/tholowka/pub-sub/events"
+	"html/template"
+	"io"
+	"net/http"
+	"strings"
+)
+
+/*
+Serves the state of a Factory, see the package documentation.
+*/
+type Handler struct {
+	factory events.Factory
+}
+
+func NewHandler(factory events.Factory) *Handler {
+	return &Handler{factory}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if r.URL.Query().Get("format") == "dot" {
+		w.Header().Set("Content-Type", "text/vnd.graphviz; charset=utf-8")
+		io.WriteString(w, h.factory.Topology().DOT())
+		return
+	}
+	description := h.factory.Describe()
+	if r.URL.Query().Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(description)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := page.Execute(w, description); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+/*
+Publishes the state of the Factory as an expvar variable with the given name, which /debug/vars
+then renders as JSON. Like expvar.Publish, it panics if the name is taken already.
+*/
+func PublishExpvar(name string, factory events.Factory) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return factory.Describe()
+	}))
+}
+
+var page = template.Must(template.New("factory").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<title>{{.Id}}</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 2px 8px; text-align: left; }
+</style>
+</head>
+<body>
+<h1>{{.Id}}</h1>
+<p>{{len .Topics}} topics, {{.Subscribers}} subscribers, {{.InFlight}} subscribers running</p>
+<h2>Topics</h2>
+<table>
+<tr><th>Name</th><th>Kind</th><th>Inputs</th><th>Subscribers</th><th>Buffered</th></tr>
+{{range .Topics}}<tr>
+<td>{{.Name}}</td>
+<td>{{.Kind}}{{if .Operator}} ({{.Operator}}){{end}}{{if .Brokered}}, brokered{{end}}</td>
+<td>{{range $i, $input := .Inputs}}{{if $i}}, {{end}}{{$input}}{{end}}</td>
+<td>{{.Subscribers}}</td>
+<td>{{.Buffered}}{{if .Capacity}} / {{.Capacity}}{{end}}</td>
+</tr>
+{{end}}</table>
+{{if .Requeued}}<h2>Waiting to be requeued</h2>
+<table>
+<tr><th>Topic</th><th>Events</th></tr>
+{{range $name, $events := .Requeued}}<tr><td>{{$name}}</td><td>{{$events}}</td></tr>
+{{end}}</table>
+{{end}}</body>
+</html>
+`))
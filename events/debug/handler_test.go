@@ -0,0 +1,84 @@
+package debug
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"github.com/tholowka/pub-sub/events"
+	"github.com/tholowka/testing/assertions"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestThat_Handler_RendersTheTopics(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	factory := events.NewFactory()
+	defer factory.Close()
+	orders := factory.NewTopic("orders", func(interface{}) {})
+	factory.OrGate([]events.Topic{orders, factory.NewTopic("<payments>")})
+	recorder := httptest.NewRecorder()
+	//when
+	NewHandler(factory).ServeHTTP(recorder, httptest.NewRequest("GET", "/debug/events", nil))
+	//then
+	page := recorder.Body.String()
+	assert.AreEqual(http.StatusOK, recorder.Code)
+	assert.AreEqual("text/html; charset=utf-8", recorder.Header().Get("Content-Type"))
+	assert.IsTrue(strings.Contains(page, "<td>orders</td>"))
+	assert.IsTrue(strings.Contains(page, "<td>gate (or)</td>"))
+	assert.IsTrue(strings.Contains(page, "<td>orders, &lt;payments&gt;</td>"))
+	assert.IsTrue(strings.Contains(page, "3 topics, 3 subscribers"))
+}
+
+func TestThat_Handler_ServesJson_OnRequest(t *testing.T) {
+	assert := assertions.New(t)
+	factory := events.NewFactory()
+	defer factory.Close()
+	factory.NewRetainedTopic("status", 1)
+	for _, request := range []*http.Request{
+		httptest.NewRequest("GET", "/debug/events?format=json", nil),
+		httptest.NewRequest("GET", "/debug/events", nil),
+	} {
+		if request.URL.RawQuery == "" {
+			request.Header.Set("Accept", "application/json")
+		}
+		recorder := httptest.NewRecorder()
+		NewHandler(factory).ServeHTTP(recorder, request)
+		description := events.FactoryDescription{}
+		assert.IsTrue(json.Unmarshal(recorder.Body.Bytes(), &description) == nil)
+		assert.AreEqual([]events.TopicDescription{{Name: "status", Kind: "retained", Capacity: 1}}, description.Topics)
+	}
+}
+
+func TestThat_Handler_OnlyServesGet(t *testing.T) {
+	assert := assertions.New(t)
+	recorder := httptest.NewRecorder()
+	NewHandler(events.NewFactory()).ServeHTTP(recorder, httptest.NewRequest("POST", "/debug/events", nil))
+	assert.AreEqual(http.StatusMethodNotAllowed, recorder.Code)
+}
+
+func TestThat_TheState_IsPublished_AsAnExpvar(t *testing.T) {
+	assert := assertions.New(t)
+	factory := events.NewFactory()
+	defer factory.Close()
+	factory.NewTopic("orders")
+	//names can't be published twice, e.g. when running with -count
+	name := fmt.Sprintf("events-%v", time.Now().UnixNano())
+	PublishExpvar(name, factory)
+	description := events.FactoryDescription{}
+	assert.IsTrue(json.Unmarshal([]byte(expvar.Get(name).String()), &description) == nil)
+	assert.AreEqual("orders", description.Topics[0].Name)
+}
+
+func TestThat_Handler_ServesTheTopology_AsDot(t *testing.T) {
+	assert := assertions.New(t)
+	factory := events.NewFactory()
+	defer factory.Close()
+	factory.NewTopic("orders")
+	recorder := httptest.NewRecorder()
+	NewHandler(factory).ServeHTTP(recorder, httptest.NewRequest("GET", "/debug/events?format=dot", nil))
+	assert.AreEqual(factory.Topology().DOT(), recorder.Body.String())
+}
@@ -0,0 +1,56 @@
+package events
+
+/*
+How the events published to the Topics of a Factory reach their Subscribers, see WithDeliveryMode.
+*/
+type DeliveryMode int
+
+const (
+	//Every Subscriber runs in a go-routine of its own, Publishers don't wait for them (the default).
+	DeliverAsync DeliveryMode = iota
+	//Publishers run the Subscribers themselves, one after another in the order they subscribed,
+	//and return once all of them did.
+	DeliverSync
+)
+
+func (m DeliveryMode) String() string {
+	if m == DeliverSync {
+		return "sync"
+	}
+	return "async"
+}
+
+/*
+Chooses how events reach Subscribers. With DeliverSync, publishing to a standard, retained or
+replay Topic (or to a gate through them) delivers the event in the publishing go-routine,
+which saves the hops through other go-routines and makes tests deterministic. A Subscriber
+blocking blocks its Publisher too, and one publishing to its own Topic recurses.
+
+Ticks of ticker and schedule Topics, events of persistent and brokered Topics and events
+waiting to be requeued are delivered asynchronously in either mode. So are the events a retained
+or replay Topic replays to a newly registered Subscriber: NewSubscriber may return before the
+Subscriber caught up, though it still receives the replayed events before any live ones.
+*/
+func WithDeliveryMode(mode DeliveryMode) FactoryOption {
+	return func(t *factory) {
+		t.delivery = mode
+	}
+}
+
+//hands the event of a Publisher over to the factory's go-routine, or delivers it right away with DeliverSync
+func (t *factory) deliverPublished(event *eventSpec) {
+	if t.delivery != DeliverSync {
+		t.enqueue(event)
+		return
+	}
+	var deliveries []func()
+	stateChanged := make(chan bool)
+	dispatcher := func(state *factory) {
+		deliveries = state.dispatch(event)
+	}
+	t.modify(&stateModifierSpec{dispatcher, stateChanged, false})
+	close(stateChanged)
+	for _, delivery := range deliveries {
+		delivery()
+	}
+}
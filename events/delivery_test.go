@@ -0,0 +1,98 @@
+package events
+
+import (
+	"fmt"
+	"github.com/tholowka/testing/assertions"
+	"sync/atomic"
+	"testing"
+)
+
+func TestThat_SyncDelivery_RunsSubscribers_BeforeThePublisherReturns(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	f := NewFactory(WithDeliveryMode(DeliverSync))
+	defer f.Close()
+	received := []string{}
+	subscriber := func(name string) Subscriber {
+		return func(event interface{}) {
+			received = append(received, fmt.Sprintf("%v:%v", name, event))
+		}
+	}
+	publisher := f.NewTopic("orders", subscriber("first"), subscriber("second")).NewPublisher()
+	//when
+	publisher(1)
+	publisher(2)
+	//then
+	assert.AreEqual([]string{"first:1", "second:1", "first:2", "second:2"}, received)
+}
+
+func TestThat_SyncDelivery_Nests_PublishingFromSubscribers(t *testing.T) {
+	assert := assertions.New(t)
+	f := NewFactory(WithDeliveryMode(DeliverSync))
+	defer f.Close()
+	received := []interface{}{}
+	invoices := f.NewTopic("invoices", func(event interface{}) {
+		received = append(received, event)
+	})
+	f.NewTopic("orders", func(event interface{}) {
+		invoices.NewPublisher()(fmt.Sprintf("invoice for %v", event))
+		received = append(received, event)
+	}).NewPublisher()("order")
+	assert.AreEqual([]interface{}{"invoice for order", "order"}, received)
+}
+
+func TestThat_SyncDelivery_CompletesGates_Inline(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	f := NewFactory(WithDeliveryMode(DeliverSync))
+	defer f.Close()
+	orders, payments := f.NewTopic("orders"), f.NewTopic("payments")
+	var completed interface{}
+	f.AndGate([]Topic{orders, payments}, func(event interface{}) {
+		completed = event
+	})
+	//when
+	orders.NewPublisher()("order")
+	assert.IsTrue(completed == nil)
+	payments.NewPublisher()("payment")
+	//then
+	assert.AreEqual(map[string][]interface{}{"orders": {"order"}, "payments": {"payment"}}, completed)
+}
+
+func TestThat_SyncDelivery_KeepsTheHistory_OfRetainedTopics(t *testing.T) {
+	assert := assertions.New(t)
+	f := NewFactory(WithDeliveryMode(DeliverSync))
+	defer f.Close()
+	topic := f.NewRetainedTopic("status", 1, func(interface{}) {})
+	topic.NewPublisher()("up")
+	last, exists := topic.Last()
+	assert.IsTrue(exists)
+	assert.AreEqual("up", last)
+}
+
+func TestThat_SyncDelivery_DropsEvents_AfterClosing(t *testing.T) {
+	assert := assertions.New(t)
+	f := NewFactory(WithDeliveryMode(DeliverSync))
+	topic := f.NewTopic("orders", func(interface{}) {
+		assert.IsTrue(false)
+	})
+	f.Close()
+	topic.NewPublisher()("order")
+	assert.AreEqual(int32(1), atomic.LoadInt32(&f.(*factory).rejected))
+}
+
+func TestThat_DeliveryModes_HaveNames(t *testing.T) {
+	assert := assertions.New(t)
+	assert.AreEqual("async", DeliverAsync.String())
+	assert.AreEqual("sync", DeliverSync.String())
+}
+
+func Benchmark_Propagation_When_DeliveringSynchronously(b *testing.B) {
+	topic := NewFactory(WithDeliveryMode(DeliverSync)).NewTopic("my-awesome-rant")
+	topic.NewSubscriber(func(interface{}) {})
+	publisher := topic.NewPublisher()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		publisher("Or is Marcus M the best")
+	}
+}
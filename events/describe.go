@@ -0,0 +1,118 @@
+package events
+
+import (
+	"sort"
+	"sync/atomic"
+)
+
+/*
+A snapshot of the state of a Factory, see Factory.Describe. Meant for diagnosing stuck flows:
+events requeued for a Topic which is never registered, Subscribers which never return,
+gates waiting for one of their inputs.
+*/
+type FactoryDescription struct {
+	//Identifies the Factory, e.g. in the hops of bridged events
+	Id string `json:"id"`
+	//The open Topics, ordered by name (gates included)
+	Topics []TopicDescription `json:"topics"`
+	//The number of Subscribers over all Topics
+	Subscribers int `json:"subscribers"`
+	//Events waiting to be requeued (see Factory), per name of the Topic they were published to,
+	//which may not be open (any more)
+	Requeued map[string]int `json:"requeued,omitempty"`
+	//Go-routines currently running Subscribers
+	InFlight int `json:"inFlight"`
+}
+
+type TopicDescription struct {
+	Name string `json:"name"`
+	//One of 'topic', 'retained', 'replay', 'persistent', 'ticker', 'schedule' or 'gate'
+	Kind string `json:"kind"`
+	//For gates, 'and' or 'or'
+	Operator string `json:"operator,omitempty"`
+	//For gates, the names of the Topics they collect events from
+	Inputs []string `json:"inputs,omitempty"`
+	//Registered Subscribers, including those of gates collecting events from the Topic
+	Subscribers int `json:"subscribers"`
+	//Events kept by Topics with a history, or collected by gates so far
+	Buffered int `json:"buffered"`
+	//The number of events Topics with a history keep at most
+	Capacity int `json:"capacity,omitempty"`
+	//Whether the Topic is delegated to a Broker (see WithBroker)
+	Brokered bool `json:"brokered,omitempty"`
+}
+
+//what a gate collects events from, see buildGateTopic
+type gateInputs struct {
+	operator string
+	inputs   []string
+}
+
+func (t *factory) Describe() FactoryDescription {
+	description := FactoryDescription{Id: t.id, Topics: []TopicDescription{}}
+	stateChanged := make(chan bool)
+	reader := func(p *factory) {
+		for name, topic := range p.topics {
+			described := describeTopic(topic)
+			described.Subscribers = len(p.subscribers[name])
+			description.Topics = append(description.Topics, described)
+			description.Subscribers += described.Subscribers
+		}
+		for name, requeued := range p.requeued {
+			if description.Requeued == nil {
+				description.Requeued = map[string]int{}
+			}
+			description.Requeued[name] = requeued
+		}
+	}
+	t.modify(&stateModifierSpec{reader, stateChanged, false})
+	close(stateChanged)
+	description.InFlight = int(atomic.LoadInt32(&t.inFlight))
+	sort.Sort(topicDescriptionsByName(description.Topics))
+	return description
+}
+
+//must run in the factory's go-routine
+func describeTopic(topic Topic) TopicDescription {
+	described := TopicDescription{Name: topic.String()}
+	switch actual := topic.(type) {
+	case *brokerTopic:
+		described = describeTopic(actual.simpleTopic)
+		described.Brokered = true
+	case *simpleTopic:
+		described.Kind = kindOf(actual)
+		if actual.history != nil {
+			described.Buffered = len(actual.history.envelopes)
+			described.Capacity = actual.history.capacity
+		}
+		if actual.gate != nil {
+			described.Kind = "gate"
+			described.Operator = actual.gate.operator
+			described.Inputs = append([]string{}, actual.gate.inputs...)
+			for _, collected := range actual.optionalState.(map[string][]interface{}) {
+				described.Buffered += len(collected)
+			}
+		}
+	case *persistentTopic:
+		described.Kind = "persistent"
+	case *tickerTopic:
+		described.Kind = "ticker"
+	case *scheduleTopic:
+		described.Kind = "schedule"
+	}
+	return described
+}
+
+//counts the events of the Topic waiting to be requeued; must run in the factory's go-routine
+func (t *factory) countRequeued(event *eventSpec, delta int) {
+	t.requeued[event.name] += delta
+	if t.requeued[event.name] <= 0 {
+		delete(t.requeued, event.name)
+	}
+}
+
+type topicDescriptionsByName []TopicDescription
+
+func (s topicDescriptionsByName) Len() int           { return len(s) }
+func (s topicDescriptionsByName) Less(i, j int) bool { return s[i].Name < s[j].Name }
+func (s topicDescriptionsByName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
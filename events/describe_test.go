@@ -0,0 +1,82 @@
+package events
+
+import (
+	"github.com/tholowka/testing/assertions"
+	"testing"
+	"time"
+)
+
+func TestThat_Describe_ListsTopics_WithTheirKindsAndSubscribers(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	f := NewFactory(WithBroker(NewInProcessBroker(), "remote.*"))
+	defer f.Close()
+	received := make(chan interface{})
+	replay := f.NewReplayTopic("replay", 5, func(event interface{}) {
+		received <- event
+	})
+	f.NewTopic("remote.orders")
+	f.NewTickerTopic("ticks", time.Hour)
+	replay.NewPublisher()("one")
+	<-received
+	//when
+	description := f.Describe()
+	//then
+	assert.AreEqual(f.(*factory).id, description.Id)
+	assert.AreEqual([]TopicDescription{
+		{Name: "remote.orders", Kind: "topic", Brokered: true},
+		{Name: "replay", Kind: "replay", Subscribers: 1, Buffered: 1, Capacity: 5},
+		{Name: "ticks", Kind: "ticker"},
+	}, description.Topics)
+	assert.AreEqual(1, description.Subscribers)
+}
+
+func TestThat_Describe_ShowsGateInputs_AndCollectedEvents(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	f := NewFactory()
+	orders := f.NewTopic("orders")
+	payments := f.NewTopic("payments")
+	gate := f.AndGate([]Topic{orders, payments})
+	orders.NewPublisher()("order")
+	//when
+	var described TopicDescription
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		for _, topic := range f.Describe().Topics {
+			if topic.Name == gate.String() {
+				described = topic
+			}
+		}
+		if described.Buffered > 0 {
+			break
+		}
+	}
+	//then
+	assert.AreEqual("gate", described.Kind)
+	assert.AreEqual("and", described.Operator)
+	assert.AreEqual([]string{"orders", "payments"}, described.Inputs)
+	assert.AreEqual(1, described.Buffered)
+	for _, topic := range f.Describe().Topics {
+		if topic.Name == "orders" {
+			assert.AreEqual(1, topic.Subscribers)
+		}
+	}
+}
+
+func TestThat_Describe_CountsEventsWaitingToBeRequeued(t *testing.T) {
+	assert := assertions.New(t)
+	f := NewFactory(WithClock(NewManualClock(time.Now())))
+	topic := f.NewTopic("orders")
+	topic.Close()
+	publisher := topic.NewPublisher()
+	publisher("one")
+	publisher("two")
+	var requeued map[string]int
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if requeued = f.Describe().Requeued; requeued["orders"] == 2 {
+			break
+		}
+	}
+	assert.AreEqual(map[string]int{"orders": 2}, requeued)
+	assert.AreEqual(0, len(f.Describe().Topics))
+}
@@ -0,0 +1,276 @@
+package events
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultVisibilityTimeout = 30 * time.Second
+	//the number of stored events a durable Subscriber reads from the log at a time
+	durablePageSize = 256
+)
+
+/*
+A Topic which allows named Subscribers to pick up where they left off, even after a restart.
+Each durable Subscriber tracks the offset up to which it acknowledged all events. Events not
+acknowledged within the visibility timeout (see VisibilityTimeout) are delivered again.
+*/
+type DurableTopic interface {
+	Topic
+	//Registers a named Subscriber, which starts at the first event it hasn't acknowledged yet.
+	//By default an event is acknowledged when the Subscriber returns, and negatively acknowledged
+	//when it panics. With ManualAck, the Subscriber receives a *Envelope and calls Ack/Nack itself.
+	//Only one Subscriber can be registered under a given name at a time.
+	NewDurableSubscriber(name string, subscriber Subscriber, options ...SubscribeOption) error
+}
+
+/*
+Makes a durable Subscriber receive a *Envelope, and acknowledge events explicitly via its
+Ack and Nack methods.
+*/
+func ManualAck() SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.manualAck = true
+		o.envelope = true
+	}
+}
+
+/*
+Sets the time after which an event delivered to a durable Subscriber, but not acknowledged,
+is delivered again. 30 seconds by default. Events due for redelivery are checked for twice per timeout.
+*/
+func VisibilityTimeout(timeout time.Duration) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.visibilityTimeout = timeout
+	}
+}
+
+//what an Envelope reports its acknowledgements to
+type acknowledger interface {
+	ack(offset uint64)
+	nack(offset uint64)
+}
+
+//Acknowledges the event, so that it won't be delivered to the durable Subscriber again.
+//Has no effect for events delivered to other Subscribers.
+func (e *Envelope) Ack() {
+	if e.acknowledger != nil {
+		e.acknowledger.ack(e.Offset)
+	}
+}
+
+//Tells the event could not be handled, so that it is delivered to the durable Subscriber again
+//(at the next check for events due for redelivery, see VisibilityTimeout).
+//Has no effect for events delivered to other Subscribers.
+func (e *Envelope) Nack() {
+	if e.acknowledger != nil {
+		e.acknowledger.nack(e.Offset)
+	}
+}
+
+type durableSubscription struct {
+	topic      *persistentTopic
+	name       string
+	subscriber Subscriber
+	options    *subscribeOptions
+	notify     chan bool
+	stop       chan bool
+	//guards the fields below
+	lock      sync.Mutex
+	committed uint64
+	cursor    uint64
+	acked     map[uint64]bool
+	inFlight  map[uint64]*inFlightEvent
+}
+
+type inFlightEvent struct {
+	envelope *Envelope
+	deadline time.Time
+}
+
+func (t *persistentTopic) NewDurableSubscriber(name string, subscriber Subscriber, options ...SubscribeOption) error {
+	if subscriber == nil {
+		return errors.New("A durable subscriber can't be nil")
+	}
+	subscribeOptions := newSubscribeOptions(options)
+	if subscribeOptions.visibilityTimeout <= 0 {
+		subscribeOptions.visibilityTimeout = defaultVisibilityTimeout
+	}
+	subscription := &durableSubscription{
+		topic:      t,
+		name:       name,
+		subscriber: subscriber,
+		options:    subscribeOptions,
+		notify:     make(chan bool, 1),
+		stop:       make(chan bool),
+		acked:      map[uint64]bool{},
+		inFlight:   map[uint64]*inFlightEvent{},
+	}
+	t.lock.Lock()
+	if t.closed {
+		t.lock.Unlock()
+		return errors.New("The persistent topic is closed")
+	}
+	if _, exists := t.subscriptions[name]; exists {
+		t.lock.Unlock()
+		return fmt.Errorf("A durable subscriber named '%v' already exists", name)
+	}
+	subscription.committed = t.storedSubscriptions[name]
+	if first := t.log.firstOffset(); subscription.committed < first {
+		subscription.committed = first
+	}
+	subscription.cursor = subscription.committed
+	t.subscriptions[name] = subscription
+	t.lock.Unlock()
+	//live events only wake the subscription up, it reads them from the log
+	t.NewSubscriber(func(interface{}) {
+		select {
+		case subscription.notify <- true:
+		default:
+		}
+	})
+	t.p.spawn(subscription.run)
+	return nil
+}
+
+func (s *durableSubscription) run() {
+	interval := s.options.visibilityTimeout / 2
+	if interval <= 0 {
+		interval = s.options.visibilityTimeout
+	}
+	ticker := s.topic.p.clock.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		envelopes, more := s.pending()
+		for _, envelope := range envelopes {
+			select {
+			case <-s.stop:
+				return
+			case <-s.topic.p.done:
+				return
+			default:
+				s.deliver(envelope)
+			}
+		}
+		if more {
+			continue
+		}
+		select {
+		case <-s.stop:
+			return
+		case <-s.topic.p.done:
+			return
+		case <-s.notify:
+		case <-ticker.C():
+		}
+	}
+}
+
+/*
+Returns the events due for redelivery, followed by a page of events not delivered so far,
+and whether more of them are stored.
+*/
+func (s *durableSubscription) pending() ([]*Envelope, bool) {
+	now := s.topic.p.clock.Now()
+	due := []*Envelope{}
+	s.lock.Lock()
+	for _, event := range s.inFlight {
+		if !event.deadline.After(now) {
+			due = append(due, event.envelope)
+		}
+	}
+	from := s.cursor
+	s.lock.Unlock()
+	sortEnvelopes(due)
+	fresh, err := s.topic.readFrom(from, durablePageSize)
+	if err != nil {
+		s.topic.reportError(err)
+	}
+	s.lock.Lock()
+	for _, envelope := range fresh {
+		if envelope.Offset >= s.cursor {
+			s.cursor = envelope.Offset + 1
+			due = append(due, envelope)
+		}
+	}
+	s.lock.Unlock()
+	return due, len(fresh) == durablePageSize
+}
+
+//delivers like to any other Subscriber (see factory.deliver), in the subscription's go-routine
+func (s *durableSubscription) deliver(stored *Envelope) {
+	envelope := *stored
+	envelope.acknowledger = s
+	s.lock.Lock()
+	s.inFlight[envelope.Offset] = &inFlightEvent{stored, s.topic.p.clock.Now().Add(s.options.visibilityTimeout)}
+	s.lock.Unlock()
+	p := s.topic.p
+	p.metrics.Gauge(MetricInFlight, "", float64(atomic.AddInt32(&p.inFlight, 1)))
+	p.deliver(s.topic.name, s.handle, &envelope)
+}
+
+//acknowledges the event once the Subscriber returns, unless it acknowledges itself; a panic is reported either way
+func (s *durableSubscription) handle(envelope *Envelope) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			if !s.options.manualAck {
+				s.nack(envelope.Offset)
+			}
+			s.topic.p.subscriberPanicked(s.topic.name, envelope, recovered)
+		}
+	}()
+	if s.options.envelope {
+		copied := *envelope
+		s.subscriber(&copied)
+	} else {
+		s.subscriber(envelope.Event)
+	}
+	if !s.options.manualAck {
+		s.ack(envelope.Offset)
+	}
+}
+
+func (s *durableSubscription) ack(offset uint64) {
+	s.lock.Lock()
+	if _, inFlight := s.inFlight[offset]; !inFlight {
+		s.lock.Unlock()
+		return
+	}
+	delete(s.inFlight, offset)
+	s.acked[offset] = true
+	for s.acked[s.committed] {
+		delete(s.acked, s.committed)
+		s.committed++
+	}
+	s.lock.Unlock()
+	if s.topic.options.SyncPolicy == SyncAlways {
+		s.topic.saveOffsets()
+	}
+}
+
+func (s *durableSubscription) nack(offset uint64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	//redelivered at the next check, rather than in a tight loop
+	if event, inFlight := s.inFlight[offset]; inFlight {
+		event.deadline = s.topic.p.clock.Now()
+	}
+}
+
+func (s *durableSubscription) Committed() uint64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.committed
+}
+
+func sortEnvelopes(envelopes []*Envelope) {
+	for i := 1; i < len(envelopes); i++ {
+		for j := i; j > 0 && envelopes[j].Offset < envelopes[j-1].Offset; j-- {
+			envelopes[j], envelopes[j-1] = envelopes[j-1], envelopes[j]
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package events
+
+import (
+	"github.com/tholowka/testing/assertions"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func waitForLast(topic Topic, expected interface{}) {
+	for {
+		if last, _ := topic.Last(); last == expected {
+			return
+		}
+		<-time.After(time.Millisecond)
+	}
+}
+
+func TestThat_DurableSubscriber_ResumesAfterARestart(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	directory, _ := ioutil.TempDir("", "durable-subscriber")
+	defer os.RemoveAll(directory)
+	received := make(chan interface{})
+	topic, _ := NewFactory(WithStorage(directory)).NewPersistentTopic("invoices", PersistenceOptions{})
+	err := topic.NewDurableSubscriber("billing", func(event interface{}) {
+		received <- event
+	})
+	assert.IsTrue(err == nil)
+	topic.NewPublisher()("one")
+	assert.AreEqual("one", <-received)
+	for topic.(*persistentTopic).subscriptions["billing"].Committed() != 1 {
+		<-time.After(time.Millisecond)
+	}
+	topic.Close()
+	//when an event is published while the durable subscriber is gone
+	topic, _ = NewFactory(WithStorage(directory)).NewPersistentTopic("invoices", PersistenceOptions{})
+	topic.NewPublisher()("two")
+	waitForLast(topic, "two")
+	topic.NewDurableSubscriber("billing", func(event interface{}) {
+		received <- event
+	})
+	//then it picks up where it left off
+	assert.AreEqual("two", <-received)
+	topic.Close()
+}
+
+func TestThat_DurableSubscriber_GetsUnacknowledgedEventsAgain(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	directory, _ := ioutil.TempDir("", "durable-subscriber")
+	defer os.RemoveAll(directory)
+	clock := NewManualClock(epoch)
+	received := make(chan *Envelope)
+	topic, _ := NewFactory(WithClock(clock), WithStorage(directory)).NewPersistentTopic("invoices", PersistenceOptions{})
+	topic.NewDurableSubscriber("billing", func(event interface{}) {
+		received <- event.(*Envelope)
+	}, ManualAck(), VisibilityTimeout(time.Minute))
+	clock.BlockUntil(1)
+	topic.NewPublisher()("one")
+	//when not acknowledged in time
+	first := <-received
+	assert.AreEqual("one", first.Event)
+	clock.Advance(time.Minute)
+	//then
+	second := <-received
+	assert.AreEqual(first.Offset, second.Offset)
+	second.Ack()
+	clock.Advance(time.Minute)
+	for topic.(*persistentTopic).subscriptions["billing"].Committed() != 1 {
+		<-time.After(time.Millisecond)
+	}
+	assert.AreEqual(0, len(received))
+	topic.Close()
+}
+
+func TestThat_DurableSubscriber_GetsEventsAgain_AfterPanicking(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	directory, _ := ioutil.TempDir("", "durable-subscriber")
+	defer os.RemoveAll(directory)
+	clock := NewManualClock(epoch)
+	received := make(chan interface{}, 2)
+	attempts := 0
+	topic, _ := NewFactory(WithClock(clock), WithStorage(directory)).NewPersistentTopic("invoices", PersistenceOptions{})
+	topic.NewDurableSubscriber("billing", func(event interface{}) {
+		attempts++
+		if attempts == 1 {
+			panic("not yet")
+		}
+		received <- event
+	}, VisibilityTimeout(time.Hour))
+	clock.BlockUntil(1)
+	//when
+	topic.NewPublisher()("one")
+	waitForLast(topic, "one")
+	clock.Advance(30 * time.Minute)
+	//then
+	assert.AreEqual("one", <-received)
+	topic.Close()
+}
+
+func TestThat_DurableSubscriberNames_AreUnique(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	directory, _ := ioutil.TempDir("", "durable-subscriber")
+	defer os.RemoveAll(directory)
+	topic, _ := NewFactory(WithStorage(directory)).NewPersistentTopic("invoices", PersistenceOptions{})
+	//when
+	first := topic.NewDurableSubscriber("billing", func(interface{}) {})
+	second := topic.NewDurableSubscriber("billing", func(interface{}) {})
+	//then
+	assert.IsTrue(first == nil)
+	assert.IsTrue(second != nil)
+	topic.Close()
+}
+
+func TestThat_DurableSubscriber_GoesThroughSubscribeInterceptors(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	directory, _ := ioutil.TempDir("", "durable-subscriber")
+	defer os.RemoveAll(directory)
+	intercepted := make(chan uint64, 1)
+	f := NewFactory(WithStorage(directory), UseSubscribe(func(next SubscribeFunc) SubscribeFunc {
+		return func(envelope *Envelope) {
+			if envelope.acknowledger != nil {
+				intercepted <- envelope.Offset
+			}
+			next(envelope)
+		}
+	}))
+	topic, _ := f.NewPersistentTopic("invoices", PersistenceOptions{})
+	received := make(chan interface{})
+	topic.NewDurableSubscriber("billing", func(event interface{}) {
+		received <- event
+	})
+	//when
+	topic.NewPublisher()("one")
+	//then
+	assert.AreEqual("one", <-received)
+	assert.AreEqual(uint64(0), <-intercepted)
+	topic.Close()
+}
+
+func TestThat_DurableSubscriber_ReadsALongBacklogInPages(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	directory, _ := ioutil.TempDir("", "durable-subscriber")
+	defer os.RemoveAll(directory)
+	topic, _ := NewFactory(WithStorage(directory)).NewPersistentTopic("invoices", PersistenceOptions{SyncPolicy: SyncNever})
+	backlog := durablePageSize*2 + 1
+	for i := 0; i < backlog; i++ {
+		topic.NewPublisher()(float64(i))
+	}
+	stored := func() uint64 {
+		topic.(*persistentTopic).lock.Lock()
+		defer topic.(*persistentTopic).lock.Unlock()
+		return topic.(*persistentTopic).log.nextOffset
+	}
+	for stored() < uint64(backlog) {
+		<-time.After(time.Millisecond)
+	}
+	received := make(chan interface{})
+	//when
+	topic.NewDurableSubscriber("billing", func(event interface{}) {
+		received <- event
+	})
+	//then every event arrives
+	offsets := map[interface{}]bool{}
+	for len(offsets) < backlog {
+		offsets[<-received] = true
+	}
+	assert.IsTrue(offsets[float64(backlog-1)])
+	topic.Close()
+}
+
+func TestThat_Retention_KeepsEventsALaggingDurableSubscriberHasntAcknowledged(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	directory, _ := ioutil.TempDir("", "durable-subscriber")
+	defer os.RemoveAll(directory)
+	options := PersistenceOptions{SegmentBytes: 64, RetentionBytes: 128}
+	topic, _ := NewFactory(WithStorage(directory)).NewPersistentTopic("invoices", options)
+	topic.NewDurableSubscriber("billing", func(interface{}) {}, ManualAck())
+	//when published past the retention, with nothing acknowledged
+	for i := 0; i < 20; i++ {
+		topic.NewPublisher()(float64(i))
+	}
+	stored := func() uint64 {
+		topic.(*persistentTopic).lock.Lock()
+		defer topic.(*persistentTopic).lock.Unlock()
+		return topic.(*persistentTopic).log.nextOffset
+	}
+	for stored() < 20 {
+		<-time.After(time.Millisecond)
+	}
+	topic.Close()
+	//then the durable subscriber gets every event after a restart
+	received := make(chan *Envelope, 20)
+	topic, _ = NewFactory(WithStorage(directory)).NewPersistentTopic("invoices", options)
+	topic.NewDurableSubscriber("billing", func(event interface{}) {
+		received <- event.(*Envelope)
+	}, ManualAck())
+	events := map[interface{}]bool{}
+	for len(events) < 20 {
+		events[(<-received).Event] = true
+	}
+	assert.IsTrue(events[float64(0)] && events[float64(19)])
+	topic.Close()
+}
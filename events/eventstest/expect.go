@@ -0,0 +1,80 @@
+package eventstest
+
+import (
+	"github.com/tholowka/pub-sub/events"
+	"reflect"
+	"testing"
+	"time"
+)
+
+/*
+What a Topic is expected to receive, see Expect.
+*/
+type Expectation struct {
+	t        testing.TB
+	topic    events.Topic
+	recorder *Recorder
+	timeout  time.Duration
+	//the events checked by ToReceive already
+	checked int
+}
+
+/*
+Subscribes to the Topic, so that what it receives from then on can be checked with ToReceive:
+
+	orders := eventstest.Expect(t, topic)
+	topic.NewPublisher()("order")
+	orders.ToReceive("order")
+*/
+func Expect(t testing.TB, topic events.Topic) *Expectation {
+	recorder := NewRecorder(t)
+	topic.NewSubscriber(recorder.Record)
+	return &Expectation{t: t, topic: topic, recorder: recorder, timeout: defaultTimeout}
+}
+
+//Changes how long ToReceive waits for the events (5 seconds by default).
+func (e *Expectation) Within(timeout time.Duration) *Expectation {
+	e.timeout = timeout
+	return e
+}
+
+/*
+Waits for the Topic to receive the values (compared with reflect.DeepEqual), and fails the test
+if they don't arrive in time, or other events arrive instead. The order isn't checked, since
+asynchronous delivery doesn't keep it (see events.DeliverSync). Every call checks the events
+received after those checked by the previous one.
+*/
+func (e *Expectation) ToReceive(values ...interface{}) {
+	e.t.Helper()
+	received, ok := e.recorder.await(e.checked+len(values), e.timeout)
+	fresh := eventsOf(received[e.checked:])
+	e.checked = len(received)
+	if !ok {
+		e.t.Fatalf("Expected '%v' to receive %v within %v, got %v", e.topic, values, e.timeout, fresh)
+		return
+	}
+	if !sameEvents(values, fresh) {
+		e.t.Errorf("Expected '%v' to receive %v, got %v", e.topic, values, fresh)
+	}
+}
+
+//tells whether both hold the same events, in any order
+func sameEvents(expected []interface{}, actual []interface{}) bool {
+	if len(expected) != len(actual) {
+		return false
+	}
+	matched := make([]bool, len(actual))
+	for _, value := range expected {
+		found := false
+		for i, event := range actual {
+			if !matched[i] && reflect.DeepEqual(value, event) {
+				matched[i], found = true, true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
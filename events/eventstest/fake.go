@@ -0,0 +1,49 @@
+package eventstest
+
+import (
+	"github.com/tholowka/pub-sub/events"
+	"sync"
+)
+
+/*
+A Factory for tests: an events.Factory delivering events synchronously (see events.DeliverSync),
+which records the events published to its Topics. To stub some of the Factory's methods, embed
+the Fake in a type of your own and override them, e.g. to make NewPersistentTopic fail.
+*/
+type Fake struct {
+	events.Factory
+	lock      sync.Mutex
+	published map[string][]interface{}
+}
+
+//Options are passed on to events.NewFactory, a delivery mode among them overrides the synchronous one.
+func NewFake(options ...events.FactoryOption) *Fake {
+	fake := &Fake{published: map[string][]interface{}{}}
+	defaults := []events.FactoryOption{events.WithDeliveryMode(events.DeliverSync), events.UsePublish(fake.record)}
+	fake.Factory = events.NewFactory(append(defaults, options...)...)
+	return fake
+}
+
+//Returns the events published to the Topic with the given name so far, ticks and gates' events included.
+func (f *Fake) Published(topicName string) []interface{} {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return append([]interface{}{}, f.published[topicName]...)
+}
+
+//Forgets the events published so far.
+func (f *Fake) Reset() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.published = map[string][]interface{}{}
+}
+
+//the outermost publish interceptor, it records events before other interceptors see them
+func (f *Fake) record(next events.PublishFunc) events.PublishFunc {
+	return func(topicName string, event interface{}) {
+		f.lock.Lock()
+		f.published[topicName] = append(f.published[topicName], event)
+		f.lock.Unlock()
+		next(topicName, event)
+	}
+}
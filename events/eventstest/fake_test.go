@@ -0,0 +1,47 @@
+package eventstest
+
+import (
+	"errors"
+	"github.com/tholowka/pub-sub/events"
+	"github.com/tholowka/testing/assertions"
+	"testing"
+)
+
+func TestThat_Fake_DeliversSynchronously_AndRecordsPublishedEvents(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	factory := NewFake()
+	defer factory.Close()
+	received := []interface{}{}
+	orders := factory.NewTopic("orders", func(event interface{}) {
+		received = append(received, event)
+	})
+	factory.OrGate([]events.Topic{orders})
+	//when
+	orders.NewPublisher()("one")
+	orders.NewPublisher()("two")
+	//then
+	assert.AreEqual([]interface{}{"one", "two"}, received)
+	assert.AreEqual([]interface{}{"one", "two"}, factory.Published("orders"))
+	assert.AreEqual(2, len(factory.Published(factory.Topics()[0].String())))
+	factory.Reset()
+	assert.AreEqual(0, len(factory.Published("orders")))
+}
+
+//a Factory failing to create persistent Topics
+type failingStorage struct {
+	*Fake
+}
+
+func (failingStorage) NewPersistentTopic(string, events.PersistenceOptions, ...events.Subscriber) (events.DurableTopic, error) {
+	return nil, errors.New("The disk is full")
+}
+
+func TestThat_Fake_CanBeStubbed(t *testing.T) {
+	assert := assertions.New(t)
+	var factory events.Factory = failingStorage{NewFake()}
+	defer factory.Close()
+	_, err := factory.NewPersistentTopic("orders", events.PersistenceOptions{})
+	assert.IsTrue(err != nil)
+	Expect(t, factory.NewTopic("payments")).ToReceive()
+}
@@ -0,0 +1,128 @@
+/*
+Helps testing code built on events.Factory and events.Topic: a Recorder is a Subscriber keeping
+what it receives, Expect checks what a Topic receives, and Fake is a Factory delivering events
+synchronously and recording what's published to it.
+
+A test would typically read:
+
+	func TestThat_Orders_AreInvoiced(t *testing.T) {
+		factory := eventstest.NewFake()
+		invoices := eventstest.Expect(t, factory.NewTopic("invoices"))
+		orders := factory.NewTopic("orders", invoicing(factory))
+		orders.NewPublisher()(Order{Id: 42})
+		invoices.ToReceive(Invoice{Order: 42})
+	}
+*/
+package eventstest
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+//how long the helpers wait for events, unless told otherwise
+const defaultTimeout = 5 * time.Second
+
+/*
+An event received by a Recorder, with the time it arrived.
+*/
+type Recorded struct {
+	Event interface{}
+	Time  time.Time
+}
+
+/*
+A Subscriber keeping the events it receives, to be subscribed with its Record method:
+
+	recorder := eventstest.NewRecorder(t)
+	topic.NewSubscriber(recorder.Record)
+
+Failed awaits and assertions fail the test it was created with.
+*/
+type Recorder struct {
+	t        testing.TB
+	lock     sync.Mutex
+	received []Recorded
+	//closed and replaced whenever an event arrives
+	arrived chan struct{}
+}
+
+func NewRecorder(t testing.TB) *Recorder {
+	return &Recorder{t: t, received: []Recorded{}, arrived: make(chan struct{})}
+}
+
+//The Subscriber, records the event.
+func (r *Recorder) Record(event interface{}) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.received = append(r.received, Recorded{event, time.Now()})
+	close(r.arrived)
+	r.arrived = make(chan struct{})
+}
+
+//Returns the events received so far, with the times they arrived.
+func (r *Recorder) Received() []Recorded {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]Recorded{}, r.received...)
+}
+
+//Returns the events received so far.
+func (r *Recorder) Events() []interface{} {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return eventsOf(r.received)
+}
+
+/*
+Waits until the Recorder received n events, and returns the first n. Fails the test if they
+don't arrive within the timeout, returning those which did.
+*/
+func (r *Recorder) AwaitN(n int, timeout time.Duration) []interface{} {
+	r.t.Helper()
+	received, ok := r.await(n, timeout)
+	if !ok {
+		r.t.Fatalf("Expected %v events within %v, received %v: %v", n, timeout, len(received), eventsOf(received))
+		return eventsOf(received)
+	}
+	return eventsOf(received[:n])
+}
+
+//Fails the test if any event arrives within the duration, on top of those received already.
+func (r *Recorder) AssertNoEvents(d time.Duration) {
+	r.t.Helper()
+	r.lock.Lock()
+	before := len(r.received)
+	r.lock.Unlock()
+	if received, arrived := r.await(before+1, d); arrived {
+		r.t.Errorf("Expected no events within %v, received: %v", d, eventsOf(received[before:]))
+	}
+}
+
+//waits until n events were received, returns false on timeout; returns the events received by then
+func (r *Recorder) await(n int, timeout time.Duration) ([]Recorded, bool) {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for {
+		r.lock.Lock()
+		received, arrived := append([]Recorded{}, r.received...), r.arrived
+		r.lock.Unlock()
+		if len(received) >= n {
+			return received, true
+		}
+		select {
+		case <-arrived:
+		case <-deadline.C:
+			return received, false
+		}
+	}
+}
+
+func eventsOf(received []Recorded) []interface{} {
+	events := []interface{}{}
+	for _, recorded := range received {
+		events = append(events, recorded.Event)
+	}
+	return events
+}
@@ -0,0 +1,100 @@
+package eventstest
+
+import (
+	"fmt"
+	"github.com/tholowka/pub-sub/events"
+	"github.com/tholowka/testing/assertions"
+	"sync"
+	"testing"
+	"time"
+)
+
+//a test which collects its failures instead of failing
+type failures struct {
+	testing.TB
+	lock     sync.Mutex
+	messages []string
+}
+
+func (f *failures) Helper() {}
+
+func (f *failures) Errorf(format string, args ...interface{}) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.messages = append(f.messages, fmt.Sprintf(format, args...))
+}
+
+func (f *failures) Fatalf(format string, args ...interface{}) {
+	f.Errorf(format, args...)
+}
+
+func TestThat_Recorder_AwaitsEvents(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	factory := events.NewFactory()
+	defer factory.Close()
+	recorder := NewRecorder(t)
+	topic := factory.NewTopic("orders", recorder.Record)
+	before := time.Now()
+	//when
+	topic.NewPublisher()("one")
+	topic.NewPublisher()("two")
+	received := recorder.AwaitN(2, time.Second)
+	//then
+	assert.AreEqual(2, len(received))
+	for _, recorded := range recorder.Received() {
+		assert.IsTrue(!recorded.Time.Before(before))
+	}
+	recorder.AssertNoEvents(10 * time.Millisecond)
+}
+
+func TestThat_Recorder_FailsTheTest_WhenEventsDontArrive(t *testing.T) {
+	assert := assertions.New(t)
+	test := &failures{}
+	recorder := NewRecorder(test)
+	recorder.Record("one")
+	assert.AreEqual([]interface{}{"one"}, recorder.AwaitN(2, 10*time.Millisecond))
+	assert.AreEqual([]string{"Expected 2 events within 10ms, received 1: [one]"}, test.messages)
+}
+
+func TestThat_Recorder_FailsTheTest_WhenUnexpectedEventsArrive(t *testing.T) {
+	assert := assertions.New(t)
+	test := &failures{}
+	recorder := NewRecorder(test)
+	recorder.Record("one")
+	go recorder.Record("two")
+	recorder.AssertNoEvents(time.Second)
+	assert.AreEqual([]string{"Expected no events within 1s, received: [two]"}, test.messages)
+}
+
+func TestThat_Expect_ChecksTheReceivedEvents_InAnyOrder(t *testing.T) {
+	//given
+	factory := events.NewFactory()
+	defer factory.Close()
+	topic := factory.NewTopic("orders")
+	orders := Expect(t, topic)
+	publisher := topic.NewPublisher()
+	//when
+	publisher(map[string]int{"id": 1})
+	publisher(map[string]int{"id": 2})
+	//then
+	orders.ToReceive(map[string]int{"id": 2}, map[string]int{"id": 1})
+	publisher("three")
+	orders.ToReceive("three")
+}
+
+func TestThat_Expect_FailsTheTest_OnOtherEvents(t *testing.T) {
+	assert := assertions.New(t)
+	test := &failures{}
+	factory := NewFake()
+	defer factory.Close()
+	topic := factory.NewTopic("orders")
+	orders := Expect(test, topic).Within(10 * time.Millisecond)
+	topic.NewPublisher()("one")
+	orders.ToReceive("two")
+	orders.ToReceive("three")
+	assert.AreEqual([]string{
+		"Expected 'orders' to receive [two], got [one]",
+		"Expected 'orders' to receive [three] within 10ms, got []",
+	}, test.messages)
+}
@@ -2,8 +2,9 @@ package events
 
 import (
 	"fmt"
+	"sort"
+	"sync/atomic"
 	"time"
-	// "log"
 )
 const (
 	/*
@@ -12,180 +13,430 @@ const (
 	internalDelay = 5000
 )
 
-func NewFactory() Factory {
+/*
+Customizes a Factory at construction time, see NewFactory.
+*/
+type FactoryOption func(*factory)
+
+//the number of Factories created so far
+var factories uint64
+
+/*
+Makes the Factory use the given Clock for tickers, schedules and re-queue delays,
+instead of the real one. See ManualClock.
+*/
+func WithClock(clock Clock) FactoryOption {
+	return func(t *factory) {
+		t.clock = clock
+	}
+}
+
+func NewFactory(options ...FactoryOption) Factory {
 	topicFactory := &factory{
-		map[string]Topic{},
-		map[string][]Subscriber{},
-		make(chan *eventSpec),
-		make(chan *stateModifierSpec),
-		time.After(time.Duration(internalDelay)),
+		topics:        map[string]registeredTopic{},
+		subscribers:   map[string][]*registeredHandler{},
+		events:        make(chan *eventSpec),
+		stateModifier: make(chan *stateModifierSpec),
+		clock:         NewRealClock(),
+		codecs:        map[string]Codec{},
+		id:            fmt.Sprintf("factory-%v", atomic.AddUint64(&factories, 1)),
+		metrics:       noMetrics{},
+		state:         factoryRunning,
+		done:          make(chan struct{}),
+		requeued:      map[string]int{},
+		delivery:      DeliverAsync,
+		settled:       make(chan struct{}, 1),
+	}
+	for _, option := range options {
+		option(topicFactory)
 	}
 	<-runFactory(topicFactory)
 	return topicFactory
 }
 
 type factory struct {
-	topics        map[string]Topic
-	subscribers   map[string][]Subscriber
+	topics        map[string]registeredTopic
+	subscribers   map[string][]*registeredHandler
 	events        chan *eventSpec
 	stateModifier chan *stateModifierSpec
-	internalClock <-chan time.Time
+	clock         Clock
+	storage       string
+	codecs        map[string]Codec
+	//identifies the Factory in the hops of bridged events
+	id           string
+	brokers      []brokerRoute
+	errorHandler func(error)
+	metrics      Metrics
+	//the number of go-routines running Subscribers, accessed atomically
+	inFlight int32
+	//the number of events on their way to the factory's go-routine, accessed atomically
+	queued int32
+	//see factoryRunning, accessed atomically
+	state int32
+	//closed once the factory's go-routine returned
+	done chan struct{}
+	//the number of go-routines owned by the factory (see spawn), accessed atomically
+	routines int32
+	//the number of events rejected while shutting down, accessed atomically
+	rejected int32
+	logger   Logger
+	tracer   Tracer
+	//see UsePublish and UseSubscribe
+	interceptions []interception
+	//events waiting to be requeued, per topic name; owned by the factory's go-routine
+	requeued map[string]int
+	//bridges from the Topics of the Factory, see Topology
+	bridges []bridgeRoute
+	//see WithDeliveryMode
+	delivery DeliveryMode
+	//signalled whenever a counter Shutdown waits for goes down, see settle
+	settled chan struct{}
+	//the number of gates created so far, which makes their names unique; owned by the factory's go-routine
+	gates uint64
 }
 
 func (t *factory) NewTopic(topicName string, subscribers ...Subscriber) Topic {
-	topic := &simpleTopic{t, topicName, nil}
+	return t.registerTopic(&simpleTopic{p: t, name: topicName, closedSignal: newClosedSignal()}, subscribers)
+}
+
+func (t *factory) NewRetainedTopic(topicName string, retain int, subscribers ...Subscriber) Topic {
+	return t.registerTopic(&simpleTopic{p: t, name: topicName, history: newHistory(retain), replayByDefault: true, closedSignal: newClosedSignal()}, subscribers)
+}
+
+func (t *factory) NewReplayTopic(topicName string, capacity int, subscribers ...Subscriber) Topic {
+	return t.registerTopic(&simpleTopic{p: t, name: topicName, history: newHistory(capacity), closedSignal: newClosedSignal()}, subscribers)
+}
+
+func (t *factory) registerTopic(simple *simpleTopic, subscribers []Subscriber) Topic {
+	topicName := simple.name
+	var topic registeredTopic = simple
+	delegated := (*brokerTopic)(nil)
+	if broker := t.brokerFor(topicName); broker != nil {
+		delegated = newBrokerTopic(simple, broker)
+		topic = delegated
+	}
 	stateChanged := make(chan bool)
 	adder := func(state *factory) {
 		state.topics[topicName] = topic
-		if len(subscribers) > 0 {
-			state.subscribers[topicName] = subscribers
-		} else {
-			state.subscribers[topicName] = []Subscriber{}
-		}
+		state.subscribers[topicName] = newHandlers(subscribers)
+		state.topicOpened(topicName, kindOf(simple))
 	}
-	t.stateModifier <- &stateModifierSpec{adder, stateChanged, false}
-	<-stateChanged
+	registered := t.modify(&stateModifierSpec{adder, stateChanged, false})
 	close(stateChanged)
+	if !registered {
+		simple.signalClosed()
+	} else if delegated != nil {
+		delegated.subscribe()
+	}
 	return topic
 }
 
-func (t *factory) NewTickerTopic(topicName string, interval time.Duration) Topic {
-	topic := &tickerTopic{t, topicName, time.NewTicker(interval), make(chan bool)}
+func (t *factory) NewTickerTopic(topicName string, interval time.Duration, options ...TickerOption) TickerTopic {
+	topic := &tickerTopic{
+		p:            t,
+		name:         topicName,
+		ticker:       t.clock.NewTicker(interval),
+		closeChannel: make(chan bool),
+		control:      make(chan func()),
+		interval:     interval,
+		closedSignal: newClosedSignal(),
+	}
+	for _, option := range options {
+		option(topic)
+	}
 	stateChanged := make(chan bool)
 	adder := func(state *factory) {
 		state.topics[topicName] = topic
-		state.subscribers[topicName] = []Subscriber{}
+		state.subscribers[topicName] = []*registeredHandler{}
+		state.topicOpened(topicName, "ticker")
 		<-runTicker(topic, t)
 	}
-	t.stateModifier <- &stateModifierSpec{adder, stateChanged, false}
-	<-stateChanged
+	registered := t.modify(&stateModifierSpec{adder, stateChanged, false})
+	close(stateChanged)
+	if !registered {
+		topic.ticker.Stop()
+		topic.signalClosed()
+	}
+	return topic
+}
+
+func (t *factory) NewScheduleTopic(topicName string, expression string) (Topic, error) {
+	cron, err := parseCronSchedule(expression)
+	if err != nil {
+		return nil, err
+	}
+	return t.newScheduleTopic(topicName, cron), nil
+}
+
+func (t *factory) NewTimerTopic(topicName string, at time.Time) Topic {
+	return t.newScheduleTopic(topicName, &timerSchedule{at: at})
+}
+
+func (t *factory) NewJitteredTickerTopic(topicName string, interval time.Duration, jitter time.Duration) (Topic, error) {
+	jittered, err := newJitterSchedule(interval, jitter)
+	if err != nil {
+		return nil, err
+	}
+	return t.newScheduleTopic(topicName, jittered), nil
+}
+
+func (t *factory) newScheduleTopic(topicName string, schedule schedule) Topic {
+	topic := &scheduleTopic{p: t, name: topicName, schedule: schedule, closeChannel: make(chan bool), control: make(chan func()), closedSignal: newClosedSignal()}
+	stateChanged := make(chan bool)
+	adder := func(state *factory) {
+		state.topics[topicName] = topic
+		state.subscribers[topicName] = []*registeredHandler{}
+		state.topicOpened(topicName, "schedule")
+		<-runSchedule(topic, t)
+	}
+	registered := t.modify(&stateModifierSpec{adder, stateChanged, false})
 	close(stateChanged)
+	if !registered {
+		topic.signalClosed()
+	}
 	return topic
 }
 
+//gate Subscribers receive envelopes, so that the gate's events continue the trace of the event completing them
 func (t *factory) buildAndGateSubscriber(andTopic *simpleTopic, topic Topic, topics []Topic) Subscriber {
 	return func(event interface{}) {
+		envelope := event.(*Envelope)
+		var completed map[string][]interface{}
 		stateChanged := make(chan bool)
 		stateModifier := func(pt *factory) {
 			results := andTopic.optionalState.(map[string][]interface{})
-			results[topic.String()] = append(results[topic.String()], event)
+			results[topic.String()] = append(results[topic.String()], envelope.Event)
 			if len(results) == len(topics) {
-				andTopic.NewPublisher()(copyAside(results))
+				completed = copyAside(results)
 				andTopic.optionalState = map[string][]interface{}{}
 			} else {
 				andTopic.optionalState = results
 			}
 		}
-		t.stateModifier <- &stateModifierSpec{stateModifier, stateChanged, false}
-		<-stateChanged
+		t.modify(&stateModifierSpec{stateModifier, stateChanged, false})
 		close(stateChanged)
+		//published outside of the factory's go-routine, as it may deliver inline (see DeliverSync)
+		if completed != nil {
+			andTopic.NewPublisher()(WithinSpan(envelope.Trace, completed))
+		}
 	}
 }
 
 func (t *factory) buildOrGateSubscriber(orTopic *simpleTopic, topic Topic, topics []Topic) Subscriber {
 	return func(event interface{}) {
+		envelope := event.(*Envelope)
+		var completed map[string][]interface{}
 		stateChanged := make(chan bool)
 		stateModifier := func(pt *factory) {
 			results := orTopic.optionalState.(map[string][]interface{})
-			results[topic.String()] = append(results[topic.String()], event)
-			orTopic.NewPublisher()(copyAside(results))
+			results[topic.String()] = append(results[topic.String()], envelope.Event)
+			completed = copyAside(results)
 			orTopic.optionalState = map[string][]interface{}{}
 		}
-		t.stateModifier <- &stateModifierSpec{stateModifier, stateChanged, false}
-		<-stateChanged
+		t.modify(&stateModifierSpec{stateModifier, stateChanged, false})
 		close(stateChanged)
+		if completed != nil {
+			orTopic.NewPublisher()(WithinSpan(envelope.Trace, completed))
+		}
 	}
 }
 
-func (t *factory) buildGateTopic(topics []Topic, subscriberFactory func(*simpleTopic, Topic, []Topic) Subscriber, separator string, subscribers []Subscriber) Topic {
+func (t *factory) buildGateTopic(topics []Topic, subscriberFactory func(*simpleTopic, Topic, []Topic) Subscriber, separator string, operator string, subscribers []Subscriber) Topic {
 	var (
 		newTopic *simpleTopic
 	)
 	stateChanged := make(chan bool)
 	adder := func(p *factory) {
 		topicName := ""
+		p.gates++
 		for _, topic := range topics {
 			if topicName == "" {
-				topicName = fmt.Sprintf("[%v] gate of: %v", time.Now(), topic.String())
+				topicName = fmt.Sprintf("[%v] gate of: %v", p.gates, topic.String())
 			} else {
 				topicName = topicName + separator + topic.String()
 			}
 		}
-		newTopic = &simpleTopic{t, topicName, map[string][]interface{}{}}
-		p.topics[topicName] = newTopic
-		if len(subscribers) == 0 {
-			p.subscribers[topicName] = []Subscriber{}
-		} else {
-			p.subscribers[topicName] = subscribers
+		inputs := &gateInputs{operator, []string{}}
+		for _, topic := range topics {
+			inputs.inputs = append(inputs.inputs, topic.String())
 		}
+		newTopic = &simpleTopic{p: t, name: topicName, optionalState: map[string][]interface{}{}, gate: inputs, closedSignal: newClosedSignal()}
+		p.topics[topicName] = newTopic
+		p.subscribers[topicName] = newHandlers(subscribers)
+		p.topicOpened(topicName, "gate")
 		for _, topic := range topics {
 			//adding subscribers manually as it avoids deadlock (if used with plain 'topic.NewSubscriber()'), or
 			//introducing hard-to-catch bug (if used with 'go topic.NewSubscriber()')
-			p.subscribers[topic.String()] = append(p.subscribers[topic.String()], subscriberFactory(newTopic, topic, topics))
+			gateHandler := newHandler(subscriberFactory(newTopic, topic, topics), &subscribeOptions{envelope: true})
+			p.subscribers[topic.String()] = append(p.subscribers[topic.String()], &registeredHandler{handle: gateHandler})
 		}
 	}
-	t.stateModifier <- &stateModifierSpec{adder, stateChanged, false}
-	<-stateChanged
+	t.modify(&stateModifierSpec{adder, stateChanged, false})
 	close(stateChanged)
 	return newTopic
 }
 
 func (t *factory) OrGate(topics []Topic, subscribers ...Subscriber) Topic {
-	return t.buildGateTopic(topics, t.buildOrGateSubscriber, " | ", subscribers)
+	return t.buildGateTopic(topics, t.buildOrGateSubscriber, " | ", "or", subscribers)
 }
 
 func (t *factory) AndGate(topics []Topic, subscribers ...Subscriber) Topic {
-	return t.buildGateTopic(topics, t.buildAndGateSubscriber, " & ", subscribers)
+	return t.buildGateTopic(topics, t.buildAndGateSubscriber, " & ", "and", subscribers)
 }
 
 func (t *factory) Close() error {
-	//we close topics manually here, otherwise you may get a deadlock
+	//we detach topics here rather than calling their Close, otherwise you may get a deadlock
+	releases := []func() error{}
 	stateChanged := make(chan bool)
 	closer := func(p *factory) {
-		for _, topic := range t.topics {
-			delete(t.topics, topic.String())
-			delete(t.subscribers, topic.String())
+		for _, topic := range p.topics {
+			if release := topic.detach(p); release != nil {
+				releases = append(releases, release)
+			}
 		}
+		p.advance(factoryClosed)
+		p.log(LevelInfo, "Factory closed", "factory", p.id)
 	}
-	t.stateModifier <- &stateModifierSpec{closer, stateChanged, true}
-	<-stateChanged
+	t.modify(&stateModifierSpec{closer, stateChanged, true})
 	close(stateChanged)
-	return nil
+	var err error
+	for _, release := range releases {
+		if releaseErr := release(); err == nil {
+			err = releaseErr
+		}
+	}
+	return err
+}
+
+//must run in the factory's go-routine; removes the Topic (and its bridges), unless another one replaced it
+func (state *factory) removeTopic(topic Topic) {
+	name := topic.String()
+	if state.topics[name] == topic {
+		delete(state.topics, name)
+		delete(state.subscribers, name)
+	}
+	open := []bridgeRoute{}
+	for _, bridge := range state.bridges {
+		if bridge.topic != topic {
+			open = append(open, bridge)
+		}
+	}
+	state.bridges = open
+	state.topicClosed(name)
 }
 
+func (t *factory) Lookup(topicName string) (Topic, bool) {
+	var (
+		topic  Topic
+		exists bool
+	)
+	stateChanged := make(chan bool)
+	reader := func(p *factory) {
+		topic, exists = p.topics[topicName]
+	}
+	t.modify(&stateModifierSpec{reader, stateChanged, false})
+	close(stateChanged)
+	return topic, exists
+}
+
+func (t *factory) Topics() []Topic {
+	topics := topicsByName{}
+	stateChanged := make(chan bool)
+	reader := func(p *factory) {
+		for _, topic := range p.topics {
+			topics = append(topics, topic)
+		}
+	}
+	t.modify(&stateModifierSpec{reader, stateChanged, false})
+	close(stateChanged)
+	sort.Sort(topics)
+	return topics
+}
+
+type topicsByName []Topic
+
+func (s topicsByName) Len() int           { return len(s) }
+func (s topicsByName) Less(i, j int) bool { return s[i].String() < s[j].String() }
+func (s topicsByName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
 func (t *factory) String() string {
 	return fmt.Sprintf("Topic-factory {size=%v}", len(t.topics))
 }
 
 func runFactory(p *factory) <-chan bool {
 	releaser := make(chan bool)
-	go func() {
+	p.spawn(func() {
 		close(releaser)
+		//the channels stay open: senders select on done instead (see modify and handOver)
+		defer close(p.done)
 		for {
 			select {
 			case stateChange := <-p.stateModifier:
 				stateChange.modifier(p)
+				p.measureState()
 				stateChange.stateChanged <- true
 				if stateChange.kill {
-					break
+					return
 				}
 			case event := <-p.events:
-				if subscribers, subscribersExist := p.subscribers[event.name]; subscribersExist {
-					for _, subscriber := range subscribers {
-						//note: if subscriber sends something to a channel we don't want to be blocked.
-						go subscriber(event.event)
-					}
-				} else {
-					go p.reQueue(event)
+				for _, delivery := range p.dispatch(event) {
+					//note: if subscriber sends something to a channel we don't want to be blocked.
+					go delivery()
 				}
+				//subscriber go-routines are counted in flight by now, see Shutdown
+				p.settle(&p.queued, 1)
 			}
 		}
-		close(p.events)
-		close(p.stateModifier)
-	}()
+	})
 	return releaser
 }
 
+//must run in the factory's go-routine; returns the deliveries of the event to its Subscribers, counted in flight already
+func (p *factory) dispatch(event *eventSpec) []func() {
+	deliveries := []func(){}
+	if event.delay > 0 {
+		p.countRequeued(event, -1)
+	}
+	if subscribers, subscribersExist := p.subscribers[event.name]; subscribersExist {
+		envelope := event.envelope
+		if envelope == nil {
+			envelope = &Envelope{event.name, 0, p.clock.Now(), event.event, nil, event.trace, nil}
+		}
+		if recorder, isRecorder := p.topics[event.name].(eventRecorder); isRecorder && !recorder.record(envelope) {
+			return deliveries
+		}
+		handled := func() {}
+		if observer, observes := p.topics[event.name].(handlingObserver); observes && len(subscribers) > 0 {
+			remaining := int32(len(subscribers))
+			handled = func() {
+				if atomic.AddInt32(&remaining, -1) == 0 {
+					observer.handled(envelope)
+				}
+			}
+		}
+		for _, subscriber := range subscribers {
+			p.metrics.Gauge(MetricInFlight, "", float64(atomic.AddInt32(&p.inFlight, 1)))
+			subscriber := subscriber
+			deliveries = append(deliveries, func() {
+				p.deliver(event.name, subscriber.handle, envelope)
+				handled()
+			})
+		}
+	} else if event.delay >= 0 {
+		p.metrics.Count(MetricRequeued, event.name, 1)
+		p.log(LevelDebug, "Event requeued", "topic", event.name, "delay", event.delay)
+		p.traceRequeue(event)
+		p.countRequeued(event, 1)
+		p.spawn(func() {
+			p.reQueue(event)
+		})
+	} else {
+		p.metrics.Count(MetricDropped, event.name, 1)
+		p.log(LevelWarn, "Event dropped", "topic", event.name)
+	}
+	return deliveries
+}
+
 func (t *factory) reQueue(e *eventSpec) {
 	delay := e.delay
 	if delay >= 0 {
@@ -193,14 +444,18 @@ func (t *factory) reQueue(e *eventSpec) {
 			if delay < 0 {
 				break
 			}
-			<-t.internalClock
+			select {
+			case <-t.clock.After(time.Duration(internalDelay)):
+			case <-t.done:
+				return
+			}
 			delay = delay - internalDelay
 		}
 		newDelay := 2*e.delay
 		if newDelay == 0 {
 			newDelay = internalDelay
 		}
-		t.events <- &eventSpec { e.name, e.event, newDelay }
+		t.send(&eventSpec { e.name, e.event, newDelay, e.envelope, e.trace })
 	}
 }
 
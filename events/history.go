@@ -0,0 +1,103 @@
+package events
+
+import (
+	"sync/atomic"
+)
+
+/*
+Keeps track of the most recent event of a Topic, and of the offsets of its events. Topics
+embedding it are notified by runFactory of every event dispatched to them, hence it is
+only accessed from the factory's go-routine.
+*/
+type lastEvent struct {
+	event      interface{}
+	exists     bool
+	nextOffset uint64
+}
+
+//a Topic which wants to be told about the events dispatched to it,
+//and which may decide the event should not be dispatched after all
+type eventRecorder interface {
+	record(envelope *Envelope) bool
+}
+
+//a Topic which wants to be told once every Subscriber an event was dispatched to has returned
+type handlingObserver interface {
+	handled(envelope *Envelope)
+}
+
+func (l *lastEvent) record(envelope *Envelope) bool {
+	envelope.Offset = l.nextOffset
+	l.nextOffset++
+	l.event = envelope.Event
+	l.exists = true
+	return true
+}
+
+/*
+A bounded history of events, kept in a ring buffer: once it's full, the newest event
+overwrites the oldest one.
+*/
+type history struct {
+	capacity  int
+	envelopes []*Envelope
+	//the index of the oldest event, once the buffer is full
+	head int
+}
+
+func newHistory(capacity int) *history {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &history{capacity: capacity}
+}
+
+func (h *history) record(envelope *Envelope) {
+	if len(h.envelopes) < h.capacity {
+		h.envelopes = append(h.envelopes, envelope)
+		return
+	}
+	h.envelopes[h.head] = envelope
+	h.head = (h.head + 1) % h.capacity
+}
+
+//returns the kept events at or past the position, oldest first; safe to use outside the factory's go-routine
+func (h *history) since(from *position) []*Envelope {
+	result := []*Envelope{}
+	for i := range h.envelopes {
+		envelope := h.envelopes[(h.head+i)%len(h.envelopes)]
+		if from.reached(envelope) {
+			result = append(result, envelope)
+		}
+	}
+	return result
+}
+
+/*
+Wraps a handler so that it first receives the given events, and only then live ones.
+Live events arriving in the meantime wait for the replay to finish, and live events
+before the position (e.g. a future offset) are skipped. The replayed events go through
+deliver like live ones, counted in flight right away; must run in the factory's go-routine.
+*/
+func (p *factory) replayingHandler(topicName string, next handler, replay []*Envelope, from *position) handler {
+	replayed := make(chan bool)
+	p.metrics.Gauge(MetricInFlight, "", float64(atomic.AddInt32(&p.inFlight, int32(len(replay)))))
+	p.spawn(func() {
+		defer close(replayed)
+		for i, envelope := range replay {
+			select {
+			case <-p.done:
+				p.metrics.Gauge(MetricInFlight, "", float64(p.settle(&p.inFlight, int32(len(replay)-i))))
+				return
+			default:
+				p.deliver(topicName, next, envelope)
+			}
+		}
+	})
+	return func(envelope *Envelope) {
+		<-replayed
+		if from.reached(envelope) {
+			next(envelope)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package events
+
+import (
+	"context"
+	"github.com/tholowka/testing/assertions"
+	"testing"
+	"time"
+)
+
+func TestThat_History_KeepsTheMostRecentEvents(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	recent := newHistory(2)
+	offsets := &lastEvent{}
+	//when
+	for _, event := range []string{"one", "two", "three"} {
+		envelope := &Envelope{Event: event}
+		offsets.record(envelope)
+		recent.record(envelope)
+	}
+	//then
+	kept := recent.since(&position{beginning: true})
+	assert.AreEqual(2, len(kept))
+	assert.AreEqual(&Envelope{Offset: 1, Event: "two"}, kept[0])
+	assert.AreEqual(&Envelope{Offset: 2, Event: "three"}, kept[1])
+	assert.AreEqual(1, len(recent.since(&position{offset: 2})))
+}
+
+func TestThat_RetainedTopic_ReplaysToNewSubscribers(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	delivered := make(chan bool)
+	topic := NewFactory().NewRetainedTopic("config", 2, func(interface{}) {
+		delivered <- true
+	})
+	publisher := topic.NewPublisher()
+	for _, event := range []string{"one", "two", "three"} {
+		publisher(event)
+		<-delivered
+	}
+	channel := make(chan interface{})
+	//when
+	topic.NewSubscriber(func(event interface{}) {
+		channel <- event
+	})
+	publisher("four")
+	<-delivered
+	//then replayed events come first
+	assert.AreEqual("two", <-channel)
+	assert.AreEqual("three", <-channel)
+	assert.AreEqual("four", <-channel)
+	topic.Close()
+}
+
+func TestThat_Last_ReturnsTheMostRecentEvent(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	delivered := make(chan bool)
+	topic := NewFactory().NewTopic("status", func(interface{}) {
+		delivered <- true
+	})
+	_, exists := topic.Last()
+	assert.IsTrue(!exists)
+	//when
+	topic.NewPublisher()("up")
+	<-delivered
+	//then
+	last, exists := topic.Last()
+	assert.IsTrue(exists)
+	assert.AreEqual("up", last)
+	topic.Close()
+}
+
+func TestThat_ReplayTopic_DeliversOnlyLiveEvents_ByDefault(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	delivered := make(chan bool)
+	topic := NewFactory().NewReplayTopic("orders", 10, func(interface{}) {
+		delivered <- true
+	})
+	publisher := topic.NewPublisher()
+	publisher("one")
+	<-delivered
+	channel := make(chan interface{})
+	//when
+	topic.NewSubscriber(func(event interface{}) {
+		channel <- event
+	})
+	publisher("two")
+	<-delivered
+	//then
+	assert.AreEqual("two", <-channel)
+	topic.Close()
+}
+
+func TestThat_ReplayTopic_CatchesUpFromAPosition(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	clock := NewManualClock(epoch)
+	delivered := make(chan bool)
+	topic := NewFactory(WithClock(clock)).NewReplayTopic("orders", 10, func(interface{}) {
+		delivered <- true
+	})
+	publisher := topic.NewPublisher()
+	for _, event := range []string{"zero", "one", "two"} {
+		publisher(event)
+		<-delivered
+		clock.Advance(time.Minute)
+	}
+	fromBeginning := make(chan interface{}, 10)
+	fromOffset := make(chan interface{}, 10)
+	fromTime := make(chan interface{}, 10)
+	//when
+	topic.NewSubscriber(func(event interface{}) {
+		fromBeginning <- event
+	}, FromBeginning())
+	topic.NewSubscriber(func(event interface{}) {
+		fromOffset <- event
+	}, FromOffset(2), WithEnvelope())
+	topic.NewSubscriber(func(event interface{}) {
+		fromTime <- event
+	}, FromTime(epoch.Add(time.Minute)))
+	publisher("three")
+	<-delivered
+	//then
+	for _, expected := range []string{"zero", "one", "two", "three"} {
+		assert.AreEqual(expected, <-fromBeginning)
+	}
+	assert.AreEqual(&Envelope{"orders", 2, epoch.Add(2 * time.Minute), "two", nil, SpanContext{}, nil}, <-fromOffset)
+	assert.AreEqual(&Envelope{"orders", 3, epoch.Add(3 * time.Minute), "three", nil, SpanContext{}, nil}, <-fromOffset)
+	for _, expected := range []string{"one", "two", "three"} {
+		assert.AreEqual(expected, <-fromTime)
+	}
+	topic.Close()
+}
+
+func TestThat_ReplayTopic_SkipsLiveEvents_BeforeAFutureOffset(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	delivered := make(chan bool)
+	topic := NewFactory().NewReplayTopic("orders", 10, func(interface{}) {
+		delivered <- true
+	})
+	publisher := topic.NewPublisher()
+	channel := make(chan interface{}, 10)
+	topic.NewSubscriber(func(event interface{}) {
+		channel <- event
+	}, FromOffset(1))
+	//when
+	publisher("zero")
+	<-delivered
+	publisher("one")
+	<-delivered
+	//then
+	assert.AreEqual("one", <-channel)
+	assert.AreEqual(0, len(channel))
+	topic.Close()
+}
+
+func TestThat_History_WrapsAround(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	recent := newHistory(3)
+	offsets := &lastEvent{}
+	//when
+	for _, event := range []string{"zero", "one", "two", "three", "four", "five", "six", "seven"} {
+		envelope := &Envelope{Event: event}
+		offsets.record(envelope)
+		recent.record(envelope)
+	}
+	//then
+	kept := []interface{}{}
+	for _, envelope := range recent.since(&position{beginning: true}) {
+		kept = append(kept, envelope.Event)
+	}
+	assert.AreEqual([]interface{}{"five", "six", "seven"}, kept)
+	assert.AreEqual(3, len(recent.envelopes))
+}
+
+func TestThat_ReplayedEvents_GoThroughSubscribeInterceptors(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	intercepted := make(chan interface{}, 10)
+	delivered := make(chan bool)
+	f := NewFactory(UseSubscribe(func(next SubscribeFunc) SubscribeFunc {
+		return func(envelope *Envelope) {
+			intercepted <- envelope.Event
+			next(envelope)
+		}
+	}))
+	topic := f.NewReplayTopic("orders", 10, func(interface{}) {
+		delivered <- true
+	})
+	topic.NewPublisher()("zero")
+	<-delivered
+	assert.AreEqual("zero", <-intercepted)
+	replayed := make(chan interface{})
+	//when
+	topic.NewSubscriber(func(event interface{}) {
+		replayed <- event
+	}, FromBeginning())
+	//then
+	assert.AreEqual("zero", <-replayed)
+	assert.AreEqual("zero", <-intercepted)
+	report, err := f.Shutdown(context.Background())
+	assert.IsTrue(err == nil)
+	assert.IsTrue(!report.Abandoned())
+}
@@ -0,0 +1,247 @@
+/*
+Exposes the Topics of an events.Factory over HTTP, for dashboards and quick integrations:
+
+	GET  /topics               lists the open Topics, as a JSON array of {"name": ...} objects
+	POST /topics/{name}        publishes the (JSON) body of the request to the Topic
+	GET  /topics/{name}/events streams the events of the Topic as Server-Sent Events
+
+Topic names containing a slash have to be escaped (as %2F). The Handler can be mounted under
+any prefix of an http.ServeMux, with http.StripPrefix:
+
+	mux.Handle("/events/", http.StripPrefix("/events", httpgateway.NewHandler(factory)))
+
+Every Server-Sent Event carries the offset of the event as its id, and the event encoded as
+its data. Streams of Topics keeping a history (see Factory.NewReplayTopic) can be resumed: a
+reconnecting EventSource sends the Last-Event-ID header, and the stream continues after that
+event. A stream can also start at ?offset=N, or ?from=beginning.
+*/
+package httpgateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/tholowka/pub-sub/events"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultKeepAlive = 30 * time.Second
+	//the number of events waiting to be written to a stream, before Subscribers block
+	streamedEvents = 64
+)
+
+/*
+Serves the Topics of a Factory, see the package documentation for the routes.
+*/
+type Handler struct {
+	factory   events.Factory
+	codecs    map[string]events.Codec
+	keepAlive time.Duration
+}
+
+/*
+Customizes a Handler at construction time, see NewHandler.
+*/
+type Option func(*Handler)
+
+/*
+Makes the Handler decode published bodies, and encode streamed events, of the Topic with
+the given name using the Codec, instead of the one the Factory uses for it (see events.WithCodec).
+As events are streamed as text, it should produce text, as JSON does.
+*/
+func WithCodec(topicName string, codec events.Codec) Option {
+	return func(h *Handler) {
+		h.codecs[topicName] = codec
+	}
+}
+
+/*
+Sets how often a comment is sent on idle streams, to keep proxies from closing them. 30 seconds by default.
+*/
+func WithKeepAlive(interval time.Duration) Option {
+	return func(h *Handler) {
+		h.keepAlive = interval
+	}
+}
+
+func NewHandler(factory events.Factory, options ...Option) *Handler {
+	handler := &Handler{factory, map[string]events.Codec{}, defaultKeepAlive}
+	for _, option := range options {
+		option(handler)
+	}
+	return handler
+}
+
+func (h *Handler) codecFor(topicName string) events.Codec {
+	if codec, exists := h.codecs[topicName]; exists {
+		return codec
+	}
+	return h.factory.CodecFor(topicName)
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.EscapedPath()
+	if path == "/topics" || path == "/topics/" {
+		h.allow(w, r, "GET", h.list)
+		return
+	}
+	if !strings.HasPrefix(path, "/topics/") {
+		http.NotFound(w, r)
+		return
+	}
+	segments := strings.Split(strings.TrimPrefix(path, "/topics/"), "/")
+	topicName, err := url.PathUnescape(segments[0])
+	if err != nil || topicName == "" {
+		http.NotFound(w, r)
+		return
+	}
+	switch {
+	case len(segments) == 1:
+		h.allow(w, r, "POST", func(w http.ResponseWriter, r *http.Request) {
+			h.publish(w, r, topicName)
+		})
+	case len(segments) == 2 && segments[1] == "events":
+		h.allow(w, r, "GET", func(w http.ResponseWriter, r *http.Request) {
+			h.stream(w, r, topicName)
+		})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *Handler) allow(w http.ResponseWriter, r *http.Request, method string, serve http.HandlerFunc) {
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	serve(w, r)
+}
+
+func (h *Handler) lookup(w http.ResponseWriter, topicName string) (events.Topic, bool) {
+	topic, exists := h.factory.Lookup(topicName)
+	if !exists {
+		http.Error(w, fmt.Sprintf("No topic named '%v'", topicName), http.StatusNotFound)
+	}
+	return topic, exists
+}
+
+type topicDescription struct {
+	Name string `json:"name"`
+}
+
+func (h *Handler) list(w http.ResponseWriter, r *http.Request) {
+	topics := []topicDescription{}
+	for _, topic := range h.factory.Topics() {
+		topics = append(topics, topicDescription{topic.String()})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(topics)
+}
+
+func (h *Handler) publish(w http.ResponseWriter, r *http.Request, topicName string) {
+	topic, exists := h.lookup(w, topicName)
+	if !exists {
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	event, err := h.codecFor(topicName).Decode(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	topic.NewPublisher()(event)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *Handler) stream(w http.ResponseWriter, r *http.Request, topicName string) {
+	flusher, canFlush := w.(http.Flusher)
+	if !canFlush {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	options, err := startOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	topic, exists := h.lookup(w, topicName)
+	if !exists {
+		return
+	}
+	done := r.Context().Done()
+	envelopes := make(chan *events.Envelope, streamedEvents)
+	//the Subscriber is removed once the request is done
+	subscription := events.NewSubscription()
+	defer subscription.Unsubscribe()
+	topic.NewSubscriber(func(event interface{}) {
+		select {
+		case envelopes <- event.(*events.Envelope):
+		case <-done:
+		}
+	}, append(options, events.WithEnvelope(), events.WithSubscription(subscription))...)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	codec := h.codecFor(topicName)
+	keepAlive := time.NewTicker(h.keepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case envelope := <-envelopes:
+			data, err := codec.Encode(envelope.Event)
+			if err != nil {
+				fmt.Fprintf(w, ": %v\n\n", strings.Replace(err.Error(), "\n", " ", -1))
+				break
+			}
+			fmt.Fprintf(w, "id: %v\n", envelope.Offset)
+			for _, line := range bytes.Split(data, []byte("\n")) {
+				fmt.Fprintf(w, "data: %s\n", line)
+			}
+			fmt.Fprint(w, "\n")
+		}
+		flusher.Flush()
+	}
+}
+
+//where the stream starts, see the package documentation
+func startOptions(r *http.Request) ([]events.SubscribeOption, error) {
+	if lastId := r.Header.Get("Last-Event-ID"); lastId != "" {
+		offset, err := strconv.ParseUint(lastId, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid Last-Event-ID '%v'", lastId)
+		}
+		return []events.SubscribeOption{events.FromOffset(offset + 1)}, nil
+	}
+	query := r.URL.Query()
+	if offset := query.Get("offset"); offset != "" {
+		from, err := strconv.ParseUint(offset, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid offset '%v'", offset)
+		}
+		return []events.SubscribeOption{events.FromOffset(from)}, nil
+	}
+	switch from := query.Get("from"); from {
+	case "":
+		return []events.SubscribeOption{}, nil
+	case "beginning":
+		return []events.SubscribeOption{events.FromBeginning()}, nil
+	default:
+		return nil, fmt.Errorf("Invalid start '%v', only 'beginning' is supported", from)
+	}
+}
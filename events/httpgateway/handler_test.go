@@ -0,0 +1,172 @@
+package httpgateway
+
+import (
+	"bufio"
+	"github.com/tholowka/pub-sub/events"
+	"github.com/tholowka/testing/assertions"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+//reads the next Server-Sent Event, skipping comments
+func readEvent(reader *bufio.Reader) []string {
+	lines := []string{}
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return lines
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && len(lines) > 0:
+			return lines
+		case line == "" || strings.HasPrefix(line, ":"):
+		default:
+			lines = append(lines, line)
+		}
+	}
+}
+
+func TestThat_Handler_ListsTopics(t *testing.T) {
+	assert := assertions.New(t)
+	factory := events.NewFactory()
+	factory.NewTopic("payments")
+	factory.NewTopic("orders")
+	server := httptest.NewServer(NewHandler(factory))
+	defer server.Close()
+	response, err := http.Get(server.URL + "/topics")
+	assert.IsTrue(err == nil)
+	body, _ := ioutil.ReadAll(response.Body)
+	assert.AreEqual("application/json", response.Header.Get("Content-Type"))
+	assert.AreEqual(`[{"name":"orders"},{"name":"payments"}]`+"\n", string(body))
+}
+
+func TestThat_Handler_PublishesPostedBodies(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	factory := events.NewFactory()
+	received := make(chan interface{})
+	factory.NewTopic("orders", func(event interface{}) {
+		received <- event
+	})
+	server := httptest.NewServer(NewHandler(factory))
+	defer server.Close()
+	//when
+	response, err := http.Post(server.URL+"/topics/orders", "application/json", strings.NewReader(`{"id":42}`))
+	//then
+	assert.IsTrue(err == nil)
+	assert.AreEqual(http.StatusAccepted, response.StatusCode)
+	assert.AreEqual(map[string]interface{}{"id": float64(42)}, <-received)
+}
+
+func TestThat_Handler_Rejects_UnknownTopics_AndInvalidBodies(t *testing.T) {
+	assert := assertions.New(t)
+	factory := events.NewFactory()
+	factory.NewTopic("orders")
+	server := httptest.NewServer(NewHandler(factory))
+	defer server.Close()
+	response, _ := http.Post(server.URL+"/topics/missing", "application/json", strings.NewReader(`1`))
+	assert.AreEqual(http.StatusNotFound, response.StatusCode)
+	response, _ = http.Post(server.URL+"/topics/orders", "application/json", strings.NewReader(`{`))
+	assert.AreEqual(http.StatusBadRequest, response.StatusCode)
+	response, _ = http.Get(server.URL + "/topics/orders")
+	assert.AreEqual(http.StatusMethodNotAllowed, response.StatusCode)
+}
+
+func TestThat_Handler_StreamsEvents(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	factory := events.NewFactory()
+	topic := factory.NewTopic("orders")
+	server := httptest.NewServer(NewHandler(factory))
+	defer server.Close()
+	response, err := http.Get(server.URL + "/topics/orders/events")
+	assert.IsTrue(err == nil)
+	defer response.Body.Close()
+	assert.AreEqual("text/event-stream", response.Header.Get("Content-Type"))
+	//when
+	topic.NewPublisher()(map[string]interface{}{"id": 42})
+	//then
+	assert.AreEqual([]string{"id: 0", `data: {"id":42}`}, readEvent(bufio.NewReader(response.Body)))
+}
+
+func TestThat_Handler_RemovesTheSubscriber_WhenTheStreamEnds(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	factory := events.NewFactory()
+	factory.NewTopic("orders")
+	server := httptest.NewServer(NewHandler(factory))
+	defer server.Close()
+	response, err := http.Get(server.URL + "/topics/orders/events")
+	assert.IsTrue(err == nil)
+	assert.AreEqual(1, factory.Describe().Topics[0].Subscribers)
+	//when
+	response.Body.Close()
+	//then
+	for factory.Describe().Topics[0].Subscribers != 0 {
+		<-time.After(time.Millisecond)
+	}
+}
+
+func TestThat_Handler_ResumesStreams_AfterTheLastEventId(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	factory := events.NewFactory()
+	topic := factory.NewReplayTopic("orders", 10)
+	received := make(chan interface{}, 3)
+	topic.NewSubscriber(func(event interface{}) {
+		received <- event
+	})
+	publisher := topic.NewPublisher()
+	for _, event := range []string{"one", "two", "three"} {
+		publisher(event)
+		<-received
+	}
+	server := httptest.NewServer(NewHandler(factory))
+	defer server.Close()
+	//when
+	request, _ := http.NewRequest("GET", server.URL+"/topics/orders/events", nil)
+	request.Header.Set("Last-Event-ID", "0")
+	response, err := http.DefaultClient.Do(request)
+	//then
+	assert.IsTrue(err == nil)
+	defer response.Body.Close()
+	reader := bufio.NewReader(response.Body)
+	assert.AreEqual([]string{"id: 1", `data: "two"`}, readEvent(reader))
+	assert.AreEqual([]string{"id: 2", `data: "three"`}, readEvent(reader))
+}
+
+func TestThat_Handler_CanBeMounted_UnderAPrefix(t *testing.T) {
+	assert := assertions.New(t)
+	factory := events.NewFactory()
+	factory.NewTopic("a/b")
+	mux := http.NewServeMux()
+	mux.Handle("/events/", http.StripPrefix("/events", NewHandler(factory)))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	response, _ := http.Post(server.URL+"/events/topics/a%2Fb", "application/json", strings.NewReader(`1`))
+	assert.AreEqual(http.StatusAccepted, response.StatusCode)
+}
+
+func TestThat_Handler_DecodesBodies_WithTheCodecOfTheFactory(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	type order struct {
+		Id int `json:"id"`
+	}
+	factory := events.NewFactory(events.WithCodec("orders", events.NewJSONCodec(order{})))
+	received := make(chan interface{})
+	factory.NewTopic("orders", func(event interface{}) {
+		received <- event
+	})
+	server := httptest.NewServer(NewHandler(factory))
+	defer server.Close()
+	//when
+	http.Post(server.URL+"/topics/orders", "application/json", strings.NewReader(`{"id":42}`))
+	//then
+	assert.AreEqual(order{42}, <-received)
+}
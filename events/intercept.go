@@ -0,0 +1,136 @@
+package events
+
+import (
+	"path"
+	"sync/atomic"
+)
+
+/*
+Publishes an event to the Topic with the given name, see PublishInterceptor.
+*/
+type PublishFunc func(topicName string, event interface{})
+
+/*
+Hands an event to a Subscriber, see SubscribeInterceptor.
+*/
+type SubscribeFunc func(envelope *Envelope)
+
+/*
+Wraps the publishing of events, e.g. to validate, enrich or authorize them. An interceptor
+calls next to let the event through (possibly a different one), or doesn't, to drop it.
+The topic name passed to next is informational: events can't be redirected to other Topics.
+Interceptors run in the go-routine of the Publisher, hence they shouldn't block.
+*/
+type PublishInterceptor func(next PublishFunc) PublishFunc
+
+/*
+Wraps the handing of events to Subscribers, e.g. to measure or filter them. An interceptor
+calls next to let the event through, or doesn't, to skip the Subscriber. The Envelope is shared
+by the Subscribers of the event, hence interceptors changing it have to pass a copy to next.
+Interceptors run in the go-routine of the Subscriber.
+*/
+type SubscribeInterceptor func(next SubscribeFunc) SubscribeFunc
+
+//interceptors of the Topics matching the pattern, or of all Topics if there's no pattern
+type interception struct {
+	all       bool
+	pattern   string
+	publish   []PublishInterceptor
+	subscribe []SubscribeInterceptor
+}
+
+/*
+Makes every Publisher of the Factory go through the interceptors, the first one outermost.
+Interceptors apply to the Publishers of every kind of Topic, to gates, ticks and to bridged events.
+Factory-level interceptors wrap the Topic-level ones (see UsePublishOn).
+*/
+func UsePublish(interceptors ...PublishInterceptor) FactoryOption {
+	return func(t *factory) {
+		t.interceptions = append(t.interceptions, interception{all: true, publish: interceptors})
+	}
+}
+
+/*
+Makes every Subscriber of the Factory (gates' included) go through the interceptors, the first one outermost.
+Factory-level interceptors wrap the Topic-level ones (see UseSubscribeOn).
+*/
+func UseSubscribe(interceptors ...SubscribeInterceptor) FactoryOption {
+	return func(t *factory) {
+		t.interceptions = append(t.interceptions, interception{all: true, subscribe: interceptors})
+	}
+}
+
+/*
+Makes the Publishers of the Topics with names matching the pattern (as understood by path.Match) go through the interceptors.
+*/
+func UsePublishOn(pattern string, interceptors ...PublishInterceptor) FactoryOption {
+	return func(t *factory) {
+		t.interceptions = append(t.interceptions, interception{pattern: pattern, publish: interceptors})
+	}
+}
+
+/*
+Makes the Subscribers of the Topics with names matching the pattern (as understood by path.Match) go through the interceptors.
+*/
+func UseSubscribeOn(pattern string, interceptors ...SubscribeInterceptor) FactoryOption {
+	return func(t *factory) {
+		t.interceptions = append(t.interceptions, interception{pattern: pattern, subscribe: interceptors})
+	}
+}
+
+//the interceptions applying to the Topic, the Factory-level ones first
+func (t *factory) interceptionsOf(topicName string) []interception {
+	applying := []interception{}
+	for _, all := range []bool{true, false} {
+		for _, candidate := range t.interceptions {
+			if candidate.all != all {
+				continue
+			}
+			if matches, _ := path.Match(candidate.pattern, topicName); all || matches {
+				applying = append(applying, candidate)
+			}
+		}
+	}
+	return applying
+}
+
+/*
+Runs the event through the publish interceptors of the Topic; events they let through are
+counted, traced and handed to send. Once the Factory is shutting down, events are rejected instead.
+*/
+func (t *factory) publish(topicName string, event interface{}, send func(event interface{}, trace SpanContext)) {
+	//counted as queued until it's sent, so that Shutdown either waits for the event or sees it rejected
+	atomic.AddInt32(&t.queued, 1)
+	defer t.settle(&t.queued, 1)
+	if state := t.lifecycle(); state != factoryRunning {
+		t.reject(topicName, state)
+		return
+	}
+	event, parent := unwrapSpan(event)
+	var next PublishFunc = func(_ string, event interface{}) {
+		send(event, t.published(topicName, parent))
+	}
+	if len(t.interceptions) > 0 {
+		interceptions := t.interceptionsOf(topicName)
+		for i := len(interceptions) - 1; i >= 0; i-- {
+			for j := len(interceptions[i].publish) - 1; j >= 0; j-- {
+				next = interceptions[i].publish[j](next)
+			}
+		}
+	}
+	next(topicName, event)
+}
+
+//wraps the Subscriber into the subscribe interceptors of the Topic
+func (t *factory) interceptSubscribe(topicName string, subscriber SubscribeFunc) SubscribeFunc {
+	if len(t.interceptions) == 0 {
+		return subscriber
+	}
+	interceptions := t.interceptionsOf(topicName)
+	for i := len(interceptions) - 1; i >= 0; i-- {
+		for j := len(interceptions[i].subscribe) - 1; j >= 0; j-- {
+			subscriber = interceptions[i].subscribe[j](subscriber)
+		}
+	}
+	return subscriber
+}
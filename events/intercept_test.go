@@ -0,0 +1,138 @@
+package events
+
+import (
+	"github.com/tholowka/testing/assertions"
+	"sync"
+	"testing"
+	"time"
+)
+
+//an interceptor appending its name to the (string) events it lets through
+func tagging(name string) PublishInterceptor {
+	return func(next PublishFunc) PublishFunc {
+		return func(topicName string, event interface{}) {
+			next(topicName, event.(string)+"+"+name)
+		}
+	}
+}
+
+func TestThat_PublishInterceptors_WrapEachOther_FactoryLevelFirst(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	received := make(chan interface{})
+	f := NewFactory(
+		UsePublishOn("orders", tagging("topic")),
+		UsePublish(tagging("first"), tagging("second")),
+	)
+	topic := f.NewTopic("orders", func(event interface{}) {
+		received <- event
+	})
+	//when
+	topic.NewPublisher()("order")
+	//then
+	assert.AreEqual("order+first+second+topic", <-received)
+}
+
+func TestThat_PublishInterceptors_CanDropEvents(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	metrics := newRecordedMetrics()
+	received := make(chan interface{})
+	f := NewFactory(WithMetrics(metrics), UsePublish(func(next PublishFunc) PublishFunc {
+		return func(topicName string, event interface{}) {
+			if event != "invalid" {
+				next(topicName, event)
+			}
+		}
+	}))
+	topic := f.NewTopic("orders", func(event interface{}) {
+		received <- event
+	})
+	publisher := topic.NewPublisher()
+	//when
+	publisher("invalid")
+	publisher("valid")
+	//then
+	assert.AreEqual("valid", <-received)
+	metrics.lock.Lock()
+	defer metrics.lock.Unlock()
+	assert.AreEqual(float64(1), metrics.counters[MetricPublished+"/orders"])
+}
+
+func TestThat_PublishInterceptors_ReceiveEventsUnwrapped(t *testing.T) {
+	assert := assertions.New(t)
+	intercepted := make(chan interface{}, 1)
+	received := make(chan *Envelope)
+	parent, _ := ParseTraceparent("00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	topic := NewFactory(UsePublish(func(next PublishFunc) PublishFunc {
+		return func(topicName string, event interface{}) {
+			intercepted <- event
+			next(topicName, event)
+		}
+	})).NewTopic("orders")
+	topic.NewSubscriber(func(event interface{}) {
+		received <- event.(*Envelope)
+	}, WithEnvelope())
+	topic.NewPublisher()(WithinSpan(parent, "order"))
+	assert.AreEqual("order", <-intercepted)
+	assert.AreEqual(parent, (<-received).Trace)
+}
+
+func TestThat_SubscribeInterceptors_ApplyToMatchingTopics(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	lock := sync.Mutex{}
+	seen := []string{}
+	f := NewFactory(UseSubscribeOn("orders.*", func(next SubscribeFunc) SubscribeFunc {
+		return func(envelope *Envelope) {
+			lock.Lock()
+			seen = append(seen, envelope.Topic)
+			lock.Unlock()
+			if envelope.Event != "skipped" {
+				next(envelope)
+			}
+		}
+	}))
+	received := make(chan interface{})
+	subscriber := func(event interface{}) {
+		received <- event
+	}
+	created := f.NewTopic("orders.created", subscriber)
+	payments := f.NewTopic("payments", subscriber)
+	//when
+	created.NewPublisher()("skipped")
+	created.NewPublisher()("order")
+	assert.AreEqual("order", <-received)
+	payments.NewPublisher()("skipped")
+	//then
+	assert.AreEqual("skipped", <-received)
+	select {
+	case event := <-received:
+		t.Fatalf("Unexpected event %v", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	assert.AreEqual([]string{"orders.created", "orders.created"}, seen)
+}
+
+func TestThat_SubscribeInterceptors_WrapEachOther_FactoryLevelFirst(t *testing.T) {
+	assert := assertions.New(t)
+	order := make(chan string, 3)
+	recording := func(name string) SubscribeInterceptor {
+		return func(next SubscribeFunc) SubscribeFunc {
+			return func(envelope *Envelope) {
+				order <- name
+				next(envelope)
+			}
+		}
+	}
+	received := make(chan interface{})
+	f := NewFactory(UseSubscribeOn("*", recording("topic")), UseSubscribe(recording("factory")))
+	f.NewTopic("orders", func(event interface{}) {
+		received <- event
+	}).NewPublisher()("order")
+	<-received
+	assert.AreEqual("factory", <-order)
+	assert.AreEqual("topic", <-order)
+}
@@ -14,6 +14,7 @@ For more information, please see the README at: https://github.com/tholowka/pub-
 package events
 
 import (
+    "context"
     "time"
 )
 
@@ -40,12 +41,35 @@ type Topic interface {
     //Subscribing may occur in its own go-routine, hence even if the act of 
 	//subscribing 'blocks' (for example due to the waiting on channel), the 
 	//remaining Topics still execute normally.  
-    NewSubscriber(subscriber Subscriber)
+	//Options allow Subscribers of Topics keeping a history to catch up on 
+	//past events first (see FromOffset, FromTime, FromBeginning).
+    NewSubscriber(subscriber Subscriber, options ...SubscribeOption)
     //Returns the topic's name
     String() string
+    //Returns the most recent event delivered through the Topic, and false
+    //if there was none so far.
+    Last() (interface{}, bool)
     //Close frees the underlying resources, and depending on the implementation 
 	//may render the Topic unusable
     Close() error
+    //Returns a channel closed once the Topic is closed, on its own or with
+    //its Factory (or right away, if the Factory was closed when creating it).
+    Closed() <-chan struct{}
+}
+
+/*
+A Topic publishing a Tick event every interval. The ticking can be paused, resumed and reconfigured
+while the Topic is open.
+*/
+type TickerTopic interface {
+    Topic
+    //Stops the ticking, until Resume is called
+    Pause()
+    //Restarts the ticking, with a full interval before the next Tick
+    Resume()
+    //Changes the interval, with a full (new) interval before the next Tick.
+    //Fails for non-positive intervals, leaving the Topic unchanged.
+    Reset(time.Duration) error
 }
 
 /**
@@ -61,11 +85,54 @@ Since 2.0
 type Factory interface {
 	//Creates a new standard Topic
     NewTopic(string, ...Subscriber) Topic
+	//Creates a standard Topic which retains the given number of most recent
+	//events, and replays them to every newly registered Subscriber before
+	//any live events (e.g. for configuration or status Topics).
+    NewRetainedTopic(string, int, ...Subscriber) Topic
+	//Creates a standard Topic which keeps a buffer of the given number of
+	//most recent events, with increasing offsets. Subscribers only receive
+	//live events, unless registered with FromOffset, FromTime or FromBeginning,
+	//in which case they catch up on the buffered events first.
+    NewReplayTopic(string, int, ...Subscriber) Topic
+	//Creates a Topic backed by an append-only log on disk (see WithStorage).
+	//Events which were not delivered to any Subscriber survive a restart:
+	//they are delivered once the Topic is re-created with the same name.
+    NewPersistentTopic(string, PersistenceOptions, ...Subscriber) (DurableTopic, error)
 	//Creates a Topic, backed by a Go Ticker, which can be subscribed
-	//to for Tick events. Publishing to it does not make sense. 
-    NewTickerTopic(string, time.Duration) Topic
-	//Closes all Topics created by this Factory.
+	//to for Tick events. Publishing to it injects an additional, manual Tick.
+    NewTickerTopic(string, time.Duration, ...TickerOption) TickerTopic
+	//Creates a Topic firing according to a cron expression (e.g. '*/5 * * * *'),
+	//optionally preceded by a time zone, as in 'CRON_TZ=Europe/Warsaw 0 9 * * MON-FRI'.
+	//Descriptors like '@hourly' or '@daily' are understood as well. Fails for expressions
+	//which can never match, like '0 0 30 2 *'.
+    NewScheduleTopic(string, string) (Topic, error)
+	//Creates a Topic which fires only once, at the given point in time. If that time has
+	//passed already, it fires as soon as the first Subscriber is registered.
+    NewTimerTopic(string, time.Time) Topic
+	//Creates a Topic which fires every interval, shifted randomly by up to
+	//+/- the given jitter (useful for spreading out polling clients).
+    NewJitteredTickerTopic(string, time.Duration, time.Duration) (Topic, error)
+	//Closes all Topics created by this Factory, and stops its go-routines. Events published
+	//afterwards are dropped, and no more Topics can be created or subscribed to. Subscribers
+	//of events dispatched already may still be running when it returns, see Shutdown.
     Close() error
+	//Stops accepting events and stopping tickers, then waits until the published events reached
+	//their Subscribers and the Subscribers returned, or the context expires; closes the Factory
+	//eventually, and waits for its go-routines (e.g. of durable Subscribers) to return as well.
+	//Reports the events which were rejected or abandoned.
+    Shutdown(context.Context) (ShutdownReport, error)
+	//Returns the open Topic with the given name, and false if there is none.
+    Lookup(string) (Topic, bool)
+	//Returns the open Topics, ordered by name (gates included).
+    Topics() []Topic
+	//Returns a snapshot of the Topics, their Subscribers and the events
+	//waiting to be requeued, for diagnosing stuck flows.
+    Describe() FactoryDescription
+	//Returns the graph of the Topics, gates and bridges of the Factory.
+    Topology() Topology
+	//Returns the Codec the Topic with the given name uses (see WithCodec),
+	//so that transports encode its events the same way.
+    CodecFor(string) Codec
 	//Creates a Topic implementing an AND gate (i.e. collecting
 	//multiple events from various topics together and firing 
 	//only when all Topic have been Published to)
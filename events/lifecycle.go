@@ -0,0 +1,151 @@
+package events
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+/*
+The lifecycle of a factory: it's running until Shutdown makes it drain, and closed by Close
+(which Shutdown calls eventually). The state only moves forward. Once closed, the factory's
+go-routine is gone: events are rejected, and Topics can't be created, looked up or subscribed to.
+*/
+const (
+	factoryRunning int32 = iota
+	factoryDraining
+	factoryClosed
+)
+
+var factoryStates = [...]string{"running", "draining", "closed"}
+
+func (t *factory) lifecycle() int32 {
+	return atomic.LoadInt32(&t.state)
+}
+
+//moves the factory to a later state, returns false if it's already there (or past it)
+func (t *factory) advance(state int32) bool {
+	for {
+		current := atomic.LoadInt32(&t.state)
+		if current >= state {
+			return false
+		}
+		if atomic.CompareAndSwapInt32(&t.state, current, state) {
+			return true
+		}
+	}
+}
+
+//runs the modifier in the factory's go-routine and waits for it, returns false if the factory is closed already
+func (t *factory) modify(spec *stateModifierSpec) bool {
+	select {
+	case t.stateModifier <- spec:
+		<-spec.stateChanged
+		return true
+	case <-t.done:
+		return false
+	}
+}
+
+//runs the function in a go-routine owned by the factory, which must return once the factory is closed
+func (t *factory) spawn(fn func()) {
+	atomic.AddInt32(&t.routines, 1)
+	go func() {
+		defer t.settle(&t.routines, 1)
+		fn()
+	}()
+}
+
+//decreases one of the counters Shutdown waits for (queued, inFlight, routines), waking it up
+func (t *factory) settle(counter *int32, delta int32) int32 {
+	value := atomic.AddInt32(counter, -delta)
+	select {
+	case t.settled <- struct{}{}:
+	default:
+	}
+	return value
+}
+
+//hands the event to the factory's go-routine from a new go-routine, so that the caller is never blocked
+func (t *factory) enqueue(event *eventSpec) {
+	atomic.AddInt32(&t.queued, 1)
+	t.spawn(func() {
+		t.handOver(event)
+	})
+}
+
+//hands the event to the factory's go-routine, blocking until it's received
+func (t *factory) send(event *eventSpec) {
+	atomic.AddInt32(&t.queued, 1)
+	t.handOver(event)
+}
+
+//hands over an event already counted as queued; it's dropped if the factory gets closed meanwhile
+func (t *factory) handOver(event *eventSpec) {
+	select {
+	case t.events <- event:
+	case <-t.done:
+		t.settle(&t.queued, 1)
+	}
+}
+
+/*
+The close logic of a Topic, split so that Factory.Close can run it for all its Topics at once.
+Detaching must run in the factory's go-routine: it removes the Topic (unless another one
+replaced it), and returns what's left to release outside of it (and after the factory's
+go-routine is gone, when closing the Factory), or nil if the Topic was closed already.
+*/
+type topicCloser interface {
+	detach(state *factory) func() error
+}
+
+//what the factory keeps of each of its Topics, every kind of Topic knows how to detach itself
+type registeredTopic interface {
+	Topic
+	topicCloser
+}
+
+//closes a Topic on its own, does nothing once the factory is closed since its Topics are closed with it
+func (t *factory) closeTopic(topic topicCloser) error {
+	var release func() error
+	stateChanged := make(chan bool)
+	detacher := func(state *factory) {
+		release = topic.detach(state)
+	}
+	t.modify(&stateModifierSpec{detacher, stateChanged, false})
+	close(stateChanged)
+	if release == nil {
+		return nil
+	}
+	return release()
+}
+
+//signals that a Topic is closed, see Topic.Closed
+type closedSignal struct {
+	closed chan struct{}
+	once   sync.Once
+	//owned by the factory's go-routine
+	detached bool
+}
+
+func newClosedSignal() *closedSignal {
+	return &closedSignal{closed: make(chan struct{})}
+}
+
+func (s *closedSignal) Closed() <-chan struct{} {
+	return s.closed
+}
+
+//must run in the factory's go-routine, returns false if the Topic was detached already
+func (s *closedSignal) markDetached() bool {
+	if s.detached {
+		return false
+	}
+	s.detached = true
+	return true
+}
+
+func (s *closedSignal) signalClosed() {
+	s.once.Do(func() {
+		close(s.closed)
+	})
+}
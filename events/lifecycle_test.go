@@ -0,0 +1,257 @@
+package events
+
+import (
+	"context"
+	"github.com/tholowka/testing/assertions"
+	"io/ioutil"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+//waits until the go-routines owned by the factory returned, reports false if they didn't in time
+func awaitNoRoutines(f *factory) bool {
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if atomic.LoadInt32(&f.routines) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func TestThat_Close_StopsTheFactoryGoRoutine(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	f := NewFactory()
+	f.NewTopic("orders")
+	assert.AreEqual(factoryRunning, f.(*factory).lifecycle())
+	//when
+	f.Close()
+	//then
+	select {
+	case <-f.(*factory).done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the factory's go-routine is still running")
+	}
+	assert.AreEqual(factoryClosed, f.(*factory).lifecycle())
+	assert.IsTrue(awaitNoRoutines(f.(*factory)))
+}
+
+func TestThat_Close_StopsTickers_Schedules_AndPublishers(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	f := NewFactory()
+	ticks := f.NewTickerTopic("ticks", time.Millisecond)
+	timer := f.NewTimerTopic("timer", time.Now().Add(time.Hour))
+	orders := f.NewTopic("orders")
+	orders.Close()
+	//waiting to be requeued
+	orders.NewPublisher()("order")
+	ticks.NewPublisher()("manual tick")
+	timer.NewPublisher()("manual tick")
+	for len(f.Describe().Requeued) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	//when
+	f.Close()
+	//then
+	assert.IsTrue(awaitNoRoutines(f.(*factory)))
+	assert.AreEqual(int32(0), atomic.LoadInt32(&f.(*factory).queued))
+}
+
+func TestThat_AClosedFactory_DoesNotBlock(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	f := NewFactory()
+	ticker := f.NewTickerTopic("ticks", time.Hour)
+	topic := f.NewTopic("orders", func(interface{}) {
+		assert.IsTrue(false)
+	})
+	f.Close()
+	//when
+	done := make(chan bool)
+	go func() {
+		topic.NewPublisher()("order")
+		topic.NewSubscriber(func(interface{}) {})
+		topic.Close()
+		ticker.Pause()
+		f.NewTopic("payments")
+		_, exists := f.Lookup("orders")
+		assert.IsTrue(!exists)
+		assert.AreEqual(0, len(f.Topics()))
+		assert.IsTrue(f.Close() == nil)
+		report, err := f.Shutdown(context.Background())
+		assert.IsTrue(err == nil)
+		assert.AreEqual(1, report.Rejected)
+		close(done)
+	}()
+	//then
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("a closed factory blocked its caller")
+	}
+	assert.IsTrue(awaitNoRoutines(f.(*factory)))
+}
+
+func TestThat_TheLifecycle_OnlyMovesForward(t *testing.T) {
+	assert := assertions.New(t)
+	f := NewFactory().(*factory)
+	assert.IsTrue(f.advance(factoryDraining))
+	assert.IsTrue(!f.advance(factoryDraining))
+	assert.IsTrue(!f.advance(factoryRunning))
+	f.Close()
+	assert.AreEqual(factoryClosed, f.lifecycle())
+	assert.IsTrue(!f.advance(factoryDraining))
+}
+
+//reports false if the Topic isn't signalled as closed in time
+func awaitClosed(topic Topic) bool {
+	select {
+	case <-topic.Closed():
+		return true
+	case <-time.After(5 * time.Second):
+		return false
+	}
+}
+
+func TestThat_ClosingTheFactory_ClosesEveryKindOfTopic(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	directory, _ := ioutil.TempDir("", "lifecycle")
+	defer os.RemoveAll(directory)
+	f := NewFactory(WithStorage(directory), WithBroker(NewInProcessBroker(), "remote.*"))
+	orders := f.NewTopic("orders")
+	persistent, err := f.NewPersistentTopic("persistent", PersistenceOptions{SyncPolicy: SyncInterval})
+	assert.IsTrue(err == nil)
+	cron, err := f.NewScheduleTopic("cron", "@hourly")
+	assert.IsTrue(err == nil)
+	topics := []Topic{
+		orders,
+		f.NewRetainedTopic("retained", 1),
+		f.NewReplayTopic("replay", 1),
+		f.NewTopic("remote.orders"),
+		f.NewTickerTopic("ticks", time.Hour),
+		f.NewTimerTopic("timer", time.Now().Add(time.Hour)),
+		f.AndGate([]Topic{orders}),
+		persistent,
+		cron,
+	}
+	for _, topic := range topics {
+		select {
+		case <-topic.Closed():
+			t.Fatalf("%v is closed already", topic)
+		default:
+		}
+	}
+	//when
+	assert.IsTrue(f.Close() == nil)
+	//then
+	for _, topic := range topics {
+		assert.IsTrue(awaitClosed(topic))
+	}
+	assert.IsTrue(awaitNoRoutines(f.(*factory)))
+}
+
+func TestThat_ClosingTheFactory_StopsItsTickers(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	f := NewFactory()
+	ticks := int32(0)
+	ticker := f.NewTickerTopic("ticks", time.Millisecond)
+	ticker.NewSubscriber(func(interface{}) {
+		atomic.AddInt32(&ticks, 1)
+	})
+	for atomic.LoadInt32(&ticks) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	//when
+	f.Close()
+	//then
+	assert.IsTrue(awaitClosed(ticker))
+	select {
+	case <-ticker.(*tickerTopic).closeChannel:
+	default:
+		t.Fatal("the ticker loop wasn't told to stop")
+	}
+	//Close doesn't wait for ticks dispatched already, they are counted once their Subscribers returned
+	assert.IsTrue(awaitNoRoutines(f.(*factory)))
+	for atomic.LoadInt32(&f.(*factory).inFlight) != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	stopped := atomic.LoadInt32(&ticks)
+	time.Sleep(20 * time.Millisecond)
+	assert.AreEqual(stopped, atomic.LoadInt32(&ticks))
+}
+
+func TestThat_ClosingATopic_LeavesItsReplacementOpen(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	f := NewFactory()
+	defer f.Close()
+	replaced := f.NewTopic("orders")
+	replacement := f.NewTopic("orders")
+	//when
+	assert.IsTrue(replaced.Close() == nil)
+	assert.IsTrue(replaced.Close() == nil)
+	//then
+	assert.IsTrue(awaitClosed(replaced))
+	topic, exists := f.Lookup("orders")
+	assert.IsTrue(exists)
+	assert.IsTrue(topic == replacement)
+	select {
+	case <-replacement.Closed():
+		t.Fatal("the replacement got closed")
+	default:
+	}
+}
+
+func TestThat_TopicsOfAClosedFactory_AreClosedRightAway(t *testing.T) {
+	assert := assertions.New(t)
+	f := NewFactory()
+	f.Close()
+	assert.IsTrue(awaitClosed(f.NewTopic("orders")))
+	assert.IsTrue(awaitClosed(f.NewTickerTopic("ticks", time.Millisecond)))
+	assert.IsTrue(awaitClosed(f.NewTimerTopic("timer", time.Now())))
+}
+
+func TestThat_ClosingTopics_AndTheFactory_Concurrently_IsSafe(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		//given
+		assert := assertions.New(t)
+		f := NewFactory()
+		ticker := f.NewTickerTopic("ticks", time.Millisecond)
+		timer := f.NewTimerTopic("timer", time.Now().Add(time.Millisecond))
+		orders := f.NewTopic("orders", func(interface{}) {})
+		topics := []Topic{ticker, timer, orders, f.OrGate([]Topic{orders, ticker})}
+		//when
+		var group sync.WaitGroup
+		for _, fn := range []func(){
+			func() { f.Close() },
+			func() { f.Shutdown(context.Background()) },
+			func() { ticker.Close() },
+			func() { ticker.Pause() },
+			func() { ticker.Reset(2 * time.Millisecond) },
+			func() { timer.Close() },
+			func() { orders.Close() },
+			func() { orders.NewPublisher()("order") },
+			func() { ticker.NewPublisher()("tick") },
+			func() { f.NewTopic("payments").Close() },
+		} {
+			group.Add(1)
+			go func(fn func()) {
+				defer group.Done()
+				fn()
+			}(fn)
+		}
+		group.Wait()
+		f.Close()
+		//then
+		for _, topic := range topics {
+			assert.IsTrue(awaitClosed(topic))
+		}
+		assert.IsTrue(awaitNoRoutines(f.(*factory)))
+	}
+}
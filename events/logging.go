@@ -0,0 +1,147 @@
+package events
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+/*
+The severity of a logged message, see Logger.
+*/
+type LogLevel int
+
+const (
+	LevelDebug LogLevel = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	}
+	return fmt.Sprintf("LEVEL(%d)", int(l))
+}
+
+/*
+Receives the messages a Factory logs, see WithLogger. Fields are alternating keys and values,
+e.g. "topic", "orders", as with log/slog, hence an adapter to a slog.Logger is a one-liner.
+Log is called from many go-routines, including the Factory's own, hence it has to be safe
+for concurrent use and must not block.
+
+Factories log at the following levels:
+
+	Debug: Subscribers being added, events requeued as their Topic isn't registered (yet)
+	Info:  Topics being opened and closed, the Factory being closed
+	Warn:  events dropped, as their Topic is gone
+	Error: failures reported to the error handler (see WithErrorHandler), Subscribers panicking
+*/
+type Logger interface {
+	Log(level LogLevel, message string, fields ...interface{})
+}
+
+/*
+Makes the Factory log its activity, Subscribers which panic included (they are recovered
+from in any case, see WithErrorHandler).
+*/
+func WithLogger(logger Logger) FactoryOption {
+	return func(t *factory) {
+		t.logger = logger
+	}
+}
+
+/*
+Returns a Logger formatting messages as single lines, e.g. 'INFO Topic opened topic=orders kind=topic',
+and passing those at or above the minimum level to printf (e.g. log.Printf).
+*/
+func NewPrintfLogger(printf func(string, ...interface{}), minimum LogLevel) Logger {
+	return &printfLogger{printf, minimum}
+}
+
+type printfLogger struct {
+	printf  func(string, ...interface{})
+	minimum LogLevel
+}
+
+func (l *printfLogger) Log(level LogLevel, message string, fields ...interface{}) {
+	if level < l.minimum {
+		return
+	}
+	line := &bytes.Buffer{}
+	fmt.Fprintf(line, "%v %v", level, message)
+	for i := 0; i < len(fields); i += 2 {
+		var value interface{} = "<missing>"
+		if i+1 < len(fields) {
+			value = fields[i+1]
+		}
+		fmt.Fprintf(line, " %v=%v", fields[i], quoted(value))
+	}
+	l.printf("%s", line.String())
+}
+
+//quotes values which wouldn't read as a single word
+func quoted(value interface{}) string {
+	formatted := fmt.Sprintf("%v", value)
+	if formatted == "" || strings.ContainsAny(formatted, " \t\n\"=") {
+		return fmt.Sprintf("%q", formatted)
+	}
+	return formatted
+}
+
+func (t *factory) log(level LogLevel, message string, fields ...interface{}) {
+	if t.logger != nil {
+		t.logger.Log(level, message, fields...)
+	}
+}
+
+func (t *factory) topicOpened(topicName string, kind string) {
+	t.log(LevelInfo, "Topic opened", "topic", topicName, "kind", kind)
+}
+
+func (t *factory) topicClosed(topicName string) {
+	t.log(LevelInfo, "Topic closed", "topic", topicName)
+}
+
+//must run in the factory's go-routine
+func (t *factory) subscriberAdded(topicName string) {
+	t.log(LevelDebug, "Subscriber added", "topic", topicName, "subscribers", len(t.subscribers[topicName]))
+}
+
+//must run in the factory's go-routine
+func (t *factory) subscriberRemoved(topicName string) {
+	t.log(LevelDebug, "Subscriber removed", "topic", topicName, "subscribers", len(t.subscribers[topicName]))
+}
+
+//deferred by deliver
+func (t *factory) recoverSubscriber(topicName string, envelope *Envelope) {
+	if recovered := recover(); recovered != nil {
+		t.subscriberPanicked(topicName, envelope, recovered)
+	}
+}
+
+//logs the panic with its fields, and reports it to the error handler as well
+func (t *factory) subscriberPanicked(topicName string, envelope *Envelope, recovered interface{}) {
+	t.log(LevelError, "Subscriber panicked", "topic", topicName, "offset", envelope.Offset, "panic", recovered)
+	if t.errorHandler != nil {
+		t.errorHandler(fmt.Errorf("A subscriber of the topic '%v' panicked: %v", topicName, recovered))
+	}
+}
+
+func kindOf(topic *simpleTopic) string {
+	switch {
+	case topic.history == nil:
+		return "topic"
+	case topic.replayByDefault:
+		return "retained"
+	}
+	return "replay"
+}
@@ -0,0 +1,161 @@
+package events
+
+import (
+	"fmt"
+	"github.com/tholowka/testing/assertions"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordedLine struct {
+	level   LogLevel
+	message string
+	fields  []interface{}
+}
+
+type recordedLogger struct {
+	lock  sync.Mutex
+	lines []recordedLine
+}
+
+func (l *recordedLogger) Log(level LogLevel, message string, fields ...interface{}) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.lines = append(l.lines, recordedLine{level, message, fields})
+}
+
+//waits for a line with the message to be logged
+func (l *recordedLogger) await(message string) (recordedLine, bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		l.lock.Lock()
+		for _, line := range l.lines {
+			if line.message == message {
+				l.lock.Unlock()
+				return line, true
+			}
+		}
+		l.lock.Unlock()
+		if time.Now().After(deadline) {
+			return recordedLine{}, false
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestThat_Factory_LogsTheLifecycleOfTopics(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	logger := &recordedLogger{}
+	f := NewFactory(WithLogger(logger))
+	//when
+	topic := f.NewRetainedTopic("orders", 1)
+	topic.NewSubscriber(func(interface{}) {})
+	topic.Close()
+	f.Close()
+	//then
+	logger.lock.Lock()
+	defer logger.lock.Unlock()
+	assert.AreEqual(4, len(logger.lines))
+	assert.AreEqual(recordedLine{LevelInfo, "Topic opened", []interface{}{"topic", "orders", "kind", "retained"}}, logger.lines[0])
+	assert.AreEqual(recordedLine{LevelDebug, "Subscriber added", []interface{}{"topic", "orders", "subscribers", 1}}, logger.lines[1])
+	assert.AreEqual(recordedLine{LevelInfo, "Topic closed", []interface{}{"topic", "orders"}}, logger.lines[2])
+	assert.AreEqual("Factory closed", logger.lines[3].message)
+}
+
+func TestThat_Factory_LogsRequeuedAndDroppedEvents(t *testing.T) {
+	assert := assertions.New(t)
+	logger := &recordedLogger{}
+	f := NewFactory(WithLogger(logger), WithClock(NewManualClock(time.Now())))
+	topic := f.NewTopic("orders")
+	topic.Close()
+	topic.NewPublisher()("order")
+	f.(*factory).send(&eventSpec{"ticks", Tick{}, -1, nil, SpanContext{}})
+	requeued, logged := logger.await("Event requeued")
+	assert.IsTrue(logged)
+	assert.AreEqual(LevelDebug, requeued.level)
+	dropped, logged := logger.await("Event dropped")
+	assert.IsTrue(logged)
+	assert.AreEqual(LevelWarn, dropped.level)
+	assert.AreEqual([]interface{}{"topic", "ticks"}, dropped.fields)
+}
+
+func TestThat_Factory_RecoversFromPanickingSubscribers_WhenLogging(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	logger := &recordedLogger{}
+	received := make(chan interface{})
+	topic := NewFactory(WithLogger(logger)).NewTopic("orders", func(event interface{}) {
+		if event == "bad" {
+			panic("bad order")
+		}
+		received <- event
+	})
+	publisher := topic.NewPublisher()
+	//when
+	publisher("bad")
+	//then
+	line, logged := logger.await("Subscriber panicked")
+	assert.IsTrue(logged)
+	assert.AreEqual(LevelError, line.level)
+	assert.AreEqual([]interface{}{"topic", "orders", "offset", uint64(0), "panic", "bad order"}, line.fields)
+	publisher("good")
+	assert.AreEqual("good", <-received)
+}
+
+func TestThat_Factory_RecoversFromPanickingSubscribers_WithoutALogger(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	reported := make(chan error, 1)
+	received := make(chan interface{})
+	topic := NewFactory(WithErrorHandler(func(err error) {
+		reported <- err
+	})).NewTopic("orders", func(event interface{}) {
+		if event == "bad" {
+			panic("bad order")
+		}
+		received <- event
+	})
+	publisher := topic.NewPublisher()
+	//when
+	publisher("bad")
+	//then
+	assert.AreEqual("A subscriber of the topic 'orders' panicked: bad order", (<-reported).Error())
+	publisher("good")
+	assert.AreEqual("good", <-received)
+}
+
+func TestThat_Factory_LogsReportedErrors(t *testing.T) {
+	assert := assertions.New(t)
+	logger := &recordedLogger{}
+	f := NewFactory(WithLogger(logger), WithBroker(NewInProcessBroker(), "*"))
+	f.NewTopic("orders").NewPublisher()(func() {})
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		logger.lock.Lock()
+		errors := 0
+		for _, line := range logger.lines {
+			if line.level == LevelError {
+				errors++
+			}
+		}
+		logger.lock.Unlock()
+		if errors > 0 || time.Now().After(deadline) {
+			assert.AreEqual(1, errors)
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestThat_PrintfLogger_FormatsFields_AboveTheMinimumLevel(t *testing.T) {
+	assert := assertions.New(t)
+	lines := []string{}
+	logger := NewPrintfLogger(func(format string, arguments ...interface{}) {
+		lines = append(lines, fmt.Sprintf(format, arguments...))
+	}, LevelInfo)
+	logger.Log(LevelDebug, "Subscriber added", "topic", "orders")
+	logger.Log(LevelWarn, "Event dropped", "topic", "new orders", "offset", 7, "dangling")
+	assert.AreEqual([]string{`WARN Event dropped topic="new orders" offset=7 dangling=<missing>`}, lines)
+}
@@ -0,0 +1,103 @@
+package events
+
+import (
+	"time"
+)
+
+//The names of the metrics a Factory reports, see Metrics.
+const (
+	//counter, per topic: events handed to Publishers (including ticks)
+	MetricPublished = "events_published_total"
+	//counter, per topic: Subscriber invocations which returned
+	MetricDelivered = "events_delivered_total"
+	//counter, per topic: events put back into the queue, as their Topic wasn't registered (yet)
+	MetricRequeued = "events_requeued_total"
+	//counter, per topic: events discarded, as their Topic was gone and they couldn't be requeued
+	MetricDropped = "events_dropped_total"
+	//histogram, per topic: how long Subscribers took to handle events, in seconds
+	MetricSubscriberLatency = "events_subscriber_latency_seconds"
+	//gauge: go-routines currently running Subscribers
+	MetricInFlight = "events_in_flight_subscribers"
+	//gauge: open Topics, gates included
+	MetricTopics = "events_topics"
+	//gauge: registered Subscribers, over all Topics
+	MetricSubscribers = "events_subscribers"
+)
+
+var metricHelp = map[string]string{
+	MetricPublished:         "Events handed to Publishers.",
+	MetricDelivered:         "Events handled by Subscribers.",
+	MetricRequeued:          "Events requeued, as their topic was not registered.",
+	MetricDropped:           "Events discarded, as their topic was gone.",
+	MetricSubscriberLatency: "Time Subscribers took to handle events, in seconds.",
+	MetricInFlight:          "Go-routines currently running Subscribers.",
+	MetricTopics:            "Open topics, gates included.",
+	MetricSubscribers:       "Registered Subscribers.",
+}
+
+/*
+Returns a one-line description of a metric reported by Factories, or an empty string
+for other names. Useful to exporters, see events/prometheus.
+*/
+func MetricHelp(name string) string {
+	return metricHelp[name]
+}
+
+/*
+Receives the measurements of a Factory, see WithMetrics. The topic is empty for metrics of
+the whole Factory. Methods are called from many go-routines, including the Factory's own, hence
+they have to be safe for concurrent use and must not block.
+*/
+type Metrics interface {
+	//Adds delta to the counter
+	Count(name string, topic string, delta float64)
+	//Sets the gauge to the value
+	Gauge(name string, topic string, value float64)
+	//Adds an observation to the histogram
+	Observe(name string, topic string, value float64)
+}
+
+/*
+Makes the Factory report its activity to the Metrics, see the Metric constants for what's reported.
+*/
+func WithMetrics(metrics Metrics) FactoryOption {
+	return func(t *factory) {
+		t.metrics = metrics
+	}
+}
+
+type noMetrics struct{}
+
+func (noMetrics) Count(name string, topic string, delta float64)   {}
+func (noMetrics) Gauge(name string, topic string, value float64)   {}
+func (noMetrics) Observe(name string, topic string, value float64) {}
+
+//invokes the handler through the subscribe interceptors, measuring and tracing it; runs in a go-routine of its own,
+//which the factory's go-routine counts in flight before starting it
+func (t *factory) deliver(topicName string, subscriber handler, envelope *Envelope) {
+	started := time.Now()
+	defer func() {
+		t.metrics.Observe(MetricSubscriberLatency, topicName, time.Since(started).Seconds())
+		t.metrics.Count(MetricDelivered, topicName, 1)
+		t.metrics.Gauge(MetricInFlight, "", float64(t.settle(&t.inFlight, 1)))
+	}()
+	defer t.recoverSubscriber(topicName, envelope)
+	if t.tracer != nil {
+		span := t.tracer.Start("deliver "+topicName, envelope.Trace, "topic", topicName, "offset", envelope.Offset)
+		defer span.End()
+		traced := *envelope
+		traced.Trace = span.Context()
+		envelope = &traced
+	}
+	t.interceptSubscribe(topicName, SubscribeFunc(subscriber))(envelope)
+}
+
+//must run in the factory's go-routine
+func (t *factory) measureState() {
+	subscribers := 0
+	for _, handlers := range t.subscribers {
+		subscribers += len(handlers)
+	}
+	t.metrics.Gauge(MetricTopics, "", float64(len(t.topics)))
+	t.metrics.Gauge(MetricSubscribers, "", float64(subscribers))
+}
@@ -0,0 +1,102 @@
+package events
+
+import (
+	"github.com/tholowka/testing/assertions"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordedMetrics struct {
+	lock         sync.Mutex
+	counters     map[string]float64
+	gauges       map[string]float64
+	observations map[string]int
+}
+
+func newRecordedMetrics() *recordedMetrics {
+	return &recordedMetrics{counters: map[string]float64{}, gauges: map[string]float64{}, observations: map[string]int{}}
+}
+
+func (m *recordedMetrics) Count(name string, topic string, delta float64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.counters[name+"/"+topic] += delta
+}
+
+func (m *recordedMetrics) Gauge(name string, topic string, value float64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.gauges[name+"/"+topic] = value
+}
+
+func (m *recordedMetrics) Observe(name string, topic string, value float64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.observations[name+"/"+topic]++
+}
+
+//waits for the counter to reach the value, as metrics are reported once Subscribers return
+func (m *recordedMetrics) awaitCounter(key string, value float64) float64 {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		m.lock.Lock()
+		current := m.counters[key]
+		m.lock.Unlock()
+		if current >= value || time.Now().After(deadline) {
+			return current
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestThat_Factory_CountsPublishedAndDeliveredEvents(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	metrics := newRecordedMetrics()
+	received := make(chan interface{})
+	subscriber := func(event interface{}) {
+		received <- event
+	}
+	topic := NewFactory(WithMetrics(metrics)).NewTopic("orders", subscriber, subscriber)
+	//when
+	topic.NewPublisher()("order")
+	<-received
+	<-received
+	//then
+	assert.AreEqual(float64(2), metrics.awaitCounter(MetricDelivered+"/orders", 2))
+	metrics.lock.Lock()
+	defer metrics.lock.Unlock()
+	assert.AreEqual(float64(1), metrics.counters[MetricPublished+"/orders"])
+	assert.AreEqual(2, metrics.observations[MetricSubscriberLatency+"/orders"])
+}
+
+func TestThat_Factory_ReportsTopicsAndSubscribers(t *testing.T) {
+	assert := assertions.New(t)
+	metrics := newRecordedMetrics()
+	f := NewFactory(WithMetrics(metrics))
+	orders := f.NewTopic("orders", func(interface{}) {})
+	f.NewTopic("payments").NewSubscriber(func(interface{}) {})
+	orders.NewSubscriber(func(interface{}) {})
+	metrics.lock.Lock()
+	assert.AreEqual(float64(2), metrics.gauges[MetricTopics+"/"])
+	assert.AreEqual(float64(3), metrics.gauges[MetricSubscribers+"/"])
+	metrics.lock.Unlock()
+	orders.Close()
+	metrics.lock.Lock()
+	defer metrics.lock.Unlock()
+	assert.AreEqual(float64(1), metrics.gauges[MetricTopics+"/"])
+	assert.AreEqual(float64(1), metrics.gauges[MetricSubscribers+"/"])
+}
+
+func TestThat_Factory_CountsRequeuedAndDroppedEvents(t *testing.T) {
+	assert := assertions.New(t)
+	metrics := newRecordedMetrics()
+	f := NewFactory(WithMetrics(metrics), WithClock(NewManualClock(time.Now())))
+	topic := f.NewTopic("orders")
+	topic.Close()
+	topic.NewPublisher()("order")
+	f.(*factory).send(&eventSpec{"ticks", Tick{}, -1, nil, SpanContext{}})
+	assert.AreEqual(float64(1), metrics.awaitCounter(MetricRequeued+"/orders", 1))
+	assert.AreEqual(float64(1), metrics.awaitCounter(MetricDropped+"/ticks", 1))
+}
@@ -0,0 +1,534 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+Tells a persistent Topic when to flush its segment log (and offsets) to disk.
+*/
+type SyncPolicy int
+
+const (
+	//Every event is flushed to disk before it is delivered. The safest, and the slowest option.
+	SyncAlways SyncPolicy = iota
+	//Events are flushed to disk periodically, see PersistenceOptions.SyncInterval.
+	SyncInterval
+	//Flushing is left to the operating system. Offsets are only written when the Topic is closed.
+	SyncNever
+)
+
+const (
+	defaultSegmentBytes = 16 * 1024 * 1024
+	defaultSyncInterval = time.Second
+	offsetsFile         = "offsets.json"
+)
+
+/*
+Configures a persistent Topic, see Factory.NewPersistentTopic. The zero value is usable:
+it syncs every event, rotates segments at 16MB and keeps them forever.
+*/
+type PersistenceOptions struct {
+	SyncPolicy SyncPolicy
+	//How often events are flushed with SyncInterval, a second by default
+	SyncInterval time.Duration
+	//The size at which the log starts a new segment file, 16MB by default
+	SegmentBytes int64
+	//Oldest segments are deleted once the log grows beyond that size, 0 means no limit.
+	//Segments holding events not delivered to all Subscribers, or not acknowledged
+	//by all durable Subscribers (even those not registered currently), are kept.
+	RetentionBytes int64
+	//Segments with no events younger than that are deleted, 0 means no limit (with the same exceptions)
+	RetentionAge time.Duration
+	//Invoked when an event can't be persisted (it is then dropped),
+	//or when the log can't be read or flushed
+	ErrorHandler func(error)
+}
+
+func (o PersistenceOptions) segmentBytes() int64 {
+	if o.SegmentBytes <= 0 {
+		return defaultSegmentBytes
+	}
+	return o.SegmentBytes
+}
+
+/*
+Stores the persistent Topics of the Factory in subdirectories of the given directory.
+Persistent Topics re-created with the same name (e.g. after a restart of the process)
+recover the events which were not delivered to any Subscriber.
+*/
+func WithStorage(directory string) FactoryOption {
+	return func(t *factory) {
+		t.storage = directory
+	}
+}
+
+/*
+A Topic backed by a segment log on disk. Events are appended to the log when published, and
+the offset up to which all events were delivered is kept alongside it. An event counts as
+delivered once all the Subscribers it was dispatched to have returned, hence events are
+delivered at least once: those which were being handled when the process stopped are
+delivered again. Undelivered events are replayed as soon as the Topic has Subscribers.
+The offsets of durable Subscribers are kept in the same file.
+Payloads are stored using the Codec registered for the Topic (see WithCodec), JSON by default.
+Only one persistent Topic at a time can use a directory within the process.
+*/
+type persistentTopic struct {
+	p       *factory
+	name    string
+	options PersistenceOptions
+	codec   Codec
+	*closedSignal
+	//guards the log, the offsets file and the durable subscriptions
+	lock                sync.Mutex
+	log                 *segmentLog
+	directory           string
+	closed              bool
+	stopSync            chan bool
+	subscriptions       map[string]*durableSubscription
+	storedSubscriptions map[string]uint64
+	savedDelivered      uint64
+	//only the event is used, offsets come from the log; owned by the factory's go-routine
+	lastEvent
+	replaying bool
+	//guards the fields below, never held while doing I/O
+	progress sync.Mutex
+	//the offset up to which all events were delivered
+	committed uint64
+	//events past committed, dispatched to Subscribers which haven't all returned yet
+	dispatched map[uint64]bool
+	//events past committed, delivered already
+	delivered map[uint64]bool
+}
+
+//the directories of the open persistent Topics of the process
+var openDirectories = struct {
+	sync.Mutex
+	directories map[string]bool
+}{directories: map[string]bool{}}
+
+//claims the directory for a persistent Topic, failing if another one uses it already
+func claimDirectory(directory string) (string, error) {
+	absolute, err := filepath.Abs(directory)
+	if err != nil {
+		return "", err
+	}
+	openDirectories.Lock()
+	defer openDirectories.Unlock()
+	if openDirectories.directories[absolute] {
+		return "", fmt.Errorf("The directory '%v' is used by an open persistent topic already", directory)
+	}
+	openDirectories.directories[absolute] = true
+	return absolute, nil
+}
+
+func releaseDirectory(directory string) {
+	openDirectories.Lock()
+	defer openDirectories.Unlock()
+	delete(openDirectories.directories, directory)
+}
+
+//stops reading the log once a page is full
+var errPageRead = errors.New("Page read")
+
+type storedOffsets struct {
+	Delivered     uint64            `json:"delivered"`
+	Subscriptions map[string]uint64 `json:"subscriptions,omitempty"`
+}
+
+func (t *factory) NewPersistentTopic(topicName string, options PersistenceOptions, subscribers ...Subscriber) (DurableTopic, error) {
+	if t.storage == "" {
+		return nil, errors.New("Persistent topics need a storage directory, see WithStorage")
+	}
+	directory, err := claimDirectory(filepath.Join(t.storage, url.PathEscape(topicName)))
+	if err != nil {
+		return nil, err
+	}
+	log, err := openSegmentLog(directory, options)
+	if err != nil {
+		releaseDirectory(directory)
+		return nil, err
+	}
+	topic := &persistentTopic{
+		p:         t,
+		name:      topicName,
+		options:   options,
+		codec:     t.CodecFor(topicName),
+		log:       log,
+		directory: directory,
+		stopSync:      make(chan bool),
+		subscriptions: map[string]*durableSubscription{},
+		dispatched:    map[uint64]bool{},
+		delivered:     map[uint64]bool{},
+		closedSignal:  newClosedSignal(),
+	}
+	stored := &storedOffsets{}
+	if bytes, err := ioutil.ReadFile(filepath.Join(directory, offsetsFile)); err == nil {
+		if err = json.Unmarshal(bytes, stored); err != nil {
+			log.close()
+			releaseDirectory(directory)
+			return nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		log.close()
+		releaseDirectory(directory)
+		return nil, err
+	}
+	topic.committed = stored.Delivered
+	topic.savedDelivered = stored.Delivered
+	topic.storedSubscriptions = stored.Subscriptions
+	if topic.committed < log.firstOffset() {
+		topic.committed = log.firstOffset()
+	}
+	stateChanged := make(chan bool)
+	adder := func(state *factory) {
+		state.topics[topicName] = topic
+		state.subscribers[topicName] = newHandlers(subscribers)
+		state.topicOpened(topicName, "persistent")
+		topic.replayUndelivered(state)
+	}
+	registered := t.modify(&stateModifierSpec{adder, stateChanged, false})
+	close(stateChanged)
+	if !registered {
+		log.close()
+		releaseDirectory(directory)
+		topic.signalClosed()
+		return topic, nil
+	}
+	if options.SyncPolicy == SyncInterval {
+		t.spawn(topic.runSync)
+	}
+	return topic, nil
+}
+
+func (t *persistentTopic) String() string {
+	return t.name
+}
+
+func (t *persistentTopic) NewPublisher() Publisher {
+	publisher := func(event interface{}) {
+		t.publishHops(event, nil)
+	}
+	return publisher
+}
+
+func (t *persistentTopic) publishHops(event interface{}, hops []string) {
+	t.p.publish(t.name, event, func(event interface{}, trace SpanContext) {
+		//counted as queued while it's being stored, so that Shutdown waits for it
+		atomic.AddInt32(&t.p.queued, 1)
+		t.p.spawn(func() {
+			envelope := &Envelope{t.name, 0, t.p.clock.Now(), event, hops, trace, nil}
+			if err := t.store(envelope); err != nil {
+				t.p.settle(&t.p.queued, 1)
+				t.reportError(err)
+				return
+			}
+			t.p.handOver(&eventSpec{t.name, event, 0, envelope, trace})
+		})
+	})
+}
+
+//appends the event to the log, assigning its offset
+func (t *persistentTopic) store(envelope *Envelope) error {
+	payload, err := t.codec.Encode(envelope.Event)
+	if err != nil {
+		return err
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.closed {
+		return errors.New("The persistent topic is closed")
+	}
+	offset, err := t.log.append(payload, envelope.Time)
+	if err != nil {
+		return err
+	}
+	envelope.Offset = offset
+	return t.log.enforceRetention(envelope.Time, t.retained())
+}
+
+//the offset from which events are still needed, by the Topic or by its durable Subscribers; must be called with the lock held
+func (t *persistentTopic) retained() uint64 {
+	keep := t.Committed()
+	for _, committed := range t.storedSubscriptions {
+		if committed < keep {
+			keep = committed
+		}
+	}
+	for _, subscription := range t.subscriptions {
+		if committed := subscription.Committed(); committed < keep {
+			keep = committed
+		}
+	}
+	return keep
+}
+
+func (t *persistentTopic) NewSubscriber(subscriber Subscriber, options ...SubscribeOption) {
+	stateChanged := make(chan bool)
+	adder := func(p *factory) {
+		subscribeOptions := newSubscribeOptions(options)
+		if subscriber != nil && subscribeOptions.subscription.attach(p) {
+			p.addSubscriber(t.name, newHandler(subscriber, subscribeOptions), subscribeOptions.subscription)
+			t.replayUndelivered(p)
+		}
+	}
+	t.p.modify(&stateModifierSpec{adder, stateChanged, false})
+	close(stateChanged)
+}
+
+/*
+Invoked by runFactory before the event is dispatched. Events already dispatched or delivered
+(e.g. by an overlapping replay) are skipped, while events with no Subscribers stay undelivered.
+*/
+func (t *persistentTopic) record(envelope *Envelope) bool {
+	t.progress.Lock()
+	defer t.progress.Unlock()
+	if envelope.Offset < t.committed || t.dispatched[envelope.Offset] || t.delivered[envelope.Offset] {
+		return false
+	}
+	t.event, t.exists = envelope.Event, true
+	if len(t.p.subscribers[t.name]) > 0 {
+		t.dispatched[envelope.Offset] = true
+	}
+	return true
+}
+
+//invoked once the Subscribers the event was dispatched to have returned, outside the factory's go-routine
+func (t *persistentTopic) handled(envelope *Envelope) {
+	t.progress.Lock()
+	delete(t.dispatched, envelope.Offset)
+	t.delivered[envelope.Offset] = true
+	for t.delivered[t.committed] {
+		delete(t.delivered, t.committed)
+		t.committed++
+	}
+	committed := t.committed
+	t.progress.Unlock()
+	if t.options.SyncPolicy == SyncAlways {
+		t.writeOffsets(committed)
+	}
+}
+
+//must run in the factory's go-routine
+func (t *persistentTopic) replayUndelivered(state *factory) {
+	if t.replaying || len(state.subscribers[t.name]) == 0 {
+		return
+	}
+	t.replaying = true
+	from := t.Committed()
+	t.p.spawn(func() {
+		undelivered, err := t.readFrom(from, 0)
+		if err != nil {
+			t.reportError(err)
+		}
+		for _, envelope := range undelivered {
+			t.p.send(&eventSpec{t.name, envelope.Event, 0, envelope, envelope.Trace})
+		}
+		stateChanged := make(chan bool)
+		t.p.modify(&stateModifierSpec{func(*factory) {
+			t.replaying = false
+		}, stateChanged, false})
+		close(stateChanged)
+	})
+}
+
+//reads the stored events at or past the offset, at most limit of them unless it's 0
+func (t *persistentTopic) readFrom(from uint64, limit int) ([]*Envelope, error) {
+	envelopes := []*Envelope{}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.closed {
+		return envelopes, nil
+	}
+	err := t.log.read(from, func(record *logRecord) error {
+		event, err := t.codec.Decode(record.payload)
+		if err != nil {
+			return err
+		}
+		envelopes = append(envelopes, &Envelope{t.name, record.offset, record.time, event, nil, SpanContext{}, nil})
+		if len(envelopes) == limit {
+			return errPageRead
+		}
+		return nil
+	})
+	if err == errPageRead {
+		err = nil
+	}
+	return envelopes, err
+}
+
+func (t *persistentTopic) writeOffsets(delivered uint64) {
+	t.lock.Lock()
+	if delivered > t.savedDelivered {
+		t.savedDelivered = delivered
+	}
+	t.lock.Unlock()
+	t.saveOffsets()
+}
+
+//stores the delivered offset of the Topic, and the committed offsets of its durable Subscribers
+func (t *persistentTopic) saveOffsets() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.closed {
+		return
+	}
+	if err := writeOffsetsFile(t.directory, t.offsets()); err != nil {
+		t.reportError(err)
+	}
+}
+
+//must be called with the lock held
+func (t *persistentTopic) offsets() *storedOffsets {
+	offsets := &storedOffsets{t.savedDelivered, map[string]uint64{}}
+	for name, committed := range t.storedSubscriptions {
+		offsets.Subscriptions[name] = committed
+	}
+	for name, subscription := range t.subscriptions {
+		offsets.Subscriptions[name] = subscription.Committed()
+	}
+	return offsets
+}
+
+/*
+Writes to a temporary file first, so that a crash never leaves a half-written file behind.
+Both the file and the directory are flushed, so that the rename survives a crash too.
+*/
+func writeOffsetsFile(directory string, offsets interface{}) error {
+	bytes, err := json.Marshal(offsets)
+	if err != nil {
+		return err
+	}
+	temporary := filepath.Join(directory, offsetsFile+".tmp")
+	file, err := os.OpenFile(temporary, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(bytes)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err = os.Rename(temporary, filepath.Join(directory, offsetsFile)); err != nil {
+		return err
+	}
+	return syncDirectory(directory)
+}
+
+func syncDirectory(directory string) error {
+	opened, err := os.Open(directory)
+	if err != nil {
+		return err
+	}
+	err = opened.Sync()
+	if closeErr := opened.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (t *persistentTopic) runSync() {
+	interval := t.options.SyncInterval
+	if interval <= 0 {
+		interval = defaultSyncInterval
+	}
+	ticker := t.p.clock.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.stopSync:
+			return
+		case <-t.p.done:
+			return
+		case <-ticker.C():
+			committed := t.Committed()
+			t.lock.Lock()
+			err := t.log.sync()
+			t.lock.Unlock()
+			if err != nil {
+				t.reportError(err)
+			}
+			t.writeOffsets(committed)
+		}
+	}
+}
+
+//Returns the offset up to which all events were delivered
+func (t *persistentTopic) Committed() uint64 {
+	t.progress.Lock()
+	defer t.progress.Unlock()
+	return t.committed
+}
+
+func (t *persistentTopic) reportError(err error) {
+	t.p.log(LevelError, err.Error(), "topic", t.name)
+	if t.options.ErrorHandler != nil {
+		t.options.ErrorHandler(err)
+	}
+}
+
+func (t *persistentTopic) Last() (interface{}, bool) {
+	var (
+		event  interface{}
+		exists bool
+	)
+	stateChanged := make(chan bool)
+	reader := func(p *factory) {
+		event, exists = t.event, t.exists
+	}
+	t.p.modify(&stateModifierSpec{reader, stateChanged, false})
+	close(stateChanged)
+	return event, exists
+}
+
+//Closing a persistent Topic writes its offsets and closes the log; the events are kept on disk.
+func (t *persistentTopic) Close() error {
+	return t.p.closeTopic(t)
+}
+
+//the log and the offsets are written outside the factory's go-routine
+func (t *persistentTopic) detach(state *factory) func() error {
+	if !t.markDetached() {
+		return nil
+	}
+	state.removeTopic(t)
+	return func() error {
+		defer t.signalClosed()
+		return t.release()
+	}
+}
+
+//events whose Subscribers are still running stay undelivered, they are delivered again after a restart
+func (t *persistentTopic) release() error {
+	close(t.stopSync)
+	committed := t.Committed()
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	defer releaseDirectory(t.directory)
+	t.closed = true
+	for _, subscription := range t.subscriptions {
+		close(subscription.stop)
+	}
+	if committed > t.savedDelivered {
+		t.savedDelivered = committed
+	}
+	if err := writeOffsetsFile(t.directory, t.offsets()); err != nil {
+		t.log.close()
+		return err
+	}
+	return t.log.close()
+}
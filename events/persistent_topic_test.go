@@ -0,0 +1,151 @@
+package events
+
+import (
+	"github.com/tholowka/testing/assertions"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+//events count as delivered once their Subscribers returned, which happens after they handed the event over
+func awaitCommitted(topic DurableTopic, committed uint64) {
+	for topic.(*persistentTopic).Committed() < committed {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestThat_PersistentTopic_NeedsStorage(t *testing.T) {
+	assert := assertions.New(t)
+	_, err := NewFactory().NewPersistentTopic("orders", PersistenceOptions{})
+	assert.IsTrue(err != nil)
+}
+
+func TestThat_PersistentTopic_RecoversUndeliveredEvents(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	directory, _ := ioutil.TempDir("", "persistent-topic")
+	defer os.RemoveAll(directory)
+	delivered := make(chan interface{})
+	topic, err := NewFactory(WithStorage(directory)).NewPersistentTopic("orders", PersistenceOptions{}, func(event interface{}) {
+		delivered <- event
+	})
+	assert.IsTrue(err == nil)
+	topic.NewPublisher()("first")
+	assert.AreEqual("first", <-delivered)
+	awaitCommitted(topic, 1)
+	topic.Close()
+	//when published with nobody listening, and the process 'restarts'
+	topic, _ = NewFactory(WithStorage(directory)).NewPersistentTopic("orders", PersistenceOptions{})
+	topic.NewPublisher()("second")
+	for {
+		if last, _ := topic.Last(); last == "second" {
+			break
+		}
+	}
+	topic.Close()
+	topic, _ = NewFactory(WithStorage(directory)).NewPersistentTopic("orders", PersistenceOptions{}, func(event interface{}) {
+		delivered <- event
+	})
+	//then only the undelivered event comes back
+	assert.AreEqual("second", <-delivered)
+	awaitCommitted(topic, 2)
+	topic.Close()
+	topic, _ = NewFactory(WithStorage(directory)).NewPersistentTopic("orders", PersistenceOptions{SyncPolicy: SyncNever})
+	assert.AreEqual(uint64(2), topic.(*persistentTopic).Committed())
+	topic.Close()
+}
+
+func TestThat_PersistentTopic_DeliversStoredEventsToTheFirstSubscriber(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	directory, _ := ioutil.TempDir("", "persistent-topic")
+	defer os.RemoveAll(directory)
+	topic, _ := NewFactory(WithStorage(directory)).NewPersistentTopic("orders", PersistenceOptions{SyncPolicy: SyncInterval})
+	topic.NewPublisher()(map[string]interface{}{"id": "42"})
+	for {
+		if _, exists := topic.Last(); exists {
+			break
+		}
+	}
+	delivered := make(chan interface{})
+	//when
+	topic.NewSubscriber(func(event interface{}) {
+		delivered <- event
+	})
+	//then
+	assert.AreEqual(map[string]interface{}{"id": "42"}, <-delivered)
+	topic.Close()
+}
+
+func TestThat_PersistentTopic_DeliversEventsBeingHandledAgain(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	directory, _ := ioutil.TempDir("", "persistent-topic")
+	defer os.RemoveAll(directory)
+	received := make(chan interface{})
+	release := make(chan bool)
+	topic, _ := NewFactory(WithStorage(directory)).NewPersistentTopic("orders", PersistenceOptions{}, func(event interface{}) {
+		received <- event
+		<-release
+	})
+	topic.NewPublisher()("first")
+	<-received
+	//when the process stops while the Subscriber is still handling the event
+	assert.AreEqual(uint64(0), topic.(*persistentTopic).Committed())
+	topic.Close()
+	close(release)
+	//then
+	delivered := make(chan interface{})
+	topic, _ = NewFactory(WithStorage(directory)).NewPersistentTopic("orders", PersistenceOptions{}, func(event interface{}) {
+		delivered <- event
+	})
+	assert.AreEqual("first", <-delivered)
+	topic.Close()
+}
+
+func TestThat_PersistentTopic_CantBeOpenedTwice(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	directory, _ := ioutil.TempDir("", "persistent-topic")
+	defer os.RemoveAll(directory)
+	topic, _ := NewFactory(WithStorage(directory)).NewPersistentTopic("orders", PersistenceOptions{})
+	//when
+	_, err := NewFactory(WithStorage(directory)).NewPersistentTopic("orders", PersistenceOptions{})
+	//then
+	assert.IsTrue(err != nil)
+	topic.Close()
+	topic, err = NewFactory(WithStorage(directory)).NewPersistentTopic("orders", PersistenceOptions{})
+	assert.IsTrue(err == nil)
+	topic.Close()
+}
+
+func TestThat_PersistentTopic_RetainsUndeliveredEvents(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	directory, _ := ioutil.TempDir("", "persistent-topic")
+	defer os.RemoveAll(directory)
+	options := PersistenceOptions{SegmentBytes: 1, RetentionBytes: 1}
+	topic, _ := NewFactory(WithStorage(directory)).NewPersistentTopic("orders", options)
+	//when published with nobody listening, each event in a segment of its own
+	for _, event := range []string{"first", "second", "third"} {
+		topic.NewPublisher()(event)
+		for {
+			if last, _ := topic.Last(); last == event {
+				break
+			}
+		}
+	}
+	topic.Close()
+	//then
+	delivered := make(chan interface{}, 3)
+	topic, _ = NewFactory(WithStorage(directory)).NewPersistentTopic("orders", options, func(event interface{}) {
+		delivered <- event
+	})
+	received := map[interface{}]bool{}
+	for len(received) < 3 {
+		received[<-delivered] = true
+	}
+	assert.AreEqual(map[interface{}]bool{"first": true, "second": true, "third": true}, received)
+	topic.Close()
+}
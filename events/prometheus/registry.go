@@ -0,0 +1,296 @@
+/*
+Keeps the metrics of events.Factories in memory, and exposes them in the Prometheus text format
+(version 0.0.4), without depending on the Prometheus client libraries:
+
+	registry := prometheus.NewRegistry()
+	factory := events.NewFactory(events.WithMetrics(registry))
+	http.Handle("/metrics", registry)
+
+Metrics reported per topic carry a topic label. A Registry may be shared by several Factories,
+which then add up, as long as each of them reports through a source of its own (see NewSource):
+
+	shared := events.NewFactory(events.WithMetrics(registry.NewSource()))
+*/
+package prometheus
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/tholowka/pub-sub/events"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//the buckets of histograms, in seconds, unless WithBuckets is given
+var defaultBuckets = []float64{.0001, .0005, .001, .005, .01, .05, .1, .5, 1, 5, 10}
+
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+/*
+An events.Metrics keeping the measurements in memory, and an http.Handler serving them.
+*/
+type Registry struct {
+	buckets []float64
+	//guards the fields below
+	lock     sync.Mutex
+	counters map[string]map[string]float64
+	//the value of each gauge per source, the Registry itself being source 0
+	gauges     map[string]map[string]map[int]float64
+	histograms map[string]map[string]*histogram
+	sources    int
+}
+
+/*
+Customizes a Registry at construction time, see NewRegistry.
+*/
+type Option func(*Registry)
+
+/*
+Sets the upper bounds of the buckets of histograms, in seconds.
+By default they range from 100 microseconds to 10 seconds.
+*/
+func WithBuckets(bounds ...float64) Option {
+	return func(r *Registry) {
+		r.buckets = append([]float64{}, bounds...)
+		sort.Float64s(r.buckets)
+	}
+}
+
+func NewRegistry(options ...Option) *Registry {
+	registry := &Registry{
+		buckets:    defaultBuckets,
+		counters:   map[string]map[string]float64{},
+		gauges:     map[string]map[string]map[int]float64{},
+		histograms: map[string]map[string]*histogram{},
+	}
+	for _, option := range options {
+		option(registry)
+	}
+	return registry
+}
+
+type histogram struct {
+	//cumulative counts, one per bucket
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func (r *Registry) Count(name string, topic string, delta float64) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	series(r.counters, name)[topic] += delta
+}
+
+func (r *Registry) Gauge(name string, topic string, value float64) {
+	r.gauge(0, name, topic, value)
+}
+
+func (r *Registry) gauge(source int, name string, topic string, value float64) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	gauges, exists := r.gauges[name]
+	if !exists {
+		gauges = map[string]map[int]float64{}
+		r.gauges[name] = gauges
+	}
+	values, exists := gauges[topic]
+	if !exists {
+		values = map[int]float64{}
+		gauges[topic] = values
+	}
+	values[source] = value
+}
+
+/*
+Returns the Metrics of one more Factory sharing the Registry. Counters and histograms add up anyway,
+while the gauges of each source are kept apart and summed on export, instead of overwriting each other.
+*/
+func (r *Registry) NewSource() events.Metrics {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.sources++
+	return &source{r, r.sources}
+}
+
+type source struct {
+	*Registry
+	id int
+}
+
+func (s *source) Gauge(name string, topic string, value float64) {
+	s.gauge(s.id, name, topic, value)
+}
+
+func (r *Registry) Observe(name string, topic string, value float64) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	histograms, exists := r.histograms[name]
+	if !exists {
+		histograms = map[string]*histogram{}
+		r.histograms[name] = histograms
+	}
+	h, exists := histograms[topic]
+	if !exists {
+		h = &histogram{counts: make([]uint64, len(r.buckets))}
+		histograms[topic] = h
+	}
+	for i, bound := range r.buckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += value
+	h.count++
+}
+
+func series(metrics map[string]map[string]float64, name string) map[string]float64 {
+	values, exists := metrics[name]
+	if !exists {
+		values = map[string]float64{}
+		metrics[name] = values
+	}
+	return values
+}
+
+/*
+Writes all the metrics in the Prometheus text format, sorted by name and topic.
+*/
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	counter := &countingWriter{writer: w}
+	buffered := bufio.NewWriter(counter)
+	r.lock.Lock()
+	for _, name := range sortedNames(r.counters) {
+		writeHeader(buffered, name, "counter")
+		for _, topic := range sortedTopics(r.counters[name]) {
+			writeSample(buffered, name, labels(topic), r.counters[name][topic])
+		}
+	}
+	gauges := map[string]map[string]float64{}
+	for name, topics := range r.gauges {
+		for topic, values := range topics {
+			for _, value := range values {
+				series(gauges, name)[topic] += value
+			}
+		}
+	}
+	for _, name := range sortedNames(gauges) {
+		writeHeader(buffered, name, "gauge")
+		for _, topic := range sortedTopics(gauges[name]) {
+			writeSample(buffered, name, labels(topic), gauges[name][topic])
+		}
+	}
+	histogramNames := []string{}
+	for name := range r.histograms {
+		histogramNames = append(histogramNames, name)
+	}
+	sort.Strings(histogramNames)
+	for _, name := range histogramNames {
+		writeHeader(buffered, name, "histogram")
+		topics := []string{}
+		for topic := range r.histograms[name] {
+			topics = append(topics, topic)
+		}
+		sort.Strings(topics)
+		for _, topic := range topics {
+			h := r.histograms[name][topic]
+			for i, bound := range r.buckets {
+				writeSample(buffered, name+"_bucket", labels(topic, "le", formatValue(bound)), float64(h.counts[i]))
+			}
+			writeSample(buffered, name+"_bucket", labels(topic, "le", "+Inf"), float64(h.count))
+			writeSample(buffered, name+"_sum", labels(topic), h.sum)
+			writeSample(buffered, name+"_count", labels(topic), float64(h.count))
+		}
+	}
+	r.lock.Unlock()
+	err := buffered.Flush()
+	return counter.written, err
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" && req.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	r.WriteTo(w)
+}
+
+type countingWriter struct {
+	writer  io.Writer
+	written int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	w.written += int64(n)
+	return n, err
+}
+
+func sortedNames(metrics map[string]map[string]float64) []string {
+	names := []string{}
+	for name := range metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedTopics(values map[string]float64) []string {
+	topics := []string{}
+	for topic := range values {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+func writeHeader(w io.Writer, name string, kind string) {
+	if help := events.MetricHelp(name); help != "" {
+		fmt.Fprintf(w, "# HELP %v %v\n", name, help)
+	}
+	fmt.Fprintf(w, "# TYPE %v %v\n", name, kind)
+}
+
+func writeSample(w io.Writer, name string, labels string, value float64) {
+	fmt.Fprintf(w, "%v%v %v\n", name, labels, formatValue(value))
+}
+
+//formats the topic label (omitted if empty) followed by the extra name-value pairs
+func labels(topic string, extra ...string) string {
+	pairs := []string{}
+	if topic != "" {
+		pairs = append(pairs, fmt.Sprintf("topic=\"%v\"", escape(topic)))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%v=\"%v\"", extra[i], escape(extra[i+1])))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var escaper = strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n")
+
+func escape(value string) string {
+	return escaper.Replace(value)
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
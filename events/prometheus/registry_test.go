@@ -0,0 +1,113 @@
+package prometheus
+
+import (
+	"bytes"
+	"github.com/tholowka/pub-sub/events"
+	"github.com/tholowka/testing/assertions"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestThat_Registry_WritesTheTextFormat(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	registry := NewRegistry(WithBuckets(1, 0.5))
+	registry.Count(events.MetricPublished, "orders", 1)
+	registry.Count(events.MetricPublished, "orders", 2)
+	registry.Count(events.MetricPublished, "a \"quoted\"\\topic", 1)
+	registry.Gauge(events.MetricTopics, "", 4)
+	registry.Observe(events.MetricSubscriberLatency, "orders", 0.25)
+	registry.Observe(events.MetricSubscriberLatency, "orders", 0.75)
+	registry.Observe(events.MetricSubscriberLatency, "orders", 2)
+	//when
+	output := &bytes.Buffer{}
+	written, err := registry.WriteTo(output)
+	//then
+	assert.IsTrue(err == nil)
+	assert.AreEqual(int64(output.Len()), written)
+	expected := `# HELP events_published_total Events handed to Publishers.
+# TYPE events_published_total counter
+events_published_total{topic="a \"quoted\"\\topic"} 1
+events_published_total{topic="orders"} 3
+# HELP events_topics Open topics, gates included.
+# TYPE events_topics gauge
+events_topics 4
+# HELP events_subscriber_latency_seconds Time Subscribers took to handle events, in seconds.
+# TYPE events_subscriber_latency_seconds histogram
+events_subscriber_latency_seconds_bucket{topic="orders",le="0.5"} 1
+events_subscriber_latency_seconds_bucket{topic="orders",le="1"} 2
+events_subscriber_latency_seconds_bucket{topic="orders",le="+Inf"} 3
+events_subscriber_latency_seconds_sum{topic="orders"} 3
+events_subscriber_latency_seconds_count{topic="orders"} 3
+`
+	assert.AreEqual(expected, output.String())
+}
+
+func TestThat_Registry_WritesUnknownMetrics_WithoutHelp(t *testing.T) {
+	assert := assertions.New(t)
+	registry := NewRegistry()
+	registry.Gauge("custom", "", 1)
+	output := &bytes.Buffer{}
+	registry.WriteTo(output)
+	assert.AreEqual("# TYPE custom gauge\ncustom 1\n", output.String())
+}
+
+func TestThat_Registry_ServesTheMetricsOfAFactory(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	registry := NewRegistry()
+	received := make(chan interface{})
+	topic := events.NewFactory(events.WithMetrics(registry)).NewTopic("orders", func(event interface{}) {
+		received <- event
+	})
+	server := httptest.NewServer(registry)
+	defer server.Close()
+	topic.NewPublisher()("order")
+	<-received
+	//when
+	var body string
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		response, err := http.Get(server.URL)
+		assert.IsTrue(err == nil)
+		assert.AreEqual(contentType, response.Header.Get("Content-Type"))
+		read, _ := ioutil.ReadAll(response.Body)
+		response.Body.Close()
+		if body = string(read); strings.Contains(body, "events_delivered_total") {
+			break
+		}
+	}
+	//then
+	assert.IsTrue(strings.Contains(body, "events_published_total{topic=\"orders\"} 1\n"))
+	assert.IsTrue(strings.Contains(body, "events_delivered_total{topic=\"orders\"} 1\n"))
+	assert.IsTrue(strings.Contains(body, "events_topics 1\n"))
+	assert.IsTrue(strings.Contains(body, "events_subscriber_latency_seconds_count{topic=\"orders\"} 1\n"))
+}
+
+func TestThat_Registry_OnlyServesGet(t *testing.T) {
+	assert := assertions.New(t)
+	recorder := httptest.NewRecorder()
+	NewRegistry().ServeHTTP(recorder, httptest.NewRequest("POST", "/metrics", nil))
+	assert.AreEqual(http.StatusMethodNotAllowed, recorder.Code)
+}
+
+func TestThat_Registry_AddsUpTheGauges_OfFactoriesSharingIt(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	registry := NewRegistry()
+	first := events.NewFactory(events.WithMetrics(registry.NewSource()))
+	defer first.Close()
+	second := events.NewFactory(events.WithMetrics(registry.NewSource()))
+	defer second.Close()
+	//when
+	first.NewTopic("orders")
+	first.NewTopic("payments")
+	second.NewTopic("invoices")
+	//then
+	output := &bytes.Buffer{}
+	registry.WriteTo(output)
+	assert.IsTrue(strings.Contains(output.String(), "events_topics 3\n"))
+}
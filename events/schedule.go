@@ -0,0 +1,245 @@
+package events
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+A schedule answers the question 'when is the next event due', given the time of the previous one.
+A zero time means the schedule has nothing more to offer.
+*/
+type schedule interface {
+	next(time.Time) time.Time
+}
+
+//fires exactly once, at a given point in time (right away, if it has passed already)
+type timerSchedule struct {
+	at    time.Time
+	fired bool
+}
+
+func (s *timerSchedule) next(after time.Time) time.Time {
+	if s.fired {
+		return time.Time{}
+	}
+	s.fired = true
+	return s.at
+}
+
+//fires every interval, shifted randomly by up to +/- jitter
+type jitterSchedule struct {
+	interval time.Duration
+	jitter   time.Duration
+	random   *rand.Rand
+}
+
+func (s *jitterSchedule) next(after time.Time) time.Time {
+	delay := s.interval
+	if s.jitter > 0 {
+		delay = delay - s.jitter + time.Duration(s.random.Int63n(int64(2*s.jitter)+1))
+	}
+	if delay <= 0 {
+		delay = time.Duration(1)
+	}
+	return after.Add(delay)
+}
+
+/*
+A cron schedule, using the classic 5 field notation: minute, hour, day of month, month and day of week.
+Each field is kept as a bit set of the values it matches.
+*/
+type cronSchedule struct {
+	minute, hour, dayOfMonth, month, dayOfWeek uint64
+	location                                   *time.Location
+}
+
+type cronField struct {
+	min, max uint
+	names    map[string]uint
+}
+
+var (
+	minuteField     = cronField{0, 59, nil}
+	hourField       = cronField{0, 23, nil}
+	dayOfMonthField = cronField{1, 31, nil}
+	monthField      = cronField{1, 12, map[string]uint{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	//7 is accepted as an alias for Sunday
+	dayOfWeekField = cronField{0, 7, map[string]uint{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+	cronDescriptors = map[string]string{
+		"@yearly":   "0 0 1 1 *",
+		"@annually": "0 0 1 1 *",
+		"@monthly":  "0 0 1 * *",
+		"@weekly":   "0 0 * * 0",
+		"@daily":    "0 0 * * *",
+		"@midnight": "0 0 * * *",
+		"@hourly":   "0 * * * *",
+	}
+	//a bit marking a field which was given as '*', needed for the day of month/day of week rule
+	starBit = uint64(1) << 63
+)
+
+/*
+Parses a cron expression. Apart from the 5 field notation, descriptors like '@daily' are understood.
+The expression may be preceded by 'CRON_TZ=<location>' or 'TZ=<location>', in which case
+it is evaluated in that time zone, otherwise time.Local is used. Expressions which can never
+match (e.g. '0 0 30 2 *', February 30th) are rejected.
+*/
+func parseCronSchedule(expression string) (*cronSchedule, error) {
+	location := time.Local
+	expression = strings.TrimSpace(expression)
+	if strings.HasPrefix(expression, "CRON_TZ=") || strings.HasPrefix(expression, "TZ=") {
+		parts := strings.SplitN(expression, " ", 2)
+		zone := parts[0][strings.Index(parts[0], "=")+1:]
+		loaded, err := time.LoadLocation(zone)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid time zone in cron expression '%v': %v", expression, err)
+		}
+		location = loaded
+		if len(parts) < 2 {
+			return nil, fmt.Errorf("Missing fields in cron expression '%v'", expression)
+		}
+		expression = strings.TrimSpace(parts[1])
+	}
+	if descriptor, exists := cronDescriptors[strings.ToLower(expression)]; exists {
+		expression = descriptor
+	}
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("Expected 5 fields in cron expression '%v', found %v", expression, len(fields))
+	}
+	parsed := make([]uint64, 5)
+	for i, field := range []cronField{minuteField, hourField, dayOfMonthField, monthField, dayOfWeekField} {
+		bits, err := field.parse(fields[i])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid cron expression '%v': %v", expression, err)
+		}
+		parsed[i] = bits
+	}
+	//Sunday can be either 0 or 7
+	if parsed[4]&(1<<7) != 0 {
+		parsed[4] = parsed[4]&^(1<<7) | 1
+	}
+	cron := &cronSchedule{parsed[0], parsed[1], parsed[2], parsed[3], parsed[4], location}
+	if cron.next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("Cron expression '%v' never matches", expression)
+	}
+	return cron, nil
+}
+
+func (f cronField) parse(field string) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		step := uint(1)
+		if slash := strings.Index(part, "/"); slash >= 0 {
+			parsedStep, err := strconv.ParseUint(part[slash+1:], 10, 8)
+			if err != nil || parsedStep == 0 {
+				return 0, fmt.Errorf("invalid step in '%v'", part)
+			}
+			step = uint(parsedStep)
+			part = part[:slash]
+		}
+		var low, high uint
+		switch {
+		case part == "*" || part == "?":
+			low, high = f.min, f.max
+			if step == 1 {
+				bits = bits | starBit
+			}
+		case strings.Contains(part, "-"):
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if low, err = f.value(bounds[0]); err != nil {
+				return 0, err
+			}
+			if high, err = f.value(bounds[1]); err != nil {
+				return 0, err
+			}
+		default:
+			value, err := f.value(part)
+			if err != nil {
+				return 0, err
+			}
+			low, high = value, value
+			if step > 1 {
+				high = f.max
+			}
+		}
+		if low > high {
+			return 0, fmt.Errorf("invalid range in '%v'", part)
+		}
+		for value := low; value <= high; value += step {
+			bits = bits | 1<<value
+		}
+	}
+	return bits, nil
+}
+
+func (f cronField) value(token string) (uint, error) {
+	if value, exists := f.names[strings.ToLower(token)]; exists {
+		return value, nil
+	}
+	value, err := strconv.ParseUint(token, 10, 8)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value '%v'", token)
+	}
+	if uint(value) < f.min || uint(value) > f.max {
+		return 0, fmt.Errorf("value %v out of range [%v, %v]", value, f.min, f.max)
+	}
+	return uint(value), nil
+}
+
+func (s *cronSchedule) next(after time.Time) time.Time {
+	current := after.In(s.location).Truncate(time.Minute).Add(time.Minute)
+	//five years cover every valid combination, including leap days
+	limit := current.AddDate(5, 0, 0)
+	for current.Before(limit) {
+		if s.month&(1<<uint(current.Month())) == 0 {
+			current = time.Date(current.Year(), current.Month()+1, 1, 0, 0, 0, 0, s.location)
+			continue
+		}
+		if !s.matchesDay(current) {
+			current = time.Date(current.Year(), current.Month(), current.Day()+1, 0, 0, 0, 0, s.location)
+			continue
+		}
+		if s.hour&(1<<uint(current.Hour())) == 0 {
+			current = time.Date(current.Year(), current.Month(), current.Day(), current.Hour()+1, 0, 0, 0, s.location)
+			continue
+		}
+		if s.minute&(1<<uint(current.Minute())) == 0 {
+			current = current.Add(time.Minute)
+			continue
+		}
+		return current
+	}
+	return time.Time{}
+}
+
+//classic cron rule: if both day fields are restricted, a day matching either of them is due
+func (s *cronSchedule) matchesDay(at time.Time) bool {
+	dayOfMonth := s.dayOfMonth&(1<<uint(at.Day())) != 0
+	dayOfWeek := s.dayOfWeek&(1<<uint(at.Weekday())) != 0
+	if s.dayOfMonth&starBit != 0 || s.dayOfWeek&starBit != 0 {
+		return dayOfMonth && dayOfWeek
+	}
+	return dayOfMonth || dayOfWeek
+}
+
+func newJitterSchedule(interval, jitter time.Duration) (*jitterSchedule, error) {
+	if interval <= 0 {
+		return nil, errors.New("The interval of a jittered schedule has to be positive")
+	}
+	if jitter < 0 || jitter > interval {
+		return nil, errors.New("The jitter of a schedule has to be between 0 and its interval")
+	}
+	return &jitterSchedule{interval, jitter, rand.New(rand.NewSource(time.Now().UnixNano()))}, nil
+}
@@ -0,0 +1,63 @@
+package events
+
+import (
+	"github.com/tholowka/testing/assertions"
+	"testing"
+	"time"
+)
+
+func TestThat_CronSchedule_FindsTheNextMinute(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	cron, err := parseCronSchedule("*/5 * * * *")
+	start := time.Date(2015, time.March, 1, 10, 7, 30, 0, time.Local)
+	//when
+	next := cron.next(start)
+	//then
+	assert.IsTrue(err == nil)
+	assert.AreEqual(time.Date(2015, time.March, 1, 10, 10, 0, 0, time.Local), next)
+	assert.AreEqual(time.Date(2015, time.March, 1, 10, 15, 0, 0, time.Local), cron.next(next))
+}
+
+func TestThat_CronSchedule_UnderstandsNamesAndRanges(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	cron, err := parseCronSchedule("30 9 * JAN-MAR MON-FRI")
+	//a Saturday
+	start := time.Date(2015, time.January, 3, 12, 0, 0, 0, time.Local)
+	//then
+	assert.IsTrue(err == nil)
+	assert.AreEqual(time.Date(2015, time.January, 5, 9, 30, 0, 0, time.Local), cron.next(start))
+	assert.AreEqual(time.Date(2016, time.January, 1, 9, 30, 0, 0, time.Local), cron.next(time.Date(2015, time.March, 31, 10, 0, 0, 0, time.Local)))
+}
+
+func TestThat_CronSchedule_UsesTheGivenTimeZone(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	cron, err := parseCronSchedule("CRON_TZ=UTC @daily")
+	start := time.Date(2015, time.June, 1, 23, 0, 0, 0, time.FixedZone("UTC+2", 2*60*60))
+	//then
+	assert.IsTrue(err == nil)
+	assert.AreEqual(time.Date(2015, time.June, 2, 0, 0, 0, 0, time.UTC), cron.next(start))
+}
+
+func TestThat_CronSchedule_RejectsInvalidExpressions(t *testing.T) {
+	assert := assertions.New(t)
+	for _, expression := range []string{"* * * *", "61 * * * *", "*/0 * * * *", "5-1 * * * *", "TZ=Nowhere/Special * * * * *", "0 0 30 2 *"} {
+		_, err := parseCronSchedule(expression)
+		assert.IsTrue(err != nil)
+	}
+}
+
+func TestThat_JitterSchedule_StaysWithinBounds(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	jitter, err := newJitterSchedule(time.Second, 100*time.Millisecond)
+	start := time.Now()
+	//then
+	assert.IsTrue(err == nil)
+	for i := 0; i < 100; i++ {
+		delay := jitter.next(start).Sub(start)
+		assert.IsTrue(delay >= 900*time.Millisecond && delay <= 1100*time.Millisecond)
+	}
+}
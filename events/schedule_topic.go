@@ -0,0 +1,157 @@
+package events
+
+import (
+	"time"
+)
+
+/*
+A Topic publishing a Tick whenever its schedule says so. It backs cron, one-shot
+and jittered topics, and shares the closing semantics of the tickerTopic.
+*/
+type scheduleTopic struct {
+	p            *factory
+	name         string
+	schedule     schedule
+	closeChannel chan bool
+	control      chan func()
+	lastEvent
+	*closedSignal
+	//owned by the runSchedule go-routine
+	sequence   uint64
+	subscribed bool
+}
+
+func (t *scheduleTopic) String() string {
+	return t.name
+}
+
+//Publishing to a scheduled Topic injects an out-of-band, manual Tick, without affecting the schedule.
+//If the published event is a time.Time, it becomes the time of the Tick, otherwise the current time is used.
+func (t *scheduleTopic) NewPublisher() Publisher {
+	publisher := func(event interface{}) {
+		t.p.spawn(func() {
+			t.modify(func() {
+				t.publish(tickTime(event, t.p), true)
+			})
+		})
+	}
+	return publisher
+}
+
+//hands the modifier to the runSchedule go-routine, unless the topic (or its factory) is already closed
+func (t *scheduleTopic) modify(modifier func()) {
+	select {
+	case t.control <- modifier:
+	case <-t.closeChannel:
+	case <-t.p.done:
+	}
+}
+
+func (t *scheduleTopic) publish(snapshot time.Time, manual bool) {
+	t.sequence++
+	event := Tick{snapshot, t.sequence, 0, manual}
+	t.p.publish(t.name, event, func(event interface{}, trace SpanContext) {
+		t.p.enqueue(&eventSpec{t.name, event, -1, nil, trace})
+	})
+}
+
+func (t *scheduleTopic) NewSubscriber(subscriber Subscriber, options ...SubscribeOption) {
+	stateChanged := make(chan bool)
+	adder := func(p *factory) {
+		subscribeOptions := newSubscribeOptions(options)
+		if subscriber != nil && subscribeOptions.subscription.attach(p) {
+			p.addSubscriber(t.name, newHandler(subscriber, subscribeOptions), subscribeOptions.subscription)
+		}
+	}
+	t.p.modify(&stateModifierSpec{adder, stateChanged, false})
+	close(stateChanged)
+	if subscriber != nil {
+		t.modify(func() {
+			t.subscribed = true
+		})
+	}
+}
+
+func (t *scheduleTopic) Last() (interface{}, bool) {
+	var (
+		event  interface{}
+		exists bool
+	)
+	stateChanged := make(chan bool)
+	reader := func(p *factory) {
+		event, exists = t.event, t.exists
+	}
+	t.p.modify(&stateModifierSpec{reader, stateChanged, false})
+	close(stateChanged)
+	return event, exists
+}
+
+func (t *scheduleTopic) Close() error {
+	return t.p.closeTopic(t)
+}
+
+func (t *scheduleTopic) detach(state *factory) func() error {
+	if !t.markDetached() {
+		return nil
+	}
+	state.removeTopic(t)
+	close(t.closeChannel)
+	return func() error {
+		t.signalClosed()
+		return nil
+	}
+}
+
+func runSchedule(topic *scheduleTopic, t *factory) <-chan bool {
+	releaser := make(chan bool)
+	t.spawn(func() {
+		close(releaser)
+		last := t.clock.Now()
+		for {
+			due := topic.schedule.next(last)
+			if due.IsZero() {
+				//nothing more to fire, but the topic stays around (and can be published to) until closed
+				for {
+					select {
+					case <-topic.closeChannel:
+						return
+					case <-t.done:
+						return
+					case modifier := <-topic.control:
+						modifier()
+					}
+				}
+			}
+			//a Tick nobody listens to is lost, hence an overdue one waits for the first Subscriber
+			for !topic.subscribed && !due.After(t.clock.Now()) {
+				select {
+				case <-topic.closeChannel:
+					return
+				case <-t.done:
+					return
+				case modifier := <-topic.control:
+					modifier()
+				}
+			}
+			timer := t.clock.NewTimer(due.Sub(t.clock.Now()))
+			fired := false
+			for !fired {
+				select {
+				case <-topic.closeChannel:
+					timer.Stop()
+					return
+				case <-t.done:
+					timer.Stop()
+					return
+				case modifier := <-topic.control:
+					modifier()
+				case snapshot := <-timer.C():
+					last = due
+					fired = true
+					topic.publish(snapshot, false)
+				}
+			}
+		}
+	})
+	return releaser
+}
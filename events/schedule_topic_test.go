@@ -0,0 +1,102 @@
+package events
+
+import (
+	"github.com/tholowka/testing/assertions"
+	"testing"
+	"time"
+)
+
+func TestThat_TimerTopic_FiresOnce(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	clock := NewManualClock(epoch)
+	fired := make(chan interface{}, 2)
+	timer := NewFactory(WithClock(clock)).NewTimerTopic("timer", epoch.Add(time.Second))
+	timer.NewSubscriber(func(event interface{}) {
+		fired <- event
+	})
+	//when
+	clock.BlockUntil(1)
+	clock.Advance(time.Hour)
+	//then
+	assert.AreEqual(Tick{epoch.Add(time.Second), 1, 0, false}, <-fired)
+	assert.AreEqual(0, len(clock.waiters))
+	assert.AreEqual(0, len(fired))
+	timer.Close()
+}
+
+func TestThat_TimerTopic_InThePast_FiresForTheFirstSubscriber(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	clock := NewManualClock(epoch)
+	fired := make(chan interface{}, 2)
+	timer := NewFactory(WithClock(clock)).NewTimerTopic("timer", epoch.Add(-time.Hour))
+	//when
+	timer.NewSubscriber(func(event interface{}) {
+		fired <- event
+	})
+	//then
+	assert.AreEqual(Tick{epoch, 1, 0, false}, <-fired)
+	clock.Advance(time.Hour)
+	assert.AreEqual(0, len(fired))
+	timer.Close()
+}
+
+func TestThat_JitteredTickerTopic_Pings(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	clock := NewManualClock(epoch)
+	pings := make(chan interface{}, 1)
+	ticker, err := NewFactory(WithClock(clock)).NewJitteredTickerTopic("jittered", 20*time.Millisecond, 10*time.Millisecond)
+	assert.IsTrue(err == nil)
+	ticker.NewSubscriber(func(event interface{}) {
+		pings <- event
+	})
+	last := epoch
+	for sequence := uint64(1); sequence <= 10; sequence++ {
+		//when the clock reaches the next ping
+		clock.BlockUntil(1)
+		clock.lock.Lock()
+		due := clock.waiters[0].deadline
+		clock.lock.Unlock()
+		clock.Advance(due.Sub(clock.Now()))
+		//then it fires, between 10 and 30ms after the previous one
+		assert.AreEqual(Tick{due, sequence, 0, false}, <-pings)
+		elapsed := due.Sub(last)
+		assert.IsTrue(elapsed >= 10*time.Millisecond && elapsed <= 30*time.Millisecond)
+		last = due
+	}
+	ticker.Close()
+}
+
+func TestThat_ClosingScheduleTopicTwice_DoesNotHurt(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	schedule, err := NewFactory().NewScheduleTopic("schedule", "@hourly")
+	assert.IsTrue(err == nil)
+	//when
+	schedule.Close()
+	//then
+	assert.DoesNotThrow(func() {
+		schedule.Close()
+	})
+}
+
+func TestThat_PublishingToAScheduleTopic_InjectsAManualTick(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	clock := NewManualClock(epoch)
+	fired := make(chan interface{})
+	timer := NewFactory(WithClock(clock)).NewTimerTopic("timer", epoch.Add(time.Hour))
+	timer.NewSubscriber(func(event interface{}) {
+		fired <- event
+	})
+	//when
+	timer.NewPublisher()(epoch.Add(time.Minute))
+	//then the manual tick does not consume the schedule
+	assert.AreEqual(Tick{epoch.Add(time.Minute), 1, 0, true}, <-fired)
+	clock.BlockUntil(1)
+	clock.Advance(time.Hour)
+	assert.AreEqual(Tick{epoch.Add(time.Hour), 2, 0, false}, <-fired)
+	timer.Close()
+}
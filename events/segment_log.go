@@ -0,0 +1,263 @@
+package events
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	segmentSuffix = ".log"
+	//length, checksum, offset and time of a record
+	recordHeaderSize = 4 + 4 + 8 + 8
+)
+
+var errCorruptRecord = errors.New("Corrupt record in the segment log")
+
+/*
+An append-only log of records, split into segment files named after the offset of their first record.
+The log is not safe for concurrent use, the persistentTopic guards it.
+*/
+type segmentLog struct {
+	directory  string
+	options    PersistenceOptions
+	segments   []*segment
+	active     *os.File
+	nextOffset uint64
+}
+
+type segment struct {
+	base uint64
+	path string
+	size int64
+	//time of the most recent record in the segment
+	last time.Time
+}
+
+type logRecord struct {
+	offset  uint64
+	time    time.Time
+	payload []byte
+}
+
+func openSegmentLog(directory string, options PersistenceOptions) (*segmentLog, error) {
+	if err := os.MkdirAll(directory, 0755); err != nil {
+		return nil, err
+	}
+	files, err := ioutil.ReadDir(directory)
+	if err != nil {
+		return nil, err
+	}
+	log := &segmentLog{directory: directory, options: options}
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), segmentSuffix) {
+			continue
+		}
+		base, err := strconv.ParseUint(strings.TrimSuffix(file.Name(), segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		log.segments = append(log.segments, &segment{base, filepath.Join(directory, file.Name()), file.Size(), file.ModTime()})
+	}
+	sort.Sort(segmentsByBase(log.segments))
+	if len(log.segments) == 0 {
+		return log, log.rotate(0)
+	}
+	//only the last segment can have a torn write at its end
+	last := log.segments[len(log.segments)-1]
+	log.nextOffset = last.base
+	validSize := int64(0)
+	err = readSegment(last.path, func(record *logRecord, end int64) error {
+		log.nextOffset = record.offset + 1
+		last.last = record.time
+		validSize = end
+		return nil
+	})
+	if err != nil && err != errCorruptRecord {
+		return nil, err
+	}
+	if validSize != last.size {
+		if err = os.Truncate(last.path, validSize); err != nil {
+			return nil, err
+		}
+		last.size = validSize
+	}
+	if log.active, err = os.OpenFile(last.path, os.O_WRONLY|os.O_APPEND, 0644); err != nil {
+		return nil, err
+	}
+	return log, nil
+}
+
+//the offset of the oldest record still kept
+func (l *segmentLog) firstOffset() uint64 {
+	return l.segments[0].base
+}
+
+func (l *segmentLog) append(payload []byte, at time.Time) (uint64, error) {
+	current := l.segments[len(l.segments)-1]
+	if current.size > 0 && current.size+int64(recordHeaderSize+len(payload)) > l.options.segmentBytes() {
+		if err := l.rotate(l.nextOffset); err != nil {
+			return 0, err
+		}
+		current = l.segments[len(l.segments)-1]
+	}
+	offset := l.nextOffset
+	buffer := make([]byte, recordHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(buffer[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint64(buffer[8:16], offset)
+	binary.BigEndian.PutUint64(buffer[16:24], uint64(at.UnixNano()))
+	copy(buffer[recordHeaderSize:], payload)
+	binary.BigEndian.PutUint32(buffer[4:8], crc32.ChecksumIEEE(buffer[8:]))
+	if _, err := l.active.Write(buffer); err != nil {
+		return 0, err
+	}
+	if l.options.SyncPolicy == SyncAlways {
+		if err := l.active.Sync(); err != nil {
+			return 0, err
+		}
+	}
+	current.size += int64(len(buffer))
+	current.last = at
+	l.nextOffset++
+	return offset, nil
+}
+
+//calls the reader for every record at or past the offset, in order
+func (l *segmentLog) read(from uint64, reader func(*logRecord) error) error {
+	for i, segment := range l.segments {
+		if i+1 < len(l.segments) && l.segments[i+1].base <= from {
+			continue
+		}
+		err := readSegment(segment.path, func(record *logRecord, _ int64) error {
+			if record.offset < from {
+				return nil
+			}
+			return reader(record)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *segmentLog) sync() error {
+	if l.active == nil {
+		return nil
+	}
+	return l.active.Sync()
+}
+
+/*
+Drops the oldest segments, as long as the retention limits are exceeded. The active segment is always
+kept, and so are the segments holding events from the given offset on, which are still needed.
+*/
+func (l *segmentLog) enforceRetention(now time.Time, keep uint64) error {
+	for len(l.segments) > 1 && l.segments[1].base <= keep {
+		oldest := l.segments[0]
+		total := int64(0)
+		for _, segment := range l.segments {
+			total += segment.size
+		}
+		tooBig := l.options.RetentionBytes > 0 && total > l.options.RetentionBytes
+		tooOld := l.options.RetentionAge > 0 && now.Sub(oldest.last) > l.options.RetentionAge
+		if !tooBig && !tooOld {
+			return nil
+		}
+		if err := os.Remove(oldest.path); err != nil {
+			return err
+		}
+		l.segments = l.segments[1:]
+	}
+	return nil
+}
+
+func (l *segmentLog) close() error {
+	if l.active == nil {
+		return nil
+	}
+	err := l.active.Sync()
+	if closeErr := l.active.Close(); err == nil {
+		err = closeErr
+	}
+	l.active = nil
+	return err
+}
+
+func (l *segmentLog) rotate(base uint64) error {
+	if l.active != nil {
+		if err := l.close(); err != nil {
+			return err
+		}
+	}
+	path := filepath.Join(l.directory, fmt.Sprintf("%020d%v", base, segmentSuffix))
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	l.active = file
+	l.segments = append(l.segments, &segment{base, path, 0, time.Time{}})
+	return nil
+}
+
+//reads the records of a segment file, stopping with errCorruptRecord at the first damaged one
+func readSegment(path string, reader func(record *logRecord, end int64) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	buffered := bufio.NewReader(file)
+	position := int64(0)
+	header := make([]byte, recordHeaderSize)
+	for {
+		if _, err = io.ReadFull(buffered, header); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return errCorruptRecord
+		}
+		//a length beyond the end of the file is a torn (or damaged) tail, not worth allocating for
+		length := int64(binary.BigEndian.Uint32(header[0:4]))
+		if length > info.Size()-position-recordHeaderSize {
+			return errCorruptRecord
+		}
+		payload := make([]byte, length)
+		if _, err = io.ReadFull(buffered, payload); err != nil {
+			return errCorruptRecord
+		}
+		checksum := crc32.ChecksumIEEE(header[8:])
+		checksum = crc32.Update(checksum, crc32.IEEETable, payload)
+		if checksum != binary.BigEndian.Uint32(header[4:8]) {
+			return errCorruptRecord
+		}
+		position += int64(recordHeaderSize + len(payload))
+		record := &logRecord{
+			binary.BigEndian.Uint64(header[8:16]),
+			time.Unix(0, int64(binary.BigEndian.Uint64(header[16:24]))),
+			payload,
+		}
+		if err = reader(record, position); err != nil {
+			return err
+		}
+	}
+}
+
+type segmentsByBase []*segment
+
+func (s segmentsByBase) Len() int           { return len(s) }
+func (s segmentsByBase) Less(i, j int) bool { return s[i].base < s[j].base }
+func (s segmentsByBase) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
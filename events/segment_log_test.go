@@ -0,0 +1,115 @@
+package events
+
+import (
+	"github.com/tholowka/testing/assertions"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func readAll(log *segmentLog, from uint64) []string {
+	payloads := []string{}
+	log.read(from, func(record *logRecord) error {
+		payloads = append(payloads, string(record.payload))
+		return nil
+	})
+	return payloads
+}
+
+func TestThat_SegmentLog_ReadsBackAppendedRecords(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	directory, _ := ioutil.TempDir("", "segment-log")
+	defer os.RemoveAll(directory)
+	log, err := openSegmentLog(directory, PersistenceOptions{SegmentBytes: 64})
+	assert.IsTrue(err == nil)
+	//when
+	for _, payload := range []string{"zero", "one", "two", "three", "four"} {
+		log.append([]byte(payload), epoch)
+	}
+	//then the small segment size forces rotations
+	assert.IsTrue(len(log.segments) > 1)
+	assert.AreEqual([]string{"zero", "one", "two", "three", "four"}, readAll(log, 0))
+	assert.AreEqual([]string{"three", "four"}, readAll(log, 3))
+	log.close()
+}
+
+func TestThat_SegmentLog_RecoversFromATornWrite(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	directory, _ := ioutil.TempDir("", "segment-log")
+	defer os.RemoveAll(directory)
+	log, _ := openSegmentLog(directory, PersistenceOptions{})
+	log.append([]byte("zero"), epoch)
+	log.append([]byte("one"), epoch)
+	path := log.segments[0].path
+	log.close()
+	stat, _ := os.Stat(path)
+	os.Truncate(path, stat.Size()-1)
+	//when
+	log, err := openSegmentLog(directory, PersistenceOptions{})
+	//then
+	assert.IsTrue(err == nil)
+	assert.AreEqual(uint64(1), log.nextOffset)
+	offset, _ := log.append([]byte("again"), epoch)
+	assert.AreEqual(uint64(1), offset)
+	assert.AreEqual([]string{"zero", "again"}, readAll(log, 0))
+	log.close()
+}
+
+func TestThat_SegmentLog_TreatsALengthBeyondTheEndAsATornWrite(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	directory, _ := ioutil.TempDir("", "segment-log")
+	defer os.RemoveAll(directory)
+	log, _ := openSegmentLog(directory, PersistenceOptions{})
+	log.append([]byte("zero"), epoch)
+	path := log.segments[0].path
+	log.close()
+	file, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	file.Write(append([]byte{0xff, 0xff, 0xff, 0xff}, make([]byte, recordHeaderSize-4)...))
+	file.Close()
+	//when
+	log, err := openSegmentLog(directory, PersistenceOptions{})
+	//then
+	assert.IsTrue(err == nil)
+	assert.AreEqual(uint64(1), log.nextOffset)
+	assert.AreEqual([]string{"zero"}, readAll(log, 0))
+	log.close()
+}
+
+func TestThat_SegmentLog_DropsOldSegments(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	directory, _ := ioutil.TempDir("", "segment-log")
+	defer os.RemoveAll(directory)
+	log, _ := openSegmentLog(directory, PersistenceOptions{SegmentBytes: 30, RetentionAge: time.Hour})
+	log.append([]byte("old"), epoch)
+	log.append([]byte("new"), epoch.Add(2*time.Hour))
+	//when
+	log.enforceRetention(epoch.Add(2*time.Hour), 1)
+	//then
+	assert.AreEqual(uint64(1), log.firstOffset())
+	assert.AreEqual([]string{"new"}, readAll(log, 0))
+	files, _ := filepath.Glob(filepath.Join(directory, "*"+segmentSuffix))
+	assert.AreEqual(1, len(files))
+	log.close()
+}
+
+func TestThat_SegmentLog_KeepsSegmentsWithUndeliveredRecords(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	directory, _ := ioutil.TempDir("", "segment-log")
+	defer os.RemoveAll(directory)
+	log, _ := openSegmentLog(directory, PersistenceOptions{SegmentBytes: 30, RetentionAge: time.Hour})
+	log.append([]byte("old"), epoch)
+	log.append([]byte("new"), epoch.Add(2*time.Hour))
+	//when nothing was delivered yet
+	log.enforceRetention(epoch.Add(2*time.Hour), 0)
+	//then
+	assert.AreEqual(uint64(0), log.firstOffset())
+	assert.AreEqual([]string{"old", "new"}, readAll(log, 0))
+	log.close()
+}
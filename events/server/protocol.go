@@ -0,0 +1,159 @@
+/*
+Serves the Topics of an events.Factory over a TCP or Unix socket, so that other processes
+can publish and subscribe to them (see events/client).
+
+The wire protocol
+
+A connection carries a stream of JSON objects, one per line, in both directions (see Frame).
+Every object has an 'op' field telling what it is. Payloads of events are encoded with the
+Codec registered for the Topic (JSON by default) on either side, carried base64-encoded in
+the 'payload' field, and the name of the Codec in the 'codec' field. Durations and times are
+given in nanoseconds (times since the Unix epoch).
+
+Right after accepting a connection, the server sends:
+
+	{"op":"hello","session":"<id>"}
+
+The session identifies the Server instance, so that a reconnecting client can tell whether
+it talks to the same Factory again (e.g. whether offsets it has seen still make sense).
+
+Requests sent by clients carry an 'id'. Every request with a non-zero id is answered with
+a reply carrying the same id, and an 'error' in case it failed:
+
+	{"op":"reply","id":7,"error":"No topic named 'orders'"}
+
+Requests are handled one at a time, in the order they were sent. These are:
+
+	{"op":"create","id":1,"topic":"orders","kind":"topic"}
+
+Creates a Topic, unless one with that name exists already, which the reply tells with 'exists'.
+The kind is one of 'topic', 'retained' and 'replay' (with a 'capacity', see WithMaxCapacity),
+'ticker' (with an 'interval', and 'immediate' to tick right away), 'schedule' (with an
+'expression'), 'timer' (with 'at') and 'jittered' (with an 'interval' and a 'jitter').
+
+	{"op":"gate","id":2,"kind":"and","topics":["orders","payments"]}
+
+Creates an AND (or an 'or') gate of existing Topics, the reply tells its name in the 'topic' field.
+
+	{"op":"publish","topic":"orders","codec":"json","payload":"eyJpZCI6NDJ9"}
+
+Publishes an event, nil if there's no codec. Usually sent without an id, as nothing is replied.
+
+	{"op":"subscribe","id":3,"topic":"orders","subscription":1,"from":"offset","offset":42}
+
+Subscribes to a Topic. Events are then sent with the subscription number chosen by the client:
+
+	{"op":"event","topic":"orders","subscription":1,"offset":42,"time":1445412480000000000,"codec":"json","payload":"eyJpZCI6NDJ9"}
+
+The optional 'from' is one of 'beginning', 'offset' (with an 'offset') and 'time' (with a 'time'),
+see events.FromBeginning, events.FromOffset and events.FromTime. Like the Subscribers of a local
+Factory, events of a subscription may arrive in a different order than they were published.
+Subscriptions end with the connection. A client which doesn't read its events fast enough to
+keep up is disconnected.
+
+	{"op":"last","id":4,"topic":"orders"}
+
+Replies with the most recent event of the Topic ('exists', 'codec' and 'payload').
+
+	{"op":"control","id":5,"topic":"ticks","action":"reset","interval":1000000000}
+
+Pauses, resumes or resets (with a new 'interval') a ticker Topic.
+
+	{"op":"close","id":6,"topic":"orders"}
+
+Closes a Topic.
+
+	{"op":"list","id":8}
+
+Replies with the names of the open Topics in the 'topics' field, and their kinds in the 'kinds' field,
+in the same order. Timer and jittered Topics are reported as 'schedule' ones, persistent Topics as 'persistent'.
+
+	{"op":"describe","id":9}
+
+Replies with the state of the Factory (see events.FactoryDescription) in the 'description' field.
+
+	{"op":"topology","id":10}
+
+Replies with the graph of the Factory (see events.Topology) in the 'topology' field.
+*/
+package server
+
+import (
+	"github.com/tholowka/pub-sub/events"
+)
+
+/*
+A single message of the wire protocol, in either direction. Fields not used by an op are omitted.
+*/
+type Frame struct {
+	Op           string                     `json:"op"`
+	Id           uint64                     `json:"id,omitempty"`
+	Topic        string                     `json:"topic,omitempty"`
+	Kind         string                     `json:"kind,omitempty"`
+	Topics       []string                   `json:"topics,omitempty"`
+	Kinds        []string                   `json:"kinds,omitempty"`
+	Capacity     int                        `json:"capacity,omitempty"`
+	Interval     int64                      `json:"interval,omitempty"`
+	Immediate    bool                       `json:"immediate,omitempty"`
+	Jitter       int64                      `json:"jitter,omitempty"`
+	Expression   string                     `json:"expression,omitempty"`
+	At           int64                      `json:"at,omitempty"`
+	Action       string                     `json:"action,omitempty"`
+	Subscription uint64                     `json:"subscription,omitempty"`
+	From         string                     `json:"from,omitempty"`
+	Offset       uint64                     `json:"offset,omitempty"`
+	Time         int64                      `json:"time,omitempty"`
+	Codec        string                     `json:"codec,omitempty"`
+	Payload      []byte                     `json:"payload,omitempty"`
+	Exists       bool                       `json:"exists,omitempty"`
+	Session      string                     `json:"session,omitempty"`
+	Error        string                     `json:"error,omitempty"`
+	Description  *events.FactoryDescription `json:"description,omitempty"`
+	Topology     *events.Topology           `json:"topology,omitempty"`
+}
+
+//ops of the protocol
+const (
+	OpHello     = "hello"
+	OpReply     = "reply"
+	OpCreate    = "create"
+	OpGate      = "gate"
+	OpPublish   = "publish"
+	OpSubscribe = "subscribe"
+	OpEvent     = "event"
+	OpLast      = "last"
+	OpControl   = "control"
+	OpClose     = "close"
+	OpList      = "list"
+	OpDescribe  = "describe"
+	OpTopology  = "topology"
+)
+
+//kinds of Topics, see OpCreate and OpGate
+const (
+	KindTopic    = "topic"
+	KindRetained = "retained"
+	KindReplay   = "replay"
+	KindTicker   = "ticker"
+	KindSchedule = "schedule"
+	KindTimer    = "timer"
+	KindJittered = "jittered"
+	KindAnd      = "and"
+	KindOr       = "or"
+	//only reported by OpList, clients can't create persistent Topics
+	KindPersistent = "persistent"
+)
+
+//where a subscription starts, see OpSubscribe
+const (
+	FromBeginning = "beginning"
+	FromOffset    = "offset"
+	FromTime      = "time"
+)
+
+//actions of OpControl
+const (
+	ActionPause  = "pause"
+	ActionResume = "resume"
+	ActionReset  = "reset"
+)
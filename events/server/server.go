@@ -0,0 +1,502 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/tholowka/pub-sub/events"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	//the number of frames waiting to be written to a connection, before the client is disconnected
+	outgoingFrames = 256
+	//the largest capacity of a Topic created by a client, see WithMaxCapacity
+	defaultMaxCapacity = 10000
+)
+
+/*
+Serves the Topics of a Factory to clients connecting over the network, see the package
+documentation for the protocol. Closing the Server does not close the Factory.
+*/
+type Server struct {
+	factory      events.Factory
+	codecs       map[string]events.Codec
+	errorHandler func(error)
+	maxCapacity  int
+	session      string
+	//serializes the creation of Topics, so that clients share Topics with the same name
+	creating sync.Mutex
+	//guards the fields below
+	lock        sync.Mutex
+	listeners   map[net.Listener]bool
+	connections map[*connection]bool
+	closed      bool
+}
+
+/*
+Customizes a Server at construction time, see New.
+*/
+type Option func(*Server)
+
+/*
+Makes the Server encode and decode the events of the Topic with the given name using the Codec,
+instead of the one the Factory uses for it (see events.WithCodec).
+Clients have to use a Codec with the same name for that Topic.
+*/
+func WithCodec(topicName string, codec events.Codec) Option {
+	return func(s *Server) {
+		s.codecs[topicName] = codec
+	}
+}
+
+/*
+Invoked when a request of a client fails, or an event can't be encoded.
+Failed requests are replied to with the error as well, unless sent without an id.
+*/
+func WithErrorHandler(handler func(error)) Option {
+	return func(s *Server) {
+		s.errorHandler = handler
+	}
+}
+
+/*
+Limits the capacity of retained and replay Topics created by clients, 10000 events by default.
+Larger capacities are refused, as the Topics keep that many events in memory.
+*/
+func WithMaxCapacity(capacity int) Option {
+	return func(s *Server) {
+		s.maxCapacity = capacity
+	}
+}
+
+func New(factory events.Factory, options ...Option) *Server {
+	server := &Server{
+		factory:     factory,
+		codecs:      map[string]events.Codec{},
+		maxCapacity: defaultMaxCapacity,
+		session:     newSession(),
+		listeners:   map[net.Listener]bool{},
+		connections: map[*connection]bool{},
+	}
+	for _, option := range options {
+		option(server)
+	}
+	return server
+}
+
+func newSession() string {
+	random := make([]byte, 8)
+	if _, err := rand.Read(random); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(random)
+}
+
+/*
+Listens on the given network ('tcp', 'unix'...) and address, and serves clients until the Server is closed.
+*/
+func (s *Server) ListenAndServe(network string, address string) error {
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		return err
+	}
+	return s.Serve(listener)
+}
+
+/*
+Accepts clients on the listener until the Server is closed, which closes the listener.
+Returns nil once closed, or the error which made accepting clients fail.
+*/
+func (s *Server) Serve(listener net.Listener) error {
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		listener.Close()
+		return errors.New("The server is closed")
+	}
+	s.listeners[listener] = true
+	s.lock.Unlock()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			s.lock.Lock()
+			closed := s.closed
+			delete(s.listeners, listener)
+			s.lock.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+		connection := newConnection(s, conn)
+		s.lock.Lock()
+		if s.closed {
+			s.lock.Unlock()
+			conn.Close()
+			return nil
+		}
+		s.connections[connection] = true
+		s.lock.Unlock()
+		go connection.run()
+	}
+}
+
+/*
+Stops accepting clients and disconnects the connected ones. Their subscriptions end, while
+the Topics they created stay open.
+*/
+func (s *Server) Close() error {
+	s.lock.Lock()
+	s.closed = true
+	listeners := s.listeners
+	connections := s.connections
+	s.listeners = map[net.Listener]bool{}
+	s.connections = map[*connection]bool{}
+	s.lock.Unlock()
+	var err error
+	for listener := range listeners {
+		if closeErr := listener.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	for connection := range connections {
+		connection.close()
+	}
+	return err
+}
+
+func (s *Server) codecFor(topicName string) events.Codec {
+	if codec, exists := s.codecs[topicName]; exists {
+		return codec
+	}
+	return s.factory.CodecFor(topicName)
+}
+
+func (s *Server) reportError(err error) {
+	if s.errorHandler != nil {
+		s.errorHandler(err)
+	}
+}
+
+func (s *Server) forget(connection *connection) {
+	s.lock.Lock()
+	delete(s.connections, connection)
+	s.lock.Unlock()
+}
+
+/*
+A connected client. Frames are read and handled in the connection's go-routine, and
+written by another one, so that slow clients never hold up the Factory's Subscribers:
+they are disconnected once the outgoing frames pile up. The Subscribers of the connection
+are registered under its Subscription, and removed when it closes.
+*/
+type connection struct {
+	server       *Server
+	conn         net.Conn
+	outgoing     chan *Frame
+	done         chan bool
+	closeOnce    sync.Once
+	subscription *events.Subscription
+}
+
+func newConnection(server *Server, conn net.Conn) *connection {
+	return &connection{
+		server:       server,
+		conn:         conn,
+		outgoing:     make(chan *Frame, outgoingFrames),
+		done:         make(chan bool),
+		subscription: events.NewSubscription(),
+	}
+}
+
+func (c *connection) run() {
+	defer c.close()
+	go c.write()
+	c.send(&Frame{Op: OpHello, Session: c.server.session})
+	decoder := json.NewDecoder(c.conn)
+	for {
+		frame := &Frame{}
+		if err := decoder.Decode(frame); err != nil {
+			return
+		}
+		reply, err := c.handle(frame)
+		if err != nil {
+			c.server.reportError(err)
+		}
+		if frame.Id != 0 {
+			if reply == nil {
+				reply = &Frame{}
+			}
+			reply.Op, reply.Id = OpReply, frame.Id
+			if err != nil {
+				reply.Error = err.Error()
+			}
+			c.send(reply)
+		}
+	}
+}
+
+func (c *connection) write() {
+	encoder := json.NewEncoder(c.conn)
+	for {
+		select {
+		case <-c.done:
+			return
+		case frame := <-c.outgoing:
+			if err := encoder.Encode(frame); err != nil {
+				c.close()
+				return
+			}
+		}
+	}
+}
+
+//queues the frame, unless the connection is closed; disconnects the client if it can't keep up
+func (c *connection) send(frame *Frame) {
+	select {
+	case c.outgoing <- frame:
+	case <-c.done:
+	default:
+		c.server.reportError(fmt.Errorf("Disconnecting %v, which is more than %v frames behind", c.conn.RemoteAddr(), outgoingFrames))
+		c.close()
+	}
+}
+
+func (c *connection) close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.conn.Close()
+		c.server.forget(c)
+		c.subscription.Unsubscribe()
+	})
+}
+
+func (c *connection) isClosed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *connection) handle(frame *Frame) (*Frame, error) {
+	switch frame.Op {
+	case OpCreate:
+		return c.create(frame)
+	case OpGate:
+		return c.gate(frame)
+	case OpPublish:
+		return nil, c.publish(frame)
+	case OpSubscribe:
+		return nil, c.subscribe(frame)
+	case OpLast:
+		return c.last(frame)
+	case OpControl:
+		return nil, c.control(frame)
+	case OpClose:
+		topic, err := c.lookup(frame.Topic)
+		if err != nil {
+			return nil, err
+		}
+		return nil, topic.Close()
+	case OpList:
+		names, kinds := []string{}, []string{}
+		for _, topic := range c.server.factory.Describe().Topics {
+			names = append(names, topic.Name)
+			kinds = append(kinds, kindOf(topic))
+		}
+		return &Frame{Topics: names, Kinds: kinds}, nil
+	case OpDescribe:
+		description := c.server.factory.Describe()
+		return &Frame{Description: &description}, nil
+	case OpTopology:
+		topology := c.server.factory.Topology()
+		return &Frame{Topology: &topology}, nil
+	}
+	return nil, fmt.Errorf("Unknown op '%v'", frame.Op)
+}
+
+//the kind of a described Topic, as the create and gate ops name it
+func kindOf(topic events.TopicDescription) string {
+	if topic.Kind == "gate" {
+		return topic.Operator
+	}
+	return topic.Kind
+}
+
+func (c *connection) lookup(topicName string) (events.Topic, error) {
+	topic, exists := c.server.factory.Lookup(topicName)
+	if !exists {
+		return nil, fmt.Errorf("No topic named '%v'", topicName)
+	}
+	return topic, nil
+}
+
+//tells whether the Topic existed already, so that clients only close the Topics they created
+func (c *connection) create(frame *Frame) (*Frame, error) {
+	factory := c.server.factory
+	c.server.creating.Lock()
+	defer c.server.creating.Unlock()
+	if _, exists := factory.Lookup(frame.Topic); exists {
+		return &Frame{Exists: true}, nil
+	}
+	if (frame.Kind == KindRetained || frame.Kind == KindReplay) && frame.Capacity > c.server.maxCapacity {
+		return nil, fmt.Errorf("The capacity %v of the topic '%v' exceeds the limit of %v", frame.Capacity, frame.Topic, c.server.maxCapacity)
+	}
+	var err error
+	switch frame.Kind {
+	case KindTopic:
+		factory.NewTopic(frame.Topic)
+	case KindRetained:
+		factory.NewRetainedTopic(frame.Topic, frame.Capacity)
+	case KindReplay:
+		factory.NewReplayTopic(frame.Topic, frame.Capacity)
+	case KindTicker:
+		if frame.Interval <= 0 {
+			return nil, errors.New("A ticker topic needs a positive interval")
+		}
+		settings := events.TickerSettings{Immediate: frame.Immediate}
+		factory.NewTickerTopic(frame.Topic, time.Duration(frame.Interval), settings.Options()...)
+	case KindSchedule:
+		_, err = factory.NewScheduleTopic(frame.Topic, frame.Expression)
+	case KindTimer:
+		factory.NewTimerTopic(frame.Topic, time.Unix(0, frame.At))
+	case KindJittered:
+		_, err = factory.NewJitteredTickerTopic(frame.Topic, time.Duration(frame.Interval), time.Duration(frame.Jitter))
+	default:
+		err = fmt.Errorf("Unknown kind of topic '%v'", frame.Kind)
+	}
+	return nil, err
+}
+
+func (c *connection) gate(frame *Frame) (*Frame, error) {
+	topics := []events.Topic{}
+	for _, topicName := range frame.Topics {
+		topic, err := c.lookup(topicName)
+		if err != nil {
+			return nil, err
+		}
+		topics = append(topics, topic)
+	}
+	var gate events.Topic
+	switch frame.Kind {
+	case KindAnd:
+		gate = c.server.factory.AndGate(topics)
+	case KindOr:
+		gate = c.server.factory.OrGate(topics)
+	default:
+		return nil, fmt.Errorf("Unknown kind of gate '%v'", frame.Kind)
+	}
+	return &Frame{Topic: gate.String()}, nil
+}
+
+func (c *connection) publish(frame *Frame) error {
+	topic, err := c.lookup(frame.Topic)
+	if err != nil {
+		return err
+	}
+	var event interface{}
+	if frame.Codec != "" {
+		if event, err = c.decode(frame); err != nil {
+			return err
+		}
+	}
+	topic.NewPublisher()(event)
+	return nil
+}
+
+func (c *connection) decode(frame *Frame) (interface{}, error) {
+	codec := c.server.codecFor(frame.Topic)
+	if frame.Codec != codec.Name() {
+		return nil, fmt.Errorf("Topic '%v' uses the '%v' codec, got '%v'", frame.Topic, codec.Name(), frame.Codec)
+	}
+	return codec.Decode(frame.Payload)
+}
+
+func (c *connection) subscribe(frame *Frame) error {
+	topic, err := c.lookup(frame.Topic)
+	if err != nil {
+		return err
+	}
+	options := []events.SubscribeOption{events.WithEnvelope(), events.WithSubscription(c.subscription)}
+	switch frame.From {
+	case "":
+	case FromBeginning:
+		options = append(options, events.FromBeginning())
+	case FromOffset:
+		options = append(options, events.FromOffset(frame.Offset))
+	case FromTime:
+		options = append(options, events.FromTime(time.Unix(0, frame.Time)))
+	default:
+		return fmt.Errorf("Unknown subscription start '%v'", frame.From)
+	}
+	codec := c.server.codecFor(frame.Topic)
+	subscription := frame.Subscription
+	topic.NewSubscriber(func(event interface{}) {
+		//events dispatched before the connection closed may still arrive
+		if c.isClosed() {
+			return
+		}
+		envelope := event.(*events.Envelope)
+		payload, err := codec.Encode(envelope.Event)
+		if err != nil {
+			c.server.reportError(err)
+			return
+		}
+		c.send(&Frame{
+			Op:           OpEvent,
+			Topic:        envelope.Topic,
+			Subscription: subscription,
+			Offset:       envelope.Offset,
+			Time:         envelope.Time.UnixNano(),
+			Codec:        codec.Name(),
+			Payload:      payload,
+		})
+	}, options...)
+	return nil
+}
+
+func (c *connection) last(frame *Frame) (*Frame, error) {
+	topic, err := c.lookup(frame.Topic)
+	if err != nil {
+		return nil, err
+	}
+	event, exists := topic.Last()
+	if !exists {
+		return &Frame{}, nil
+	}
+	codec := c.server.codecFor(frame.Topic)
+	payload, err := codec.Encode(event)
+	if err != nil {
+		return nil, err
+	}
+	return &Frame{Exists: true, Codec: codec.Name(), Payload: payload}, nil
+}
+
+func (c *connection) control(frame *Frame) error {
+	topic, err := c.lookup(frame.Topic)
+	if err != nil {
+		return err
+	}
+	ticker, isTicker := topic.(events.TickerTopic)
+	if !isTicker {
+		return fmt.Errorf("Topic '%v' is not a ticker topic", frame.Topic)
+	}
+	switch frame.Action {
+	case ActionPause:
+		ticker.Pause()
+	case ActionResume:
+		ticker.Resume()
+	case ActionReset:
+		return ticker.Reset(time.Duration(frame.Interval))
+	default:
+		return fmt.Errorf("Unknown control action '%v'", frame.Action)
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package server
+
+import (
+	"encoding/json"
+	"github.com/tholowka/pub-sub/events"
+	"github.com/tholowka/testing/assertions"
+	"net"
+	"testing"
+	"time"
+)
+
+//a client speaking the raw protocol
+type rawClient struct {
+	conn    net.Conn
+	encoder *json.Encoder
+	decoder *json.Decoder
+}
+
+func serve(factory events.Factory) (*Server, string) {
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	server := New(factory)
+	go server.Serve(listener)
+	return server, listener.Addr().String()
+}
+
+func dial(address string) *rawClient {
+	conn, _ := net.Dial("tcp", address)
+	return &rawClient{conn, json.NewEncoder(conn), json.NewDecoder(conn)}
+}
+
+func (c *rawClient) send(frame *Frame) {
+	c.encoder.Encode(frame)
+}
+
+func (c *rawClient) receive() *Frame {
+	frame := &Frame{}
+	c.decoder.Decode(frame)
+	return frame
+}
+
+func TestThat_Server_SaysHello(t *testing.T) {
+	assert := assertions.New(t)
+	server, address := serve(events.NewFactory())
+	defer server.Close()
+	client := dial(address)
+	defer client.conn.Close()
+	hello := client.receive()
+	assert.AreEqual(OpHello, hello.Op)
+	assert.IsTrue(hello.Session != "")
+}
+
+func TestThat_Server_ForwardsEvents_OfSubscribedTopics(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	factory := events.NewFactory()
+	server, address := serve(factory)
+	defer server.Close()
+	client := dial(address)
+	defer client.conn.Close()
+	client.receive()
+	client.send(&Frame{Op: OpCreate, Id: 1, Topic: "orders", Kind: KindTopic})
+	assert.AreEqual(&Frame{Op: OpReply, Id: 1}, client.receive())
+	client.send(&Frame{Op: OpSubscribe, Id: 2, Topic: "orders", Subscription: 5})
+	assert.AreEqual(&Frame{Op: OpReply, Id: 2}, client.receive())
+	//when
+	client.send(&Frame{Op: OpPublish, Topic: "orders", Codec: "json", Payload: []byte(`{"id":42}`)})
+	//then
+	event := client.receive()
+	assert.AreEqual(OpEvent, event.Op)
+	assert.AreEqual(uint64(5), event.Subscription)
+	assert.AreEqual("json", event.Codec)
+	assert.AreEqual(`{"id":42}`, string(event.Payload))
+	topic, exists := factory.Lookup("orders")
+	assert.IsTrue(exists)
+	last, _ := topic.Last()
+	assert.AreEqual(map[string]interface{}{"id": float64(42)}, last)
+}
+
+func TestThat_Server_RepliesWithErrors(t *testing.T) {
+	assert := assertions.New(t)
+	server, address := serve(events.NewFactory())
+	defer server.Close()
+	client := dial(address)
+	defer client.conn.Close()
+	client.receive()
+	client.send(&Frame{Op: OpPublish, Id: 1, Topic: "missing", Codec: "json", Payload: []byte(`1`)})
+	assert.AreEqual("No topic named 'missing'", client.receive().Error)
+	client.send(&Frame{Op: OpCreate, Id: 2, Topic: "schedule", Kind: KindSchedule, Expression: "not cron"})
+	assert.IsTrue(client.receive().Error != "")
+	client.send(&Frame{Op: OpCreate, Id: 3, Topic: "orders", Kind: KindTopic})
+	client.receive()
+	client.send(&Frame{Op: OpPublish, Id: 4, Topic: "orders", Codec: "gob", Payload: []byte(`1`)})
+	assert.AreEqual("Topic 'orders' uses the 'json' codec, got 'gob'", client.receive().Error)
+}
+
+func TestThat_Server_ListsTopics_AndCreatesGates(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	factory := events.NewFactory()
+	factory.NewTopic("b")
+	factory.NewTopic("a")
+	server, address := serve(factory)
+	defer server.Close()
+	client := dial(address)
+	defer client.conn.Close()
+	client.receive()
+	//when
+	client.send(&Frame{Op: OpGate, Id: 1, Kind: KindOr, Topics: []string{"a", "b"}})
+	gate := client.receive().Topic
+	client.send(&Frame{Op: OpList, Id: 2})
+	//then
+	reply := client.receive()
+	assert.AreEqual([]string{gate, "a", "b"}, reply.Topics)
+	assert.AreEqual([]string{KindOr, KindTopic, KindTopic}, reply.Kinds)
+}
+
+func TestThat_Server_RemovesTheSubscribers_OfClosedConnections(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	factory := events.NewFactory()
+	factory.NewTopic("orders")
+	server, address := serve(factory)
+	defer server.Close()
+	client := dial(address)
+	client.receive()
+	client.send(&Frame{Op: OpSubscribe, Id: 1, Topic: "orders", Subscription: 1})
+	client.receive()
+	assert.AreEqual(1, factory.Describe().Topics[0].Subscribers)
+	//when
+	client.conn.Close()
+	//then
+	for factory.Describe().Topics[0].Subscribers != 0 {
+		<-time.After(time.Millisecond)
+	}
+}
+
+func TestThat_Server_RefusesCapacitiesBeyondTheLimit(t *testing.T) {
+	assert := assertions.New(t)
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	server := New(events.NewFactory(), WithMaxCapacity(10))
+	go server.Serve(listener)
+	defer server.Close()
+	client := dial(listener.Addr().String())
+	defer client.conn.Close()
+	client.receive()
+	client.send(&Frame{Op: OpCreate, Id: 1, Topic: "orders", Kind: KindReplay, Capacity: 11})
+	assert.AreEqual("The capacity 11 of the topic 'orders' exceeds the limit of 10", client.receive().Error)
+	client.send(&Frame{Op: OpCreate, Id: 2, Topic: "orders", Kind: KindReplay, Capacity: 10})
+	assert.AreEqual(&Frame{Op: OpReply, Id: 2}, client.receive())
+	client.send(&Frame{Op: OpCreate, Id: 3, Topic: "orders", Kind: KindReplay, Capacity: 10})
+	assert.AreEqual(&Frame{Op: OpReply, Id: 3, Exists: true}, client.receive())
+}
+
+func TestThat_Server_DisconnectsClients_FallingBehind(t *testing.T) {
+	//given
+	factory := events.NewFactory()
+	topic := factory.NewTopic("orders")
+	server, address := serve(factory)
+	defer server.Close()
+	client := dial(address)
+	defer client.conn.Close()
+	client.receive()
+	client.send(&Frame{Op: OpSubscribe, Id: 1, Topic: "orders", Subscription: 1})
+	client.receive()
+	//when the client stops reading
+	payload := make([]byte, 64*1024)
+	for i := 0; i < 4*outgoingFrames; i++ {
+		topic.NewPublisher()(payload)
+	}
+	//then
+	connected := func() int {
+		server.lock.Lock()
+		defer server.lock.Unlock()
+		return len(server.connections)
+	}
+	for connected() != 0 {
+		<-time.After(time.Millisecond)
+	}
+}
+
+func TestThat_Server_DecodesEvents_WithTheCodecOfTheFactory(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	type order struct {
+		Id int `json:"id"`
+	}
+	received := make(chan interface{})
+	factory := events.NewFactory(events.WithCodec("orders", events.NewJSONCodec(order{})))
+	factory.NewTopic("orders", func(event interface{}) {
+		received <- event
+	})
+	server, address := serve(factory)
+	defer server.Close()
+	client := dial(address)
+	defer client.conn.Close()
+	client.receive()
+	//when
+	client.send(&Frame{Op: OpPublish, Topic: "orders", Codec: "json", Payload: []byte(`{"id":42}`)})
+	//then
+	assert.AreEqual(order{42}, <-received)
+}
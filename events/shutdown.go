@@ -0,0 +1,82 @@
+package events
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+/*
+What a Factory left behind when shutting down, see Factory.Shutdown.
+*/
+type ShutdownReport struct {
+	//events published after the shutdown started, which were dropped
+	Rejected int
+	//events which hadn't reached their Subscribers yet when the context expired
+	Queued int
+	//Subscribers still running when the context expired, they aren't interrupted
+	InFlight int
+	//go-routines of the Factory (e.g. of durable Subscribers) still running when the context expired
+	Routines int
+	//events waiting for their Topic to be opened, per topic name
+	Requeued map[string]int
+}
+
+//tells whether any published event was lost
+func (r ShutdownReport) Abandoned() bool {
+	return r.Rejected > 0 || r.Queued > 0 || r.InFlight > 0 || len(r.Requeued) > 0
+}
+
+func (t *factory) Shutdown(ctx context.Context) (ShutdownReport, error) {
+	if t.advance(factoryDraining) {
+		t.log(LevelInfo, "Factory shutting down", "factory", t.id)
+	}
+	for _, topic := range t.Topics() {
+		switch topic.(type) {
+		case *tickerTopic, *scheduleTopic:
+			topic.Close()
+		}
+	}
+	err := t.awaitSettled(ctx, t.drained)
+	report := ShutdownReport{Rejected: int(atomic.LoadInt32(&t.rejected)), Requeued: t.Describe().Requeued}
+	if err != nil {
+		report.Queued = int(atomic.LoadInt32(&t.queued))
+		report.InFlight = int(atomic.LoadInt32(&t.inFlight))
+	}
+	t.Close()
+	//the go-routines of the factory return once it's closed (see spawn), unless they run a Subscriber
+	if err == nil {
+		if err = t.awaitSettled(ctx, t.stopped); err != nil {
+			report.Routines = int(atomic.LoadInt32(&t.routines))
+		}
+	}
+	return report, err
+}
+
+//waits until the condition holds, checking it again whenever a counter settles
+func (t *factory) awaitSettled(ctx context.Context, condition func() bool) error {
+	for !condition() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.settled:
+		}
+	}
+	return nil
+}
+
+//tells whether no events are on their way to Subscribers, nor Subscribers running
+func (t *factory) drained() bool {
+	return atomic.LoadInt32(&t.queued) == 0 && atomic.LoadInt32(&t.inFlight) == 0
+}
+
+//tells whether all go-routines of the factory returned
+func (t *factory) stopped() bool {
+	return atomic.LoadInt32(&t.routines) == 0
+}
+
+//drops an event published while the Factory is shutting down, or after it's closed
+func (t *factory) reject(topicName string, state int32) {
+	atomic.AddInt32(&t.rejected, 1)
+	t.metrics.Count(MetricDropped, topicName, 1)
+	t.log(LevelWarn, "Event rejected", "topic", topicName, "state", factoryStates[state])
+}
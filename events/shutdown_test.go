@@ -0,0 +1,149 @@
+package events
+
+import (
+	"context"
+	"github.com/tholowka/testing/assertions"
+	"io/ioutil"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestThat_Shutdown_WaitsForRunningSubscribers(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	f := NewFactory()
+	started, release := make(chan bool), make(chan bool)
+	finished := int32(0)
+	f.NewTopic("orders", func(interface{}) {
+		started <- true
+		<-release
+		atomic.StoreInt32(&finished, 1)
+	}).NewPublisher()("one")
+	<-started
+	//when
+	done := make(chan ShutdownReport)
+	go func() {
+		report, err := f.Shutdown(context.Background())
+		assert.IsTrue(err == nil)
+		done <- report
+	}()
+	select {
+	case <-done:
+		t.Fatal("Shutdown returned while a Subscriber was running")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	report := <-done
+	//then
+	assert.AreEqual(int32(1), atomic.LoadInt32(&finished))
+	assert.IsTrue(!report.Abandoned())
+	assert.AreEqual(0, len(f.Topics()))
+}
+
+func TestThat_Shutdown_RejectsEvents_PublishedWhileDraining(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	f := NewFactory()
+	delivered := int32(0)
+	invoices := f.NewTopic("invoices", func(interface{}) {
+		atomic.AddInt32(&delivered, 1)
+	})
+	started, release := make(chan bool), make(chan bool)
+	f.NewTopic("orders", func(interface{}) {
+		started <- true
+		<-release
+		invoices.NewPublisher()("invoice")
+	}).NewPublisher()("order")
+	<-started
+	//when
+	done := make(chan ShutdownReport)
+	go func() {
+		report, _ := f.Shutdown(context.Background())
+		done <- report
+	}()
+	for f.(*factory).lifecycle() != factoryDraining {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	report := <-done
+	//then
+	assert.AreEqual(1, report.Rejected)
+	assert.AreEqual(int32(0), atomic.LoadInt32(&delivered))
+	assert.IsTrue(report.Abandoned())
+}
+
+func TestThat_Shutdown_ReportsAbandonedSubscribers_WhenTheContextExpires(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	f := NewFactory()
+	started, release := make(chan bool), make(chan bool)
+	defer close(release)
+	f.NewTopic("orders", func(interface{}) {
+		started <- true
+		<-release
+	}).NewPublisher()("one")
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	//when
+	report, err := f.Shutdown(ctx)
+	//then
+	assert.IsTrue(err == context.DeadlineExceeded)
+	assert.AreEqual(1, report.InFlight)
+	assert.AreEqual(0, report.Queued)
+}
+
+func TestThat_Shutdown_ReportsRequeuedEvents(t *testing.T) {
+	assert := assertions.New(t)
+	f := NewFactory(WithClock(NewManualClock(time.Now())))
+	topic := f.NewTopic("orders")
+	topic.Close()
+	topic.NewPublisher()("one")
+	report, err := f.Shutdown(context.Background())
+	assert.IsTrue(err == nil)
+	assert.AreEqual(map[string]int{"orders": 1}, report.Requeued)
+}
+
+func TestThat_Shutdown_StopsTickers(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	f := NewFactory()
+	ticks := int32(0)
+	ticker := f.NewTickerTopic("ticks", time.Millisecond)
+	ticker.NewSubscriber(func(interface{}) {
+		atomic.AddInt32(&ticks, 1)
+	})
+	for atomic.LoadInt32(&ticks) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	//when
+	_, err := f.Shutdown(context.Background())
+	//then
+	assert.IsTrue(err == nil)
+	stopped := atomic.LoadInt32(&ticks)
+	time.Sleep(20 * time.Millisecond)
+	assert.AreEqual(stopped, atomic.LoadInt32(&ticks))
+}
+
+func TestThat_Shutdown_WaitsForTheGoRoutinesOfTheFactory(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	directory, _ := ioutil.TempDir("", "shutdown")
+	defer os.RemoveAll(directory)
+	f := NewFactory(WithStorage(directory), WithBroker(NewInProcessBroker(), "brokered"))
+	topic, _ := f.NewPersistentTopic("invoices", PersistenceOptions{SyncPolicy: SyncInterval})
+	received := make(chan interface{}, 1)
+	topic.NewDurableSubscriber("billing", func(event interface{}) {
+		received <- event
+	})
+	topic.NewPublisher()("one")
+	f.NewTopic("brokered").NewPublisher()("two")
+	//when
+	report, err := f.Shutdown(context.Background())
+	//then
+	assert.IsTrue(err == nil)
+	assert.AreEqual(0, report.Routines)
+	assert.AreEqual(int32(0), atomic.LoadInt32(&f.(*factory).routines))
+}
@@ -4,6 +4,14 @@ type simpleTopic struct {
 	p             *factory
 	name          string
 	optionalState interface{}
+	lastEvent
+	*closedSignal
+	//non-nil for retained and replay topics
+	history *history
+	//retained topics replay their history to every Subscriber
+	replayByDefault bool
+	//set for gates
+	gate *gateInputs
 }
 
 func (t *simpleTopic) String() string {
@@ -12,37 +20,74 @@ func (t *simpleTopic) String() string {
 
 func (t *simpleTopic) NewPublisher() Publisher {
     publisher := func(event interface{}) {
-        //it's crucial this is in a go-routine: running 2+ Publishers in the same
-        //go-routine causes a deadlock without this.
-        go func() {
-            t.p.events<- &eventSpec { t.name, event, 0 }
-        }()
+        t.p.publish(t.name, event, func(event interface{}, trace SpanContext) {
+            //it's crucial this is sent from a go-routine (see enqueue): running 2+ Publishers
+            //in the same go-routine causes a deadlock without this. Unless delivered inline.
+            t.p.deliverPublished(&eventSpec { t.name, event, 0, nil, trace })
+        })
     }
     return publisher
 }
 
-func (t *simpleTopic) NewSubscriber(subscriber Subscriber) {
+func (t *simpleTopic) publishHops(event interface{}, hops []string) {
+	t.p.publish(t.name, event, func(event interface{}, trace SpanContext) {
+		t.p.deliverPublished(&eventSpec{t.name, event, 0, &Envelope{t.name, 0, t.p.clock.Now(), event, hops, trace, nil}, trace})
+	})
+}
+
+func (t *simpleTopic) NewSubscriber(subscriber Subscriber, options ...SubscribeOption) {
 	stateChanged := make(chan bool)
 	adder := func(p *factory) {
-		if subscriber != nil {
-			p.subscribers[t.name] = append(p.subscribers[t.name], subscriber)
+		subscribeOptions := newSubscribeOptions(options)
+		if subscriber != nil && subscribeOptions.subscription.attach(p) {
+			handler := newHandler(subscriber, subscribeOptions)
+			from := subscribeOptions.from
+			if from == nil && t.replayByDefault {
+				from = &position{beginning: true}
+			}
+			if t.history != nil && from != nil {
+				handler = p.replayingHandler(t.name, handler, t.history.since(from), from)
+			}
+			p.addSubscriber(t.name, handler, subscribeOptions.subscription)
 		}
 	}
-	t.p.stateModifier <- &stateModifierSpec{adder, stateChanged, false}
-	<-stateChanged
+	t.p.modify(&stateModifierSpec{adder, stateChanged, false})
 	close(stateChanged)
 }
 
-func (t *simpleTopic) Close() error {
+func (t *simpleTopic) record(envelope *Envelope) bool {
+	t.lastEvent.record(envelope)
+	if t.history != nil {
+		t.history.record(envelope)
+	}
+	return true
+}
+
+func (t *simpleTopic) Last() (interface{}, bool) {
+	var (
+		event  interface{}
+		exists bool
+	)
 	stateChanged := make(chan bool)
-	remover := func(state *factory) {
-		if _, exists := state.topics[t.name]; exists {
-			delete(state.topics, t.name)
-			delete(state.subscribers, t.name)
-		}
+	reader := func(p *factory) {
+		event, exists = t.event, t.exists
 	}
-	t.p.stateModifier <- &stateModifierSpec{remover, stateChanged, false}
-	<-stateChanged
+	t.p.modify(&stateModifierSpec{reader, stateChanged, false})
 	close(stateChanged)
-	return nil
+	return event, exists
+}
+
+func (t *simpleTopic) Close() error {
+	return t.p.closeTopic(t)
+}
+
+func (t *simpleTopic) detach(state *factory) func() error {
+	if !t.markDetached() {
+		return nil
+	}
+	state.removeTopic(t)
+	return func() error {
+		t.signalClosed()
+		return nil
+	}
 }
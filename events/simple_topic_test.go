@@ -111,3 +111,37 @@ func Benchmark_Parallel_Topics(b *testing.B) {
 		}
 	})
 }
+
+func TestThat_Unsubscribing_RemovesTheSubscribers(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	f := NewFactory()
+	topic := f.NewTopic("orders")
+	other := f.NewTopic("payments")
+	subscription := NewSubscription()
+	removed := make(chan interface{}, 3)
+	kept := make(chan interface{})
+	topic.NewSubscriber(func(event interface{}) {
+		removed <- event
+	}, WithSubscription(subscription))
+	other.NewSubscriber(func(event interface{}) {
+		removed <- event
+	}, WithSubscription(subscription))
+	topic.NewSubscriber(func(event interface{}) {
+		kept <- event
+	})
+	//when
+	subscription.Unsubscribe()
+	topic.NewSubscriber(func(event interface{}) {
+		removed <- event
+	}, WithSubscription(subscription))
+	topic.NewPublisher()("order")
+	//then
+	assert.AreEqual("order", <-kept)
+	description := f.Describe()
+	assert.AreEqual(1, description.Topics[0].Subscribers)
+	assert.AreEqual(0, description.Topics[1].Subscribers)
+	assert.AreEqual(0, len(removed))
+	subscription.Unsubscribe()
+	f.Close()
+}
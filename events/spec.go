@@ -4,11 +4,6 @@ import (
     "time"
 )
 
-type spec struct {
-    name string
-    loggingMethod func(string, ...interface{})
-}
-
 type timeoutSpec struct {
     name string
     timeout time.Duration
@@ -23,6 +18,8 @@ type eventSpec struct {
     name string
     event interface{}
 	delay time.Duration //if the value is negative, there is no requeue
+	envelope *Envelope //set if the Topic has already assigned the offset and time, e.g. when stored
+	trace SpanContext //the span of the publication, see WithTracer
 }
 
 type stateModifierSpec struct {
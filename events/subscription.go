@@ -0,0 +1,273 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+/*
+An event together with the information the Topic keeps about it. Subscribers registered
+with the WithEnvelope option receive a *Envelope instead of the bare event.
+
+Offsets are assigned per Topic, start at 0 and grow by one with every event delivered through it.
+*/
+type Envelope struct {
+	Topic  string
+	Offset uint64
+	Time   time.Time
+	Event  interface{}
+	//The Factories the event was forwarded through (see Bridge), starting with the one
+	//it was published in. Empty for events which were not forwarded.
+	Hops []string
+	//The span the event is handled in, see WithTracer. Zero for events which aren't traced.
+	Trace SpanContext
+	//set for events delivered to durable Subscribers
+	acknowledger acknowledger
+}
+
+/*
+Customizes the way a Subscriber is registered, see Topic.NewSubscriber.
+*/
+type SubscribeOption func(*subscribeOptions)
+
+type subscribeOptions struct {
+	from              *position
+	envelope          bool
+	manualAck         bool
+	visibilityTimeout time.Duration
+	subscription      *Subscription
+}
+
+//where a Subscriber wants to start from, in terms of the events a Topic has kept
+type position struct {
+	beginning bool
+	offset    uint64
+	time      time.Time
+}
+
+/*
+Starts the Subscriber at the event with the given offset. If the Topic has already dropped it,
+the Subscriber starts at the oldest event the Topic still keeps.
+Only Topics keeping a history of events (see Factory.NewReplayTopic) can replay events.
+*/
+func FromOffset(offset uint64) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.from = &position{offset: offset}
+	}
+}
+
+/*
+Starts the Subscriber at the first event delivered at or after the given time.
+*/
+func FromTime(at time.Time) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.from = &position{time: at}
+	}
+}
+
+/*
+Starts the Subscriber at the oldest event the Topic still keeps.
+*/
+func FromBeginning() SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.from = &position{beginning: true}
+	}
+}
+
+/*
+Makes the Subscriber receive a *Envelope, carrying the offset and time of each event.
+*/
+func WithEnvelope() SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.envelope = true
+	}
+}
+
+/*
+Registers the Subscriber under the Subscription, so that it can be removed from the Topic again.
+Topics of a remote Factory (see events/client) don't support it, their Subscribers end with the Client.
+*/
+func WithSubscription(subscription *Subscription) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.subscription = subscription
+	}
+}
+
+/*
+A handle removing Subscribers from their Topics, see WithSubscription. A Subscription can
+hold Subscribers of several Topics, even of several Factories. Events dispatched before
+Unsubscribe returns may still be delivered, Subscribers registered afterwards are ignored.
+*/
+type Subscription struct {
+	lock         sync.Mutex
+	factories    map[*factory]bool
+	unsubscribed bool
+}
+
+func NewSubscription() *Subscription {
+	return &Subscription{factories: map[*factory]bool{}}
+}
+
+/*
+Removes the Subscribers registered under the Subscription from their Topics. Safe to call
+more than once, and from Subscribers.
+*/
+func (s *Subscription) Unsubscribe() {
+	s.lock.Lock()
+	s.unsubscribed = true
+	factories := s.factories
+	s.factories = map[*factory]bool{}
+	s.lock.Unlock()
+	for p := range factories {
+		stateChanged := make(chan bool)
+		remover := func(state *factory) {
+			state.removeSubscription(s)
+		}
+		p.modify(&stateModifierSpec{remover, stateChanged, false})
+		close(stateChanged)
+	}
+}
+
+//must run in the factory's go-routine; false if the Subscription ended already, true without a Subscription
+func (s *Subscription) attach(p *factory) bool {
+	if s == nil {
+		return true
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.unsubscribed {
+		return false
+	}
+	s.factories[p] = true
+	return true
+}
+
+func newSubscribeOptions(options []SubscribeOption) *subscribeOptions {
+	result := &subscribeOptions{}
+	for _, option := range options {
+		option(result)
+	}
+	return result
+}
+
+//tells whether the envelope is at or past the position
+func (p *position) reached(envelope *Envelope) bool {
+	switch {
+	case p.beginning:
+		return true
+	case !p.time.IsZero():
+		return !envelope.Time.Before(p.time)
+	default:
+		return envelope.Offset >= p.offset
+	}
+}
+
+/*
+What the factory actually invokes for every event. Subscribers provided by clients
+are wrapped into handlers, see newHandler.
+*/
+type handler func(*Envelope)
+
+func newHandler(subscriber Subscriber, options *subscribeOptions) handler {
+	if options.envelope {
+		return func(envelope *Envelope) {
+			copied := *envelope
+			subscriber(&copied)
+		}
+	}
+	return func(envelope *Envelope) {
+		subscriber(envelope.Event)
+	}
+}
+
+//a handler registered with a Topic, together with the Subscription removing it (if any)
+type registeredHandler struct {
+	handle       handler
+	subscription *Subscription
+}
+
+func newHandlers(subscribers []Subscriber) []*registeredHandler {
+	handlers := []*registeredHandler{}
+	for _, subscriber := range subscribers {
+		if subscriber != nil {
+			handlers = append(handlers, &registeredHandler{handle: newHandler(subscriber, &subscribeOptions{})})
+		}
+	}
+	return handlers
+}
+
+//must run in the factory's go-routine, after the Subscription was attached (see Subscription.attach)
+func (p *factory) addSubscriber(topicName string, handle handler, subscription *Subscription) {
+	p.subscribers[topicName] = append(p.subscribers[topicName], &registeredHandler{handle, subscription})
+	p.subscriberAdded(topicName)
+}
+
+//must run in the factory's go-routine
+func (p *factory) removeSubscription(subscription *Subscription) {
+	for topicName, handlers := range p.subscribers {
+		kept := []*registeredHandler{}
+		for _, registered := range handlers {
+			if registered.subscription != subscription {
+				kept = append(kept, registered)
+			}
+		}
+		if len(kept) < len(handlers) {
+			p.subscribers[topicName] = kept
+			p.subscriberRemoved(topicName)
+		}
+	}
+}
+
+/*
+The combined effect of SubscribeOptions, for Topics implemented outside of this package
+(e.g. by events/client, which passes them on to a remote Factory).
+*/
+type SubscribeSettings struct {
+	//true if any of FromOffset, FromTime or FromBeginning was given
+	Replay            bool
+	FromBeginning     bool
+	FromOffset        uint64
+	FromTime          time.Time
+	Envelope          bool
+	ManualAck         bool
+	VisibilityTimeout time.Duration
+}
+
+func ReadSubscribeOptions(options ...SubscribeOption) SubscribeSettings {
+	resolved := newSubscribeOptions(options)
+	settings := SubscribeSettings{
+		Envelope:          resolved.envelope,
+		ManualAck:         resolved.manualAck,
+		VisibilityTimeout: resolved.visibilityTimeout,
+	}
+	if resolved.from != nil {
+		settings.Replay = true
+		settings.FromBeginning = resolved.from.beginning
+		settings.FromOffset = resolved.from.offset
+		settings.FromTime = resolved.from.time
+	}
+	return settings
+}
+
+//Turns the settings back into the SubscribeOptions they were read from.
+func (s SubscribeSettings) Options() []SubscribeOption {
+	options := []SubscribeOption{}
+	switch {
+	case !s.Replay:
+	case s.FromBeginning:
+		options = append(options, FromBeginning())
+	case !s.FromTime.IsZero():
+		options = append(options, FromTime(s.FromTime))
+	default:
+		options = append(options, FromOffset(s.FromOffset))
+	}
+	if s.ManualAck {
+		options = append(options, ManualAck())
+	} else if s.Envelope {
+		options = append(options, WithEnvelope())
+	}
+	if s.VisibilityTimeout > 0 {
+		options = append(options, VisibilityTimeout(s.VisibilityTimeout))
+	}
+	return options
+}
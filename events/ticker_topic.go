@@ -1,66 +1,246 @@
 package events
 
 import (
+	"fmt"
 	"time"
 )
 
+/*
+The event published by ticker and schedule Topics. Sequence numbers start at 1 and grow with every tick.
+Missed counts the intervals which passed without a tick since the previous one, as the Topic's
+go-routine fell behind its Ticker (which drops ticks then), e.g. while the process was suspended.
+Subscribers are not involved: each of them runs in a go-routine of its own, so a slow one doesn't
+make the Topic miss ticks. Manual ticks are the ones injected through the Topic's Publisher.
+
+Ticker Topics used to publish plain time.Time values. That's a breaking change for Subscribers
+type-asserting the event to a time.Time: they have to take the Time of the Tick instead.
+*/
+type Tick struct {
+	Time     time.Time
+	Sequence uint64
+	Missed   uint64
+	Manual   bool
+}
+
+/*
+Customizes a ticker Topic at construction time, see Factory.NewTickerTopic.
+*/
+type TickerOption func(*tickerTopic)
+
+/*
+Makes the ticker Topic fire once right away, instead of waiting for the first interval to pass.
+Since a Tick nobody listens to is lost, the immediate Tick is fired as soon as the first Subscriber is registered.
+*/
+func TickImmediately() TickerOption {
+	return func(t *tickerTopic) {
+		t.immediate = true
+	}
+}
+
+/*
+The combined effect of TickerOptions, for Topics implemented outside of this package
+(e.g. by events/client, which passes them on to a remote Factory).
+*/
+type TickerSettings struct {
+	Immediate bool
+}
+
+func ReadTickerOptions(options ...TickerOption) TickerSettings {
+	resolved := &tickerTopic{}
+	for _, option := range options {
+		option(resolved)
+	}
+	return TickerSettings{Immediate: resolved.immediate}
+}
+
+//Turns the settings back into the TickerOptions they were read from.
+func (s TickerSettings) Options() []TickerOption {
+	options := []TickerOption{}
+	if s.Immediate {
+		options = append(options, TickImmediately())
+	}
+	return options
+}
+
 type tickerTopic struct {
 	p            *factory
 	name         string
-	ticker       *time.Ticker
+	ticker       Ticker
 	closeChannel chan bool
+	control      chan func()
+	lastEvent
+	*closedSignal
+	//the fields below are owned by the runTicker go-routine
+	interval  time.Duration
+	immediate bool
+	started   bool
+	paused    bool
+	sequence  uint64
+	last      time.Time
 }
 
 func (t *tickerTopic) String() string {
 	return t.name
 }
 
+//Publishing to a ticker Topic injects an out-of-band, manual Tick (e.g. for a 'refresh now' action).
+//If the published event is a time.Time, it becomes the time of the Tick, otherwise the current time is used.
 func (t *tickerTopic) NewPublisher() Publisher {
-	panic("Tickers can't be published to")
+	publisher := func(event interface{}) {
+		t.p.spawn(func() {
+			t.modify(func() {
+				t.sequence++
+				t.publish(Tick{tickTime(event, t.p), t.sequence, 0, true})
+			})
+		})
+	}
+	return publisher
 }
 
-func (t *tickerTopic) NewSubscriber(subscriber Subscriber) {
+func (t *tickerTopic) NewSubscriber(subscriber Subscriber, options ...SubscribeOption) {
 	stateChanged := make(chan bool)
 	adder := func(p *factory) {
-		if subscriber != nil {
-			p.subscribers[t.name] = append(p.subscribers[t.name], subscriber)
+		subscribeOptions := newSubscribeOptions(options)
+		if subscriber != nil && subscribeOptions.subscription.attach(p) {
+			p.addSubscriber(t.name, newHandler(subscriber, subscribeOptions), subscribeOptions.subscription)
 		}
 	}
-	t.p.stateModifier <- &stateModifierSpec{adder, stateChanged, false}
-	<-stateChanged
+	t.p.modify(&stateModifierSpec{adder, stateChanged, false})
 	close(stateChanged)
+	if t.immediate {
+		t.modify(func() {
+			if !t.started {
+				t.started = true
+				t.tick(t.p.clock.Now())
+			}
+		})
+	}
 }
 
-func (t *tickerTopic) Close() error {
-	stateChanged := make(chan bool)
-	remover := func(state *factory) {
-		if _, exists := state.topics[t.name]; exists {
-			delete(state.topics, t.name)
-			delete(state.subscribers, t.name)
-			close(t.closeChannel)
+func (t *tickerTopic) Pause() {
+	t.modify(func() {
+		if !t.paused {
+			t.paused = true
 			t.ticker.Stop()
+			//a tick might have been waiting already
+			select {
+			case <-t.ticker.C():
+			default:
+			}
 		}
+	})
+}
+
+func (t *tickerTopic) Resume() {
+	t.modify(func() {
+		if t.paused {
+			t.paused = false
+			t.ticker.Reset(t.interval)
+			t.last = t.p.clock.Now()
+		}
+	})
+}
+
+func (t *tickerTopic) Reset(interval time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("Non-positive interval %v for the ticker topic '%v'", interval, t.name)
 	}
-	t.p.stateModifier <- &stateModifierSpec{remover, stateChanged, false}
-	<-stateChanged
-	close(stateChanged)
+	t.modify(func() {
+		t.interval = interval
+		if !t.paused {
+			t.ticker.Reset(interval)
+			t.last = t.p.clock.Now()
+		}
+	})
 	return nil
 }
 
+//runs the modifier in the runTicker go-routine, unless the topic (or its factory) is already closed
+func (t *tickerTopic) modify(modifier func()) {
+	modified := make(chan bool)
+	select {
+	case t.control <- func() {
+		modifier()
+		close(modified)
+	}:
+		<-modified
+	case <-t.closeChannel:
+	case <-t.p.done:
+	}
+}
+
+func (t *tickerTopic) tick(snapshot time.Time) {
+	var missed uint64
+	if elapsed := snapshot.Sub(t.last); elapsed > t.interval {
+		missed = uint64((elapsed+t.interval/2)/t.interval) - 1
+	}
+	t.sequence++
+	t.last = snapshot
+	t.publish(Tick{snapshot, t.sequence, missed, false})
+}
+
+func (t *tickerTopic) publish(event Tick) {
+	t.p.publish(t.name, event, func(event interface{}, trace SpanContext) {
+		t.p.enqueue(&eventSpec{t.name, event, -1, nil, trace})
+	})
+}
+
+func tickTime(event interface{}, p *factory) time.Time {
+	if at, isTime := event.(time.Time); isTime {
+		return at
+	}
+	return p.clock.Now()
+}
+
+func (t *tickerTopic) Last() (interface{}, bool) {
+	var (
+		event  interface{}
+		exists bool
+	)
+	stateChanged := make(chan bool)
+	reader := func(p *factory) {
+		event, exists = t.event, t.exists
+	}
+	t.p.modify(&stateModifierSpec{reader, stateChanged, false})
+	close(stateChanged)
+	return event, exists
+}
+
+func (t *tickerTopic) Close() error {
+	return t.p.closeTopic(t)
+}
+
+func (t *tickerTopic) detach(state *factory) func() error {
+	if !t.markDetached() {
+		return nil
+	}
+	state.removeTopic(t)
+	close(t.closeChannel)
+	t.ticker.Stop()
+	return func() error {
+		t.signalClosed()
+		return nil
+	}
+}
+
 func runTicker(topic *tickerTopic, t *factory) <-chan bool {
     releaser := make(chan bool)
-    go func() {
+    t.spawn(func() {
         close(releaser)
+        topic.last = t.clock.Now()
         for ;; {
             select {
             case <-topic.closeChannel:
                 return
-            case snapshot := <-topic.ticker.C:
-                go func() {
-                    t.events<- &eventSpec { topic.name, snapshot, -1 }
-                }()
+            case <-t.done:
+                topic.ticker.Stop()
+                return
+            case modifier := <-topic.control:
+                modifier()
+            case snapshot := <-topic.ticker.C():
+                topic.tick(snapshot)
             }
         }
-    }()
+    })
     return releaser
 }
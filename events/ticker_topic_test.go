@@ -34,3 +34,101 @@ func TestThat_CallingCloseTwice_DoesNotHurt(t *testing.T) {
 		timer.Close()
 	})
 }
+
+func TestThat_TickerTopic_CanTickImmediately(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	clock := NewManualClock(epoch)
+	ticks := make(chan interface{})
+	ticker := NewFactory(WithClock(clock)).NewTickerTopic("ticker", time.Minute, TickImmediately())
+	//when
+	ticker.NewSubscriber(func(event interface{}) {
+		ticks <- event
+	})
+	//then
+	assert.AreEqual(Tick{epoch, 1, 0, false}, <-ticks)
+	ticker.Close()
+}
+
+func TestThat_TickerTopic_ReportsMissedTicks(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	clock := NewManualClock(epoch)
+	ticks := make(chan interface{})
+	ticker := NewFactory(WithClock(clock)).NewTickerTopic("ticker", time.Minute)
+	ticker.NewSubscriber(func(event interface{}) {
+		ticks <- event
+	})
+	//when nobody could consume the ticks in between
+	clock.Advance(3 * time.Minute)
+	assert.AreEqual(Tick{epoch.Add(time.Minute), 1, 0, false}, <-ticks)
+	clock.Advance(time.Minute)
+	//then
+	assert.AreEqual(Tick{epoch.Add(4 * time.Minute), 2, 2, false}, <-ticks)
+	ticker.Close()
+}
+
+func TestThat_TickerTopic_CanBePausedAndResumed(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	clock := NewManualClock(epoch)
+	ticks := make(chan interface{})
+	ticker := NewFactory(WithClock(clock)).NewTickerTopic("ticker", time.Minute)
+	ticker.NewSubscriber(func(event interface{}) {
+		ticks <- event
+	})
+	//when
+	ticker.Pause()
+	clock.Advance(time.Hour)
+	ticker.Resume()
+	clock.Advance(time.Minute)
+	//then the pause does not count as missed ticks
+	assert.AreEqual(Tick{epoch.Add(61 * time.Minute), 1, 0, false}, <-ticks)
+	ticker.Close()
+}
+
+func TestThat_TickerTopic_CanBeReset(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	clock := NewManualClock(epoch)
+	ticks := make(chan interface{})
+	ticker := NewFactory(WithClock(clock)).NewTickerTopic("ticker", time.Minute)
+	ticker.NewSubscriber(func(event interface{}) {
+		ticks <- event
+	})
+	//when
+	err := ticker.Reset(time.Hour)
+	clock.Advance(time.Hour)
+	//then
+	assert.IsTrue(err == nil)
+	assert.AreEqual(Tick{epoch.Add(time.Hour), 1, 0, false}, <-ticks)
+	assert.IsTrue(ticker.Reset(0) != nil)
+	clock.Advance(time.Hour)
+	assert.AreEqual(Tick{epoch.Add(2 * time.Hour), 2, 0, false}, <-ticks)
+	ticker.Close()
+	assert.DoesNotThrow(func() {
+		ticker.Pause()
+		ticker.Reset(time.Second)
+	})
+}
+
+func TestThat_PublishingToATickerTopic_InjectsAManualTick(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	clock := NewManualClock(epoch)
+	ticks := make(chan interface{})
+	ticker := NewFactory(WithClock(clock)).NewTickerTopic("ticker", time.Minute)
+	ticker.NewSubscriber(func(event interface{}) {
+		ticks <- event
+	})
+	//when
+	ticker.NewPublisher()("refresh now")
+	//then
+	assert.AreEqual(Tick{epoch, 1, 0, true}, <-ticks)
+	clock.Advance(time.Minute)
+	assert.AreEqual(Tick{epoch.Add(time.Minute), 2, 0, false}, <-ticks)
+	ticker.Close()
+	assert.DoesNotThrow(func() {
+		ticker.NewPublisher()(epoch)
+	})
+}
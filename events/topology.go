@@ -0,0 +1,270 @@
+package events
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+/*
+The graph of the event flow of one or more Factories (see Factory.Topology and MergeTopologies):
+Topics and gates are nodes, edges lead from gates' inputs to the gates, and from bridged Topics
+(see Bridge) to the Topics of other Factories they forward events to.
+Topologies marshal to JSON as they are, and render as Graphviz DOT with DOT.
+*/
+type Topology struct {
+	Nodes []TopologyNode `json:"nodes"`
+	Edges []TopologyEdge `json:"edges"`
+}
+
+type TopologyNode struct {
+	//Unique within merged Topologies: the id of the Factory and the name of the Topic
+	Id      string `json:"id"`
+	Factory string `json:"factory"`
+	Topic   string `json:"topic"`
+	//The kind of the Topic (see TopicDescription), or 'external' for Topics of other Factories
+	//which are known only as the destinations of bridges
+	Kind string `json:"kind"`
+	//For gates, 'and' or 'or'
+	Operator string `json:"operator,omitempty"`
+}
+
+type TopologyEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	//'gate' or 'bridge'
+	Kind string `json:"kind"`
+}
+
+//kinds of edges
+const (
+	EdgeGate   = "gate"
+	EdgeBridge = "bridge"
+)
+
+const externalKind = "external"
+
+//a bridge from a Topic of the Factory, see Bridge
+type bridgeRoute struct {
+	//the bridged Topic, the route is removed along with it (see removeTopic)
+	topic Topic
+	to    string
+}
+
+func nodeId(factoryId string, topicName string) string {
+	return factoryId + "/" + topicName
+}
+
+//registers the bridge of a Topic of the Factory, so that it's part of the Topology, unless the Topic is closed
+func (t *factory) addBridge(topic Topic, to string) {
+	stateChanged := make(chan bool)
+	adder := func(p *factory) {
+		if p.topics[topic.String()] == topic {
+			p.bridges = append(p.bridges, bridgeRoute{topic, to})
+		}
+	}
+	t.modify(&stateModifierSpec{adder, stateChanged, false})
+	close(stateChanged)
+}
+
+func (t *factory) Topology() Topology {
+	topology := Topology{Nodes: []TopologyNode{}, Edges: []TopologyEdge{}}
+	stateChanged := make(chan bool)
+	reader := func(p *factory) {
+		for name, topic := range p.topics {
+			described := describeTopic(topic)
+			node := TopologyNode{Id: nodeId(p.id, name), Factory: p.id, Topic: name, Kind: described.Kind, Operator: described.Operator}
+			topology.Nodes = append(topology.Nodes, node)
+			for _, input := range described.Inputs {
+				topology.Edges = append(topology.Edges, TopologyEdge{nodeId(p.id, input), node.Id, EdgeGate})
+			}
+		}
+		for _, bridge := range p.bridges {
+			name := bridge.topic.String()
+			target := nodeId(bridge.to, name)
+			topology.Nodes = append(topology.Nodes, TopologyNode{Id: target, Factory: bridge.to, Topic: name, Kind: externalKind})
+			topology.Edges = append(topology.Edges, TopologyEdge{nodeId(p.id, name), target, EdgeBridge})
+		}
+	}
+	t.modify(&stateModifierSpec{reader, stateChanged, false})
+	close(stateChanged)
+	return MergeTopologies(topology)
+}
+
+/*
+Combines the Topologies of several Factories (e.g. bridged ones) into one. External nodes are
+replaced by the nodes of the Factories they belong to, where those are included.
+*/
+func MergeTopologies(topologies ...Topology) Topology {
+	nodes := map[string]TopologyNode{}
+	edges := map[TopologyEdge]bool{}
+	for _, topology := range topologies {
+		for _, node := range topology.Nodes {
+			if known, exists := nodes[node.Id]; !exists || known.Kind == externalKind {
+				nodes[node.Id] = node
+			}
+		}
+		for _, edge := range topology.Edges {
+			edges[edge] = true
+		}
+	}
+	merged := Topology{Nodes: []TopologyNode{}, Edges: []TopologyEdge{}}
+	for _, node := range nodes {
+		merged.Nodes = append(merged.Nodes, node)
+	}
+	for edge := range edges {
+		merged.Edges = append(merged.Edges, edge)
+	}
+	sort.Sort(nodesById(merged.Nodes))
+	sort.Sort(edgesByEnds(merged.Edges))
+	return merged
+}
+
+/*
+Returns the cycles of the graph, as the ids of the nodes taking part in each, sorted.
+Events can't loop forever through bridges (see Bridge), still cycles usually mean a design mistake.
+*/
+func (t Topology) Cycles() [][]string {
+	successors := map[string][]string{}
+	for _, edge := range t.Edges {
+		successors[edge.From] = append(successors[edge.From], edge.To)
+	}
+	//Tarjan's algorithm for strongly connected components
+	var (
+		index    = map[string]int{}
+		lowest   = map[string]int{}
+		onStack  = map[string]bool{}
+		stack    = []string{}
+		cycles   = [][]string{}
+		connect  func(string)
+		sequence = 0
+	)
+	connect = func(node string) {
+		index[node], lowest[node] = sequence, sequence
+		sequence++
+		stack = append(stack, node)
+		onStack[node] = true
+		selfLoop := false
+		for _, next := range successors[node] {
+			if next == node {
+				selfLoop = true
+			}
+			if _, visited := index[next]; !visited {
+				connect(next)
+				if lowest[next] < lowest[node] {
+					lowest[node] = lowest[next]
+				}
+			} else if onStack[next] && index[next] < lowest[node] {
+				lowest[node] = index[next]
+			}
+		}
+		if lowest[node] != index[node] {
+			return
+		}
+		component := []string{}
+		for {
+			last := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[last] = false
+			component = append(component, last)
+			if last == node {
+				break
+			}
+		}
+		if len(component) > 1 || selfLoop {
+			sort.Strings(component)
+			cycles = append(cycles, component)
+		}
+	}
+	nodes := []string{}
+	for _, node := range t.Nodes {
+		nodes = append(nodes, node.Id)
+	}
+	for _, edge := range t.Edges {
+		nodes = append(nodes, edge.From, edge.To)
+	}
+	sort.Strings(nodes)
+	for _, node := range nodes {
+		if _, visited := index[node]; !visited {
+			connect(node)
+		}
+	}
+	sort.Sort(cyclesByFirstNode(cycles))
+	return cycles
+}
+
+/*
+Renders the graph in the Graphviz DOT language, one cluster per Factory: gates are diamonds
+labelled with their operator, external Topics and bridges are dashed.
+*/
+func (t Topology) DOT() string {
+	out := &bytes.Buffer{}
+	fmt.Fprintln(out, "digraph events {")
+	fmt.Fprintln(out, "\trankdir=LR;")
+	factories := []string{}
+	byFactory := map[string][]TopologyNode{}
+	for _, node := range t.Nodes {
+		if _, exists := byFactory[node.Factory]; !exists {
+			factories = append(factories, node.Factory)
+		}
+		byFactory[node.Factory] = append(byFactory[node.Factory], node)
+	}
+	sort.Strings(factories)
+	for i, factoryId := range factories {
+		fmt.Fprintf(out, "\tsubgraph cluster_%v {\n", i)
+		fmt.Fprintf(out, "\t\tlabel=%v;\n", dotQuote(factoryId))
+		for _, node := range byFactory[factoryId] {
+			fmt.Fprintf(out, "\t\t%v [%v];\n", dotQuote(node.Id), dotAttributes(node))
+		}
+		fmt.Fprintln(out, "\t}")
+	}
+	for _, edge := range t.Edges {
+		style := ""
+		if edge.Kind == EdgeBridge {
+			style = " [style=dashed]"
+		}
+		fmt.Fprintf(out, "\t%v -> %v%v;\n", dotQuote(edge.From), dotQuote(edge.To), style)
+	}
+	fmt.Fprintln(out, "}")
+	return out.String()
+}
+
+func dotAttributes(node TopologyNode) string {
+	switch {
+	case node.Kind == "gate":
+		return fmt.Sprintf("label=%v, shape=diamond", dotQuote(strings.ToUpper(node.Operator)))
+	case node.Kind == externalKind:
+		return fmt.Sprintf("label=%v, shape=box, style=dashed", dotQuote(node.Topic))
+	}
+	return fmt.Sprintf("label=%v, shape=box", dotQuote(node.Topic+"\n("+node.Kind+")"))
+}
+
+var dotEscaper = strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n")
+
+func dotQuote(value string) string {
+	return "\"" + dotEscaper.Replace(value) + "\""
+}
+
+type nodesById []TopologyNode
+
+func (s nodesById) Len() int           { return len(s) }
+func (s nodesById) Less(i, j int) bool { return s[i].Id < s[j].Id }
+func (s nodesById) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+type edgesByEnds []TopologyEdge
+
+func (s edgesByEnds) Len() int { return len(s) }
+func (s edgesByEnds) Less(i, j int) bool {
+	if s[i].From != s[j].From {
+		return s[i].From < s[j].From
+	}
+	return s[i].To < s[j].To
+}
+func (s edgesByEnds) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+
+type cyclesByFirstNode [][]string
+
+func (s cyclesByFirstNode) Len() int           { return len(s) }
+func (s cyclesByFirstNode) Less(i, j int) bool { return s[i][0] < s[j][0] }
+func (s cyclesByFirstNode) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
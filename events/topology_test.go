@@ -0,0 +1,126 @@
+package events
+
+import (
+	"encoding/json"
+	"github.com/tholowka/testing/assertions"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestThat_Topology_LinksGates_ToTheirInputs(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	f := NewFactory()
+	id := f.(*factory).id
+	orders := f.NewTopic("orders")
+	payments := f.NewReplayTopic("payments", 10)
+	gate := f.AndGate([]Topic{orders, payments})
+	//when
+	topology := f.Topology()
+	//then
+	assert.AreEqual([]TopologyNode{
+		{Id: id + "/" + gate.String(), Factory: id, Topic: gate.String(), Kind: "gate", Operator: "and"},
+		{Id: id + "/orders", Factory: id, Topic: "orders", Kind: "topic"},
+		{Id: id + "/payments", Factory: id, Topic: "payments", Kind: "replay"},
+	}, topology.Nodes)
+	assert.AreEqual([]TopologyEdge{
+		{id + "/orders", id + "/" + gate.String(), EdgeGate},
+		{id + "/payments", id + "/" + gate.String(), EdgeGate},
+	}, topology.Edges)
+	assert.AreEqual(0, len(topology.Cycles()))
+}
+
+func TestThat_Topology_ShowsBridges_UntilTheTopicIsClosed(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	src, dst := NewFactory(), NewFactory()
+	srcId, dstId := src.(*factory).id, dst.(*factory).id
+	orders := src.NewTopic("orders")
+	assert.IsTrue(Bridge(src, dst, "orders") == nil)
+	//when
+	topology := src.Topology()
+	//then
+	assert.AreEqual(2, len(topology.Nodes))
+	for _, node := range topology.Nodes {
+		if node.Factory == dstId {
+			assert.AreEqual(TopologyNode{Id: dstId + "/orders", Factory: dstId, Topic: "orders", Kind: "external"}, node)
+		}
+	}
+	assert.AreEqual([]TopologyEdge{{srcId + "/orders", dstId + "/orders", EdgeBridge}}, topology.Edges)
+	//when
+	orders.Close()
+	src.NewTopic("orders")
+	//then the route is gone, whether or not anybody asked for the Topology
+	stateChanged := make(chan bool)
+	routes := -1
+	src.(*factory).modify(&stateModifierSpec{func(p *factory) {
+		routes = len(p.bridges)
+	}, stateChanged, false})
+	close(stateChanged)
+	assert.AreEqual(0, routes)
+	assert.AreEqual(0, len(src.Topology().Edges))
+}
+
+func TestThat_MergedTopologies_RevealCycles(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	first, second := NewFactory(), NewFactory()
+	firstId, secondId := first.(*factory).id, second.(*factory).id
+	first.NewTopic("orders")
+	first.NewTopic("payments")
+	assert.IsTrue(Bridge(first, second, "orders") == nil)
+	assert.IsTrue(Bridge(second, first, "orders") == nil)
+	//when
+	merged := MergeTopologies(first.Topology(), second.Topology())
+	//then
+	for _, node := range merged.Nodes {
+		assert.IsTrue(node.Kind != "external")
+	}
+	assert.AreEqual(3, len(merged.Nodes))
+	cycle := []string{firstId + "/orders", secondId + "/orders"}
+	sort.Strings(cycle)
+	assert.AreEqual([][]string{cycle}, merged.Cycles())
+}
+
+func TestThat_Topology_DetectsSelfLoops(t *testing.T) {
+	assert := assertions.New(t)
+	topology := Topology{
+		Nodes: []TopologyNode{{Id: "f/a"}, {Id: "f/b"}},
+		Edges: []TopologyEdge{{"f/a", "f/a", EdgeBridge}, {"f/a", "f/b", EdgeGate}},
+	}
+	assert.AreEqual([][]string{{"f/a"}}, topology.Cycles())
+}
+
+func TestThat_Topology_RendersAsDot(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	f := NewFactory()
+	id := f.(*factory).id
+	orders := f.NewTopic("orders")
+	f.OrGate([]Topic{orders})
+	assert.IsTrue(Bridge(f, NewFactory(), "orders") == nil)
+	//when
+	dot := f.Topology().DOT()
+	//then
+	assert.IsTrue(strings.HasPrefix(dot, "digraph events {\n"))
+	assert.IsTrue(strings.Contains(dot, "label=\""+id+"\";"))
+	assert.IsTrue(strings.Contains(dot, "\""+id+"/orders\" [label=\"orders\\n(topic)\", shape=box];"))
+	assert.IsTrue(strings.Contains(dot, "[label=\"OR\", shape=diamond];"))
+	assert.IsTrue(strings.Contains(dot, "shape=box, style=dashed];"))
+	assert.IsTrue(strings.Contains(dot, "[style=dashed];"))
+	assert.IsTrue(strings.HasSuffix(dot, "}\n"))
+}
+
+func TestThat_Topology_RoundTrips_AsJson(t *testing.T) {
+	assert := assertions.New(t)
+	f := NewFactory()
+	orders := f.NewTopic("orders")
+	f.AndGate([]Topic{orders})
+	topology := f.Topology()
+	encoded, err := json.Marshal(topology)
+	assert.IsTrue(err == nil)
+	decoded := Topology{}
+	assert.IsTrue(json.Unmarshal(encoded, &decoded) == nil)
+	assert.AreEqual(topology, decoded)
+}
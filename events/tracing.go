@@ -0,0 +1,192 @@
+package events
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+Identifies a span of a trace, the way W3C Trace Context (and hence OpenTelemetry) does.
+The zero value means no span.
+*/
+type SpanContext struct {
+	TraceId [16]byte
+	SpanId  [8]byte
+	Sampled bool
+}
+
+func (c SpanContext) IsValid() bool {
+	return c.TraceId != [16]byte{} && c.SpanId != [8]byte{}
+}
+
+/*
+Formats the span as a W3C traceparent header, e.g. for passing it on to other processes.
+*/
+func (c SpanContext) Traceparent() string {
+	flags := "00"
+	if c.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%x-%x-%v", c.TraceId, c.SpanId, flags)
+}
+
+/*
+Reads a W3C traceparent header, see SpanContext.Traceparent.
+*/
+func ParseTraceparent(header string) (SpanContext, error) {
+	context := SpanContext{}
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) != 4 || parts[0] != "00" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return context, fmt.Errorf("Invalid traceparent '%v'", header)
+	}
+	traceId, traceErr := hex.DecodeString(parts[1])
+	spanId, spanErr := hex.DecodeString(parts[2])
+	flags, flagsErr := hex.DecodeString(parts[3])
+	if traceErr != nil || spanErr != nil || flagsErr != nil {
+		return context, fmt.Errorf("Invalid traceparent '%v'", header)
+	}
+	copy(context.TraceId[:], traceId)
+	copy(context.SpanId[:], spanId)
+	context.Sampled = flags[0]&0x01 != 0
+	if !context.IsValid() {
+		return SpanContext{}, fmt.Errorf("Invalid traceparent '%v'", header)
+	}
+	return context, nil
+}
+
+/*
+Starts the spans a Factory reports, see WithTracer. Adapting an OpenTelemetry tracer takes
+converting the SpanContexts. Attributes are alternating keys and values, as with Logger.
+*/
+type Tracer interface {
+	//Starts a span, a child of the parent unless the parent is the zero SpanContext
+	Start(name string, parent SpanContext, attributes ...interface{}) Span
+}
+
+type Span interface {
+	Context() SpanContext
+	End()
+}
+
+/*
+Makes the Factory trace events with the Tracer. Publishing an event starts a 'publish <topic>'
+span, and every Subscriber invocation a 'deliver <topic>' child span of it; requeues of the event
+are 'requeue <topic>' children as well. Subscribers registered WithEnvelope find their span in
+Envelope.Trace, and events published within it (see WithinSpan), gates' included, continue the trace.
+Without a Tracer, which is the default, nothing is traced.
+*/
+func WithTracer(tracer Tracer) FactoryOption {
+	return func(t *factory) {
+		t.tracer = tracer
+	}
+}
+
+//an event published within a span, see WithinSpan
+type spannedEvent struct {
+	event  interface{}
+	parent SpanContext
+}
+
+/*
+Wraps the event, so that publishing it to a Topic of a Factory continues the trace of the parent,
+typically the Envelope.Trace of the event a Subscriber is handling. Subscribers receive the event unwrapped.
+*/
+func WithinSpan(parent SpanContext, event interface{}) interface{} {
+	return &spannedEvent{event, parent}
+}
+
+//unwraps events published WithinSpan
+func unwrapSpan(event interface{}) (interface{}, SpanContext) {
+	if spanned, isSpanned := event.(*spannedEvent); isSpanned {
+		return spanned.event, spanned.parent
+	}
+	return event, SpanContext{}
+}
+
+/*
+Counts the publication of an event and starts its span.
+Returns the span the event's deliveries are children of.
+*/
+func (t *factory) published(topicName string, parent SpanContext) SpanContext {
+	t.metrics.Count(MetricPublished, topicName, 1)
+	if t.tracer == nil {
+		return parent
+	}
+	span := t.tracer.Start("publish "+topicName, parent, "topic", topicName)
+	span.End()
+	return span.Context()
+}
+
+//must run in the factory's go-routine
+func (t *factory) traceRequeue(event *eventSpec) {
+	if t.tracer != nil {
+		t.tracer.Start("requeue "+event.name, event.trace, "topic", event.name, "delay", event.delay).End()
+	}
+}
+
+/*
+A Tracer keeping the spans in memory, for tests.
+*/
+type SpanRecorder struct {
+	lock  sync.Mutex
+	spans []RecordedSpan
+}
+
+/*
+A span ended by a SpanRecorder.
+*/
+type RecordedSpan struct {
+	Name       string
+	Context    SpanContext
+	Parent     SpanContext
+	Attributes map[string]interface{}
+	Start      time.Time
+	End        time.Time
+}
+
+func NewSpanRecorder() *SpanRecorder {
+	return &SpanRecorder{}
+}
+
+func (r *SpanRecorder) Start(name string, parent SpanContext, attributes ...interface{}) Span {
+	context := SpanContext{TraceId: parent.TraceId, Sampled: true}
+	if !parent.IsValid() {
+		rand.Read(context.TraceId[:])
+	}
+	rand.Read(context.SpanId[:])
+	recorded := map[string]interface{}{}
+	for i := 0; i+1 < len(attributes); i += 2 {
+		recorded[fmt.Sprintf("%v", attributes[i])] = attributes[i+1]
+	}
+	return &recordedSpan{r, RecordedSpan{name, context, parent, recorded, time.Now(), time.Time{}}, sync.Once{}}
+}
+
+//Returns the spans ended so far, in the order they were ended.
+func (r *SpanRecorder) Spans() []RecordedSpan {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]RecordedSpan{}, r.spans...)
+}
+
+type recordedSpan struct {
+	recorder *SpanRecorder
+	span     RecordedSpan
+	ended    sync.Once
+}
+
+func (s *recordedSpan) Context() SpanContext {
+	return s.span.Context
+}
+
+func (s *recordedSpan) End() {
+	s.ended.Do(func() {
+		s.span.End = time.Now()
+		s.recorder.lock.Lock()
+		defer s.recorder.lock.Unlock()
+		s.recorder.spans = append(s.recorder.spans, s.span)
+	})
+}
@@ -0,0 +1,130 @@
+package events
+
+import (
+	"github.com/tholowka/testing/assertions"
+	"strings"
+	"testing"
+	"time"
+)
+
+//waits for a span with the name to end
+func awaitSpan(recorder *SpanRecorder, name string) (RecordedSpan, bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		for _, span := range recorder.Spans() {
+			if span.Name == name {
+				return span, true
+			}
+		}
+		if time.Now().After(deadline) {
+			return RecordedSpan{}, false
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestThat_Deliveries_AreChildSpans_OfThePublication(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	recorder := NewSpanRecorder()
+	received := make(chan *Envelope)
+	topic := NewFactory(WithTracer(recorder)).NewTopic("orders")
+	topic.NewSubscriber(func(event interface{}) {
+		received <- event.(*Envelope)
+	}, WithEnvelope())
+	//when
+	topic.NewPublisher()("order")
+	envelope := <-received
+	//then
+	published, _ := awaitSpan(recorder, "publish orders")
+	delivered, ended := awaitSpan(recorder, "deliver orders")
+	assert.IsTrue(ended)
+	assert.AreEqual(published.Context, delivered.Parent)
+	assert.AreEqual(delivered.Context, envelope.Trace)
+	assert.AreEqual(map[string]interface{}{"topic": "orders", "offset": uint64(0)}, delivered.Attributes)
+	assert.IsTrue(!published.Parent.IsValid())
+}
+
+func TestThat_EventsPublishedWithinASpan_ContinueTheTrace(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	recorder := NewSpanRecorder()
+	f := NewFactory(WithTracer(recorder))
+	received := make(chan interface{})
+	payments := f.NewTopic("payments", func(event interface{}) {
+		received <- event
+	})
+	orders := f.NewTopic("orders")
+	orders.NewSubscriber(func(event interface{}) {
+		envelope := event.(*Envelope)
+		payments.NewPublisher()(WithinSpan(envelope.Trace, "payment"))
+	}, WithEnvelope())
+	//when
+	orders.NewPublisher()("order")
+	//then
+	assert.AreEqual("payment", <-received)
+	deliveredOrder, _ := awaitSpan(recorder, "deliver orders")
+	publishedPayment, _ := awaitSpan(recorder, "publish payments")
+	deliveredPayment, _ := awaitSpan(recorder, "deliver payments")
+	assert.AreEqual(deliveredOrder.Context, publishedPayment.Parent)
+	assert.AreEqual(publishedPayment.Context, deliveredPayment.Parent)
+	assert.AreEqual(deliveredOrder.Context.TraceId, deliveredPayment.Context.TraceId)
+}
+
+func TestThat_GateEmissions_ContinueTheTrace(t *testing.T) {
+	assert := assertions.New(t)
+	recorder := NewSpanRecorder()
+	f := NewFactory(WithTracer(recorder))
+	orders := f.NewTopic("orders")
+	received := make(chan interface{})
+	gate := f.OrGate([]Topic{orders}, func(event interface{}) {
+		received <- event
+	})
+	orders.NewPublisher()("order")
+	<-received
+	published, _ := awaitSpan(recorder, "publish orders")
+	delivered, _ := awaitSpan(recorder, "deliver orders")
+	gated, emitted := awaitSpan(recorder, "publish "+gate.String())
+	assert.IsTrue(emitted)
+	assert.AreEqual(delivered.Context, gated.Parent)
+	assert.AreEqual(published.Context.TraceId, gated.Context.TraceId)
+}
+
+func TestThat_Requeues_AreChildSpans_OfThePublication(t *testing.T) {
+	assert := assertions.New(t)
+	recorder := NewSpanRecorder()
+	topic := NewFactory(WithTracer(recorder), WithClock(NewManualClock(time.Now()))).NewTopic("orders")
+	topic.Close()
+	topic.NewPublisher()("order")
+	published, _ := awaitSpan(recorder, "publish orders")
+	requeued, ended := awaitSpan(recorder, "requeue orders")
+	assert.IsTrue(ended)
+	assert.AreEqual(published.Context, requeued.Parent)
+}
+
+func TestThat_EventsPublishedWithinASpan_AreUnwrapped_WithoutATracer(t *testing.T) {
+	assert := assertions.New(t)
+	received := make(chan *Envelope)
+	topic := NewFactory().NewTopic("orders")
+	topic.NewSubscriber(func(event interface{}) {
+		received <- event.(*Envelope)
+	}, WithEnvelope())
+	parent, _ := ParseTraceparent("00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	topic.NewPublisher()(WithinSpan(parent, "order"))
+	envelope := <-received
+	assert.AreEqual("order", envelope.Event)
+	assert.AreEqual(parent, envelope.Trace)
+}
+
+func TestThat_SpanContexts_RoundTrip_AsTraceparents(t *testing.T) {
+	assert := assertions.New(t)
+	header := "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+	context, err := ParseTraceparent(header)
+	assert.IsTrue(err == nil)
+	assert.IsTrue(context.Sampled)
+	assert.AreEqual(header, context.Traceparent())
+	for _, invalid := range []string{"", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331", strings.Replace(header, "0af7", "zzzz", 1), "00-00000000000000000000000000000000-b7ad6b7169203331-01"} {
+		_, err = ParseTraceparent(invalid)
+		assert.IsTrue(err != nil)
+	}
+}
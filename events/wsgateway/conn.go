@@ -0,0 +1,283 @@
+package wsgateway
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+//opcodes of RFC 6455 frames
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+)
+
+//status codes of close frames
+const (
+	closeProtocolError   = 1002
+	closePolicyViolation = 1008
+	closeTooBig          = 1009
+)
+
+const acceptGuid = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+var errClosed = errors.New("The websocket was closed")
+
+/*
+A protocol error, which closes the connection with the given status code.
+*/
+type protocolError struct {
+	code   uint16
+	reason string
+}
+
+func (e *protocolError) Error() string {
+	return e.reason
+}
+
+/*
+A minimal implementation of the WebSocket protocol (RFC 6455): enough to exchange text
+and binary messages, answer pings, and close connections. Extensions and subprotocols
+are not supported. Reading is not safe for concurrent use, writing is.
+*/
+type conn struct {
+	raw    net.Conn
+	reader *bufio.Reader
+	//clients mask the frames they send, servers require them to
+	client       bool
+	maxMessage   int64
+	writeTimeout time.Duration
+	writeLock    sync.Mutex
+}
+
+/*
+Takes over the connection of a WebSocket handshake request, replying with an HTTP error if it
+isn't one, or if the origin check refuses it.
+*/
+func upgrade(w http.ResponseWriter, r *http.Request, checkOrigin func(*http.Request) bool) (*conn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	switch {
+	case r.Method != "GET":
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return nil, errors.New("A websocket handshake has to use GET")
+	case !headerContains(r.Header, "Connection", "upgrade") || !headerContains(r.Header, "Upgrade", "websocket"):
+		http.Error(w, "Expected a websocket handshake", http.StatusBadRequest)
+		return nil, errors.New("Not a websocket handshake")
+	case r.Header.Get("Sec-WebSocket-Version") != "13":
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "Unsupported websocket version", http.StatusUpgradeRequired)
+		return nil, errors.New("Unsupported websocket version")
+	case key == "":
+		http.Error(w, "Missing Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, errors.New("Missing Sec-WebSocket-Key")
+	case !checkOrigin(r):
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return nil, fmt.Errorf("The origin '%v' is not allowed", r.Header.Get("Origin"))
+	}
+	hijacker, canHijack := w.(http.Hijacker)
+	if !canHijack {
+		http.Error(w, "Websockets are not supported", http.StatusInternalServerError)
+		return nil, errors.New("The response can't be hijacked")
+	}
+	raw, buffered, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n\r\n"
+	if _, err = buffered.WriteString(response); err == nil {
+		err = buffered.Flush()
+	}
+	if err != nil {
+		raw.Close()
+		return nil, err
+	}
+	return &conn{raw: raw, reader: buffered.Reader}, nil
+}
+
+func acceptKey(key string) string {
+	hash := sha1.Sum([]byte(key + acceptGuid))
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+//tells whether the comma-separated header contains the token, ignoring case
+func headerContains(header http.Header, name string, token string) bool {
+	for _, value := range header[name] {
+		for _, element := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(element), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+/*
+Returns the next text or binary message, answering pings in the meantime.
+Returns errClosed once the other side closed the connection.
+*/
+func (c *conn) readMessage() (byte, []byte, error) {
+	var (
+		opcode  byte
+		message []byte
+		started bool
+	)
+	for {
+		fin, frameOpcode, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+		switch frameOpcode {
+		case opPing:
+			if err = c.writeFrame(opPong, payload); err != nil {
+				return 0, nil, err
+			}
+			//control frames may come in the middle of a fragmented message
+			continue
+		case opPong:
+			continue
+		case opClose:
+			code := []byte{}
+			if len(payload) >= 2 {
+				code = payload[:2]
+			}
+			c.writeFrame(opClose, code)
+			return 0, nil, errClosed
+		case opText, opBinary:
+			if started {
+				return 0, nil, &protocolError{closeProtocolError, "Expected a continuation frame"}
+			}
+			opcode, message, started = frameOpcode, payload, true
+		case opContinuation:
+			if !started {
+				return 0, nil, &protocolError{closeProtocolError, "Unexpected continuation frame"}
+			}
+			message = append(message, payload...)
+		default:
+			return 0, nil, &protocolError{closeProtocolError, fmt.Sprintf("Unknown opcode %v", frameOpcode)}
+		}
+		if c.maxMessage > 0 && int64(len(message)) > c.maxMessage {
+			return 0, nil, &protocolError{closeTooBig, "The message is too big"}
+		}
+		if started && fin {
+			return opcode, message, nil
+		}
+	}
+}
+
+func (c *conn) readFrame() (bool, byte, []byte, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(c.reader, header); err != nil {
+		return false, 0, nil, err
+	}
+	fin, opcode := header[0]&0x80 != 0, header[0]&0x0F
+	masked, length := header[1]&0x80 != 0, uint64(header[1]&0x7F)
+	if header[0]&0x70 != 0 {
+		return false, 0, nil, &protocolError{closeProtocolError, "Extensions are not supported"}
+	}
+	if masked == c.client {
+		return false, 0, nil, &protocolError{closeProtocolError, "Only frames sent by clients are masked"}
+	}
+	if opcode >= opClose && (!fin || length > 125) {
+		return false, 0, nil, &protocolError{closeProtocolError, "Invalid control frame"}
+	}
+	switch length {
+	case 126:
+		extended := make([]byte, 2)
+		if _, err := io.ReadFull(c.reader, extended); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(extended))
+	case 127:
+		extended := make([]byte, 8)
+		if _, err := io.ReadFull(c.reader, extended); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(extended)
+	}
+	if c.maxMessage > 0 && length > uint64(c.maxMessage) {
+		return false, 0, nil, &protocolError{closeTooBig, "The message is too big"}
+	}
+	mask := make([]byte, 4)
+	if masked {
+		if _, err := io.ReadFull(c.reader, mask); err != nil {
+			return false, 0, nil, err
+		}
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return fin, opcode, payload, nil
+}
+
+//writes the payload as a single, final frame
+func (c *conn) writeFrame(opcode byte, payload []byte) error {
+	frame := []byte{0x80 | opcode, 0}
+	switch length := len(payload); {
+	case length <= 125:
+		frame[1] = byte(length)
+	case length <= 0xFFFF:
+		frame[1] = 126
+		frame = append(frame, 0, 0)
+		binary.BigEndian.PutUint16(frame[2:], uint16(length))
+	default:
+		frame[1] = 127
+		frame = append(frame, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(frame[2:], uint64(length))
+	}
+	if c.client {
+		mask := make([]byte, 4)
+		if _, err := rand.Read(mask); err != nil {
+			return err
+		}
+		frame[1] |= 0x80
+		frame = append(frame, mask...)
+		start := len(frame)
+		frame = append(frame, payload...)
+		for i := range payload {
+			frame[start+i] ^= mask[i%4]
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	if c.writeTimeout > 0 {
+		c.raw.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+	}
+	_, err := c.raw.Write(frame)
+	return err
+}
+
+//sends a close frame with the status code and reason, then closes the connection
+func (c *conn) close(code uint16, reason string) error {
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, code)
+	if len(reason) > 123 {
+		reason = reason[:123]
+	}
+	c.writeFrame(opClose, append(payload, reason...))
+	return c.raw.Close()
+}
@@ -0,0 +1,79 @@
+package wsgateway
+
+import (
+	"bufio"
+	"bytes"
+	"github.com/tholowka/testing/assertions"
+	"net"
+	"testing"
+)
+
+//a server and a client side of a connection
+func pipe() (*conn, *conn) {
+	serverSide, clientSide := net.Pipe()
+	server := &conn{raw: serverSide, reader: bufio.NewReader(serverSide)}
+	client := &conn{raw: clientSide, reader: bufio.NewReader(clientSide), client: true}
+	return server, client
+}
+
+func TestThat_AcceptKey_FollowsTheRFC(t *testing.T) {
+	assert := assertions.New(t)
+	//the example of RFC 6455, section 1.3
+	assert.AreEqual("s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", acceptKey("dGhlIHNhbXBsZSBub25jZQ=="))
+}
+
+func TestThat_Conn_ExchangesMessages_OfAnySize(t *testing.T) {
+	assert := assertions.New(t)
+	server, client := pipe()
+	for _, size := range []int{0, 125, 126, 0xFFFF, 0x10000} {
+		sent := bytes.Repeat([]byte("x"), size)
+		go client.writeFrame(opText, sent)
+		opcode, received, err := server.readMessage()
+		assert.IsTrue(err == nil)
+		assert.AreEqual(byte(opText), opcode)
+		assert.IsTrue(bytes.Equal(sent, received))
+		go server.writeFrame(opBinary, sent)
+		opcode, received, err = client.readMessage()
+		assert.IsTrue(err == nil)
+		assert.AreEqual(byte(opBinary), opcode)
+		assert.IsTrue(bytes.Equal(sent, received))
+	}
+}
+
+func TestThat_Conn_ReassemblesFragments_AndAnswersPings(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	server, client := pipe()
+	go func() {
+		//masked with a zero key, i.e. unchanged
+		client.raw.Write([]byte{opText, 0x80 | 3, 0, 0, 0, 0, 'o', 'n', 'e'})
+		client.raw.Write([]byte{0x80 | opPing, 0x80 | 1, 0, 0, 0, 0, '!'})
+		client.raw.Write([]byte{0x80 | opContinuation, 0x80 | 3, 0, 0, 0, 0, 't', 'w', 'o'})
+	}()
+	pongs := make(chan []byte)
+	go func() {
+		_, opcode, payload, _ := client.readFrame()
+		if opcode == opPong {
+			pongs <- payload
+		}
+	}()
+	//when
+	_, message, err := server.readMessage()
+	//then
+	assert.IsTrue(err == nil)
+	assert.AreEqual("onetwo", string(message))
+	assert.AreEqual("!", string(<-pongs))
+}
+
+func TestThat_Conn_Rejects_UnmaskedFramesOfClients_AndTooBigMessages(t *testing.T) {
+	assert := assertions.New(t)
+	server, client := pipe()
+	go client.raw.Write([]byte{0x80 | opText, 1, 'x'})
+	_, _, err := server.readMessage()
+	assert.AreEqual(&protocolError{closeProtocolError, "Only frames sent by clients are masked"}, err)
+	server, client = pipe()
+	server.maxMessage = 2
+	go client.writeFrame(opText, []byte("xyz"))
+	_, _, err = server.readMessage()
+	assert.AreEqual(&protocolError{closeTooBig, "The message is too big"}, err)
+}
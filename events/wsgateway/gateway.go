@@ -0,0 +1,332 @@
+/*
+Exposes the Topics of an events.Factory to WebSocket clients (e.g. browsers). Over a single
+connection a client can subscribe to, and unsubscribe from, any number of Topics, and publish
+to them. Messages are JSON objects, sent as text frames. Clients send:
+
+	{"type":"subscribe","topic":"orders","id":1}
+	{"type":"unsubscribe","topic":"orders","id":2}
+	{"type":"publish","topic":"orders","event":{"id":42},"id":3}
+
+The optional id is echoed in the reply, which is either {"type":"ack","id":1} or
+{"type":"error","id":1,"error":"No topic named 'orders'"} (errors are reported even without an id).
+Events of subscribed Topics are sent as:
+
+	{"type":"event","topic":"orders","offset":7,"time":"2015-10-21T07:28:00Z","event":{"id":42}}
+
+Subscriptions only receive live events, they end with the connection. Clients which can't keep
+up with their events (i.e. whose outgoing messages pile up beyond the buffer, see WithBuffer)
+are disconnected, with the 1008 (policy violation) status code.
+
+Browsers let any page open WebSockets to any site, hence handshakes coming from another origin
+are refused (see WithCheckOrigin).
+*/
+package wsgateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/tholowka/pub-sub/events"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBuffer       = 256
+	defaultWriteTimeout = 10 * time.Second
+	defaultMaxMessage   = 1024 * 1024
+)
+
+/*
+Serves WebSocket clients, see the package documentation for the messages.
+*/
+type Handler struct {
+	factory      events.Factory
+	codecs       map[string]events.Codec
+	buffer       int
+	writeTimeout time.Duration
+	maxMessage   int64
+	checkOrigin  func(r *http.Request) bool
+}
+
+/*
+Customizes a Handler at construction time, see NewHandler.
+*/
+type Option func(*Handler)
+
+/*
+Makes the Handler decode published events, and encode delivered ones, of the Topic with
+the given name using the Codec, instead of the one the Factory uses for it (see events.WithCodec).
+The Codec has to produce JSON, as events are embedded in JSON messages.
+*/
+func WithCodec(topicName string, codec events.Codec) Option {
+	return func(h *Handler) {
+		h.codecs[topicName] = codec
+	}
+}
+
+/*
+Sets the number of messages which may wait to be sent to a client, before it's considered
+too slow and disconnected. 256 by default.
+*/
+func WithBuffer(messages int) Option {
+	return func(h *Handler) {
+		h.buffer = messages
+	}
+}
+
+/*
+Sets the time after which a client not accepting a message is disconnected. 10 seconds by default.
+*/
+func WithWriteTimeout(timeout time.Duration) Option {
+	return func(h *Handler) {
+		h.writeTimeout = timeout
+	}
+}
+
+/*
+Sets the size of the largest message accepted from clients. 1MB by default.
+*/
+func WithMaxMessage(bytes int64) Option {
+	return func(h *Handler) {
+		h.maxMessage = bytes
+	}
+}
+
+/*
+Decides whether to accept the handshake request, which is refused with 403 (Forbidden) otherwise.
+By default only requests without an Origin header (i.e. not sent by browsers), and requests
+whose Origin has the same host as the request, are accepted.
+*/
+func WithCheckOrigin(check func(r *http.Request) bool) Option {
+	return func(h *Handler) {
+		h.checkOrigin = check
+	}
+}
+
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	parsed, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(parsed.Host, r.Host)
+}
+
+func NewHandler(factory events.Factory, options ...Option) *Handler {
+	handler := &Handler{
+		factory:      factory,
+		codecs:       map[string]events.Codec{},
+		buffer:       defaultBuffer,
+		writeTimeout: defaultWriteTimeout,
+		maxMessage:   defaultMaxMessage,
+		checkOrigin:  sameOrigin,
+	}
+	for _, option := range options {
+		option(handler)
+	}
+	return handler
+}
+
+func (h *Handler) codecFor(topicName string) events.Codec {
+	if codec, exists := h.codecs[topicName]; exists {
+		return codec
+	}
+	return h.factory.CodecFor(topicName)
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrade(w, r, h.checkOrigin)
+	if err != nil {
+		return
+	}
+	conn.maxMessage, conn.writeTimeout = h.maxMessage, h.writeTimeout
+	newSocket(h, conn).run()
+}
+
+type message struct {
+	Type  string          `json:"type"`
+	Id    json.RawMessage `json:"id,omitempty"`
+	Topic string          `json:"topic,omitempty"`
+	Event json.RawMessage `json:"event,omitempty"`
+	Error string          `json:"error,omitempty"`
+}
+
+type eventMessage struct {
+	Type   string          `json:"type"`
+	Topic  string          `json:"topic"`
+	Offset uint64          `json:"offset"`
+	Time   time.Time       `json:"time"`
+	Event  json.RawMessage `json:"event"`
+}
+
+func (h *Handler) publish(topicName string, event json.RawMessage) error {
+	topic, exists := h.factory.Lookup(topicName)
+	if !exists {
+		return fmt.Errorf("No topic named '%v'", topicName)
+	}
+	decoded, err := h.codecFor(topicName).Decode(event)
+	if err != nil {
+		return err
+	}
+	topic.NewPublisher()(decoded)
+	return nil
+}
+
+/*
+A connected client. Messages are read in the socket's go-routine, and written by another one.
+Each subscribed Topic has a Subscriber of its own, removed through its Subscription.
+*/
+type socket struct {
+	handler   *Handler
+	conn      *conn
+	outgoing  chan []byte
+	done      chan bool
+	closeOnce sync.Once
+	//guards the fields below
+	lock          sync.Mutex
+	closed        bool
+	subscriptions map[string]*events.Subscription
+}
+
+func newSocket(handler *Handler, conn *conn) *socket {
+	return &socket{
+		handler:       handler,
+		conn:          conn,
+		outgoing:      make(chan []byte, handler.buffer),
+		done:          make(chan bool),
+		subscriptions: map[string]*events.Subscription{},
+	}
+}
+
+//registers a Subscriber of the Topic for the socket, unless it's subscribed already
+func (s *socket) subscribe(topicName string) error {
+	topic, exists := s.handler.factory.Lookup(topicName)
+	if !exists {
+		return fmt.Errorf("No topic named '%v'", topicName)
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, subscribed := s.subscriptions[topicName]; subscribed || s.closed {
+		return nil
+	}
+	subscription := events.NewSubscription()
+	s.subscriptions[topicName] = subscription
+	topic.NewSubscriber(func(event interface{}) {
+		s.dispatch(event.(*events.Envelope))
+	}, events.WithEnvelope(), events.WithSubscription(subscription))
+	return nil
+}
+
+func (s *socket) unsubscribe(topicName string) {
+	s.lock.Lock()
+	subscription, subscribed := s.subscriptions[topicName]
+	delete(s.subscriptions, topicName)
+	s.lock.Unlock()
+	if subscribed {
+		subscription.Unsubscribe()
+	}
+}
+
+func (s *socket) dispatch(envelope *events.Envelope) {
+	event, err := s.handler.codecFor(envelope.Topic).Encode(envelope.Event)
+	if err != nil {
+		return
+	}
+	encoded, err := json.Marshal(&eventMessage{"event", envelope.Topic, envelope.Offset, envelope.Time, event})
+	if err != nil {
+		return
+	}
+	s.deliver(encoded)
+}
+
+func (s *socket) run() {
+	go s.write()
+	for {
+		_, payload, err := s.conn.readMessage()
+		if err != nil {
+			switch failure := err.(type) {
+			case *protocolError:
+				s.close(failure.code, failure.reason)
+			default:
+				//the close frame was answered already, if there was one
+				s.close(0, "")
+			}
+			return
+		}
+		request := &message{}
+		if err = json.Unmarshal(payload, request); err != nil {
+			s.reply(&message{Type: "error", Error: err.Error()})
+			continue
+		}
+		switch request.Type {
+		case "subscribe":
+			err = s.subscribe(request.Topic)
+		case "unsubscribe":
+			s.unsubscribe(request.Topic)
+		case "publish":
+			err = s.handler.publish(request.Topic, request.Event)
+		default:
+			err = fmt.Errorf("Unknown message type '%v'", request.Type)
+		}
+		if err != nil {
+			s.reply(&message{Type: "error", Id: request.Id, Error: err.Error()})
+		} else if len(request.Id) > 0 {
+			s.reply(&message{Type: "ack", Id: request.Id})
+		}
+	}
+}
+
+func (s *socket) reply(reply *message) {
+	encoded, _ := json.Marshal(reply)
+	s.deliver(encoded)
+}
+
+//queues the message, disconnecting the client if too many are queued already
+func (s *socket) deliver(message []byte) {
+	select {
+	case s.outgoing <- message:
+	case <-s.done:
+	default:
+		go s.close(closePolicyViolation, "Too slow to keep up with the events")
+	}
+}
+
+func (s *socket) write() {
+	for {
+		select {
+		case <-s.done:
+			return
+		case message := <-s.outgoing:
+			if err := s.conn.writeFrame(opText, message); err != nil {
+				s.close(closePolicyViolation, "Too slow to keep up with the events")
+				return
+			}
+		}
+	}
+}
+
+//closes the connection, sending a close frame unless the code is 0
+func (s *socket) close(code uint16, reason string) {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.lock.Lock()
+		s.closed = true
+		subscriptions := s.subscriptions
+		s.subscriptions = map[string]*events.Subscription{}
+		s.lock.Unlock()
+		for _, subscription := range subscriptions {
+			subscription.Unsubscribe()
+		}
+		if code == 0 {
+			s.conn.raw.Close()
+		} else {
+			s.conn.close(code, reason)
+		}
+	})
+}
@@ -0,0 +1,195 @@
+package wsgateway
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/tholowka/pub-sub/events"
+	"github.com/tholowka/testing/assertions"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+//connects a client to the server, going through the handshake
+func dial(t *testing.T, server *httptest.Server) *conn {
+	raw, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request, _ := http.NewRequest("GET", server.URL, nil)
+	request.Header.Set("Connection", "Upgrade")
+	request.Header.Set("Upgrade", "websocket")
+	request.Header.Set("Sec-WebSocket-Version", "13")
+	request.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	request.Write(raw)
+	reader := bufio.NewReader(raw)
+	response, err := http.ReadResponse(reader, request)
+	if err != nil || response.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("The handshake failed: %v %v", response, err)
+	}
+	if response.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatal("Unexpected Sec-WebSocket-Accept")
+	}
+	return &conn{raw: raw, reader: reader, client: true}
+}
+
+func send(c *conn, request string) {
+	c.writeFrame(opText, []byte(request))
+}
+
+func receive(c *conn) map[string]interface{} {
+	_, payload, err := c.readMessage()
+	if err != nil {
+		return map[string]interface{}{"failure": err}
+	}
+	received := map[string]interface{}{}
+	json.Unmarshal(payload, &received)
+	return received
+}
+
+func TestThat_Handler_RejectsPlainRequests(t *testing.T) {
+	assert := assertions.New(t)
+	server := httptest.NewServer(NewHandler(events.NewFactory()))
+	defer server.Close()
+	response, _ := http.Get(server.URL)
+	assert.AreEqual(http.StatusBadRequest, response.StatusCode)
+}
+
+func TestThat_Handler_DeliversEvents_OfSubscribedTopics(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	factory := events.NewFactory()
+	orders := factory.NewTopic("orders")
+	payments := factory.NewTopic("payments")
+	server := httptest.NewServer(NewHandler(factory))
+	defer server.Close()
+	client := dial(t, server)
+	send(client, `{"type":"subscribe","topic":"orders","id":1}`)
+	assert.AreEqual(map[string]interface{}{"type": "ack", "id": float64(1)}, receive(client))
+	send(client, `{"type":"subscribe","topic":"payments","id":2}`)
+	receive(client)
+	//when
+	orders.NewPublisher()(map[string]interface{}{"id": 42})
+	//then
+	event := receive(client)
+	assert.AreEqual("event", event["type"])
+	assert.AreEqual("orders", event["topic"])
+	assert.AreEqual(map[string]interface{}{"id": float64(42)}, event["event"])
+	//when
+	send(client, `{"type":"unsubscribe","topic":"orders","id":3}`)
+	receive(client)
+	orders.NewPublisher()("ignored")
+	payments.NewPublisher()("paid")
+	//then
+	event = receive(client)
+	assert.AreEqual("payments", event["topic"])
+	assert.AreEqual("paid", event["event"])
+}
+
+func TestThat_Handler_PublishesEvents_OfClients(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	factory := events.NewFactory()
+	received := make(chan interface{})
+	factory.NewTopic("orders", func(event interface{}) {
+		received <- event
+	})
+	server := httptest.NewServer(NewHandler(factory))
+	defer server.Close()
+	client := dial(t, server)
+	//when
+	send(client, `{"type":"publish","topic":"orders","event":{"id":42}}`)
+	send(client, `{"type":"publish","topic":"missing","event":1,"id":"x"}`)
+	//then
+	assert.AreEqual(map[string]interface{}{"id": float64(42)}, <-received)
+	assert.AreEqual(map[string]interface{}{"type": "error", "id": "x", "error": "No topic named 'missing'"}, receive(client))
+}
+
+func TestThat_Handler_DisconnectsSlowClients(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	factory := events.NewFactory()
+	orders := factory.NewTopic("orders")
+	server := httptest.NewServer(NewHandler(factory, WithBuffer(1), WithWriteTimeout(50*time.Millisecond)))
+	defer server.Close()
+	client := dial(t, server)
+	send(client, `{"type":"subscribe","topic":"orders","id":1}`)
+	receive(client)
+	//when the client does not read its events
+	publisher := orders.NewPublisher()
+	payload := strings.Repeat("x", 64*1024)
+	for i := 0; i < 100; i++ {
+		publisher(payload)
+	}
+	//then it is eventually disconnected (with a close frame, unless writing it timed out as well)
+	client.raw.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, _, err := client.readMessage()
+		if err != nil {
+			timeout, isNetErr := err.(net.Error)
+			assert.IsTrue(!isNetErr || !timeout.Timeout())
+			return
+		}
+	}
+}
+
+func TestThat_Handler_RefusesHandshakes_FromOtherOrigins(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	server := httptest.NewServer(NewHandler(events.NewFactory()))
+	defer server.Close()
+	request, _ := http.NewRequest("GET", server.URL, nil)
+	request.Header.Set("Connection", "Upgrade")
+	request.Header.Set("Upgrade", "websocket")
+	request.Header.Set("Sec-WebSocket-Version", "13")
+	request.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	request.Header.Set("Origin", "http://elsewhere.example")
+	//when
+	response, _ := http.DefaultClient.Do(request)
+	//then
+	assert.AreEqual(http.StatusForbidden, response.StatusCode)
+	request.Header.Set("Origin", server.URL)
+	assert.IsTrue(sameOrigin(request))
+}
+
+func TestThat_Handler_RemovesTheSubscribers_OfClosedSockets(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	factory := events.NewFactory()
+	factory.NewTopic("orders")
+	server := httptest.NewServer(NewHandler(factory))
+	defer server.Close()
+	client := dial(t, server)
+	send(client, `{"type":"subscribe","topic":"orders","id":1}`)
+	receive(client)
+	assert.AreEqual(1, factory.Describe().Topics[0].Subscribers)
+	//when
+	client.raw.Close()
+	//then
+	for factory.Describe().Topics[0].Subscribers != 0 {
+		<-time.After(time.Millisecond)
+	}
+}
+
+func TestThat_Handler_DecodesEvents_WithTheCodecOfTheFactory(t *testing.T) {
+	//given
+	assert := assertions.New(t)
+	type order struct {
+		Id int `json:"id"`
+	}
+	factory := events.NewFactory(events.WithCodec("orders", events.NewJSONCodec(order{})))
+	received := make(chan interface{})
+	factory.NewTopic("orders", func(event interface{}) {
+		received <- event
+	})
+	server := httptest.NewServer(NewHandler(factory))
+	defer server.Close()
+	client := dial(t, server)
+	//when
+	send(client, `{"type":"publish","topic":"orders","event":{"id":42}}`)
+	//then
+	assert.AreEqual(order{42}, <-received)
+}